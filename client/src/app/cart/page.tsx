@@ -6,6 +6,7 @@ import ShippingForm from "@/components/ShippingForm";
 import { Button } from "@/components/ui/button";
 import { useAuth } from "@/contexts/AuthContext";
 import { useCart } from "@/contexts/cartContext";
+import { formatMoney } from "@/lib/utils";
 import { ArrowRight, Trash2 } from "lucide-react";
 import Image from "next/image";
 import { useRouter, useSearchParams } from "next/navigation";
@@ -133,7 +134,7 @@ const CartPage = () => {
                         Color: {item.selectedColor.toUpperCase()}
                       </p>
                     </div>
-                    <p className="font-medium">${item.price.toFixed(2)}</p>
+                    <p className="font-medium">{formatMoney(item.price)}</p>
                   </div>
                 </div>
                 <button
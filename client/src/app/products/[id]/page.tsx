@@ -1,4 +1,5 @@
 import ProductInteraction from "@/components/ProductInteraction";
+import { formatMoney } from "@/lib/utils";
 import { ProductType } from "@/types";
 import Image from "next/image";
 
@@ -10,7 +11,7 @@ const product: ProductType = {
     "Lorem ipsum dolor sit amet consect adipisicing elit lorem ipsum dolor sit.",
   description:
     "Lorem ipsum dolor sit amet consect adipisicing elit lorem ipsum dolor sit. Lorem ipsum dolor sit amet consect adipisicing elit lorem ipsum dolor sit. Lorem ipsum dolor sit amet consect adipisicing elit lorem ipsum dolor sit.",
-  price: 59.9,
+  price: { amount: 5990, currency: "USD" },
   sizes: ["xs", "s", "m", "l", "xl"],
   colors: ["gray", "purple", "green"],
   images: {
@@ -57,7 +58,7 @@ const ProductPage = async ({
       <div className="w-full lg:w-7/12 flex flex-col gap-4">
         <h1 className="text-2xl font-medium">{product.name}</h1>
         <p className="text-gray-500">{product.description}</p>
-        <h2 className="text-2xl font-semibold">${product.price.toFixed(2)}</h2>
+        <h2 className="text-2xl font-semibold">{formatMoney(product.price)}</h2>
         <ProductInteraction
           product={product}
           selectedSize={selectedSize}
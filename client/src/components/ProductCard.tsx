@@ -2,6 +2,7 @@
 
 import { useCart } from "@/contexts/cartContext";
 import useCartStore from "@/stores/cartStore";
+import { formatMoney } from "@/lib/utils";
 import { ProductType } from "@/types";
 import { ShoppingCart } from "lucide-react";
 import Image from "next/image";
@@ -97,7 +98,7 @@ const ProductCard = ({ product }: { product: ProductType }) => {
           </div>
         </div>
         <div className="flex items-center justify-between">
-          <p className="font-medium">${product.price.toFixed(2)}</p>
+          <p className="font-medium">{formatMoney(product.price)}</p>
           <button
             onClick={handleAddToCart}
             className="ring ring-gray-200 shadow-lg rounded-md px-2 py-1 text-sm cursor-pointer hover:text-white hover:bg-black transition-all duration-300 flex items-center gap-2"
@@ -8,6 +8,7 @@ import React, {
   useMemo,
   useCallback,
 } from "react";
+import { toMajorUnits } from "@/lib/utils";
 import { CartItemType as CartItem, ShippingFormInputs } from "@/types";
 
 interface CartContextType {
@@ -148,7 +149,10 @@ export const CartProvider = ({ children }: CartProviderProps) => {
 
   const getCartSubtotal = useCallback(() => {
     if (!Array.isArray(cart)) return 0;
-    return cart.reduce((total, item) => total + item.price * item.quantity, 0);
+    return cart.reduce(
+      (total, item) => total + toMajorUnits(item.price) * item.quantity,
+      0
+    );
   }, [cart]);
 
   const getDiscount = useCallback(() => {
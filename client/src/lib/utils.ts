@@ -1,6 +1,29 @@
 import { clsx, type ClassValue } from "clsx"
 import { twMerge } from "tailwind-merge"
+import type { MoneyType } from "@/types"
 
 export function cn(...inputs: ClassValue[]) {
   return twMerge(clsx(inputs))
 }
+
+// Currencies whose minor unit is not a hundredth
+const MINOR_UNIT_EXPONENTS: Record<string, number> = {
+  JPY: 0,
+  KRW: 0,
+  VND: 0,
+  BHD: 3,
+  KWD: 3,
+  OMR: 3,
+}
+
+export function toMajorUnits(money: MoneyType): number {
+  const exponent = MINOR_UNIT_EXPONENTS[money.currency] ?? 2
+  return money.amount / 10 ** exponent
+}
+
+export function formatMoney(money: MoneyType): string {
+  return new Intl.NumberFormat(undefined, {
+    style: "currency",
+    currency: money.currency,
+  }).format(toMajorUnits(money))
+}
@@ -1,10 +1,18 @@
 import { z } from "zod";
+
+// Amounts are integer minor units (e.g. cents) in an ISO 4217 currency
+export type MoneyType = {
+  amount: number;
+  currency: string;
+  display?: string;
+};
+
 export type ProductType = {
   id: string | number;
   name: string;
   shortDescription: string;
   description: string;
-  price: number;
+  price: MoneyType;
   sizes: string[];
   colors: string[];
   images: Record<string, string>;
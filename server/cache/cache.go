@@ -4,44 +4,44 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"server/config"
+	"server/events"
 
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
 type Cache struct {
-    client *redis.Client
+    client      *redis.Client
+    generations sync.Map // KeyPrefix -> cachedGeneration
+    locals      sync.Map // KeyPrefix -> *localCache
+    localHits   atomic.Int64
+    flight      singleflight.Group
+    refreshing  sync.Map // Full keys with a background refresh running
 }
 
 type CacheConfig struct {
     TTL               time.Duration
     KeyPrefix         string
     EnableCompression bool
-    MaxSize           int64
+    MaxSize           int64         // Entries kept in the L1 tier
+    L1TTL             time.Duration // Lifetime of in-process copies; 0 disables the L1 tier
+    SoftTTL           time.Duration // GetOrLoad serves older entries while refreshing them; 0 disables
+    EarlyRefreshBeta  float64       // GetOrLoad refreshes early with XFetch when > 0; 1 is typical
+    NegativeTTL       time.Duration // How long GetOrLoad remembers ErrNotFound; 0 disables
+    Codec             Codec         // JSONCodec when nil
+    Compression       Compression   // Algorithm used with EnableCompression; zstd by default
+    CompressThreshold int           // Smaller payloads are stored uncompressed; 1 KiB by default
 }
 
-type CacheItem struct {
-    Data      interface{} `json:"data"`
-    ExpiresAt time.Time   `json:"expires_at"`
-    Version   int         `json:"version"`
-    Tags      []string    `json:"tags,omitempty"`
-}
-
-type CacheStats struct {
-    Hits       int64   `json:"hits"`
-    Misses     int64   `json:"misses"`
-    HitRate    float64 `json:"hit_rate"`
-    Size       int64   `json:"size"`
-    Memory     string  `json:"memory_usage"`
-}
-
-
 // Initialize DefaultCache after Redis is initialized
 func InitCache() error {
     if config.RedisCacheClient == nil {
@@ -60,15 +60,23 @@ var (
     
     // Different cache configurations for different data types
     UserCacheConfig = CacheConfig{
-        TTL:       30 * time.Minute,
-        KeyPrefix: "user",
-        MaxSize:   1000,
+        TTL:         30 * time.Minute,
+        KeyPrefix:   "user",
+        MaxSize:     1000,
+        L1TTL:       30 * time.Second,
+        NegativeTTL: time.Minute,
     }
 
     ProductCacheConfig = CacheConfig{
-        TTL:       1 * time.Hour,
-        KeyPrefix: "product",
-        MaxSize:   10000,
+        TTL:               1 * time.Hour,
+        KeyPrefix:         "product",
+        MaxSize:           10000,
+        L1TTL:             30 * time.Second,
+        SoftTTL:           30 * time.Minute,
+        EarlyRefreshBeta:  1,
+        Codec:             MsgpackCodec,
+        EnableCompression: true,
+        Compression:       CompressionZstd,
     }
 
     SessionCacheConfig = CacheConfig{
@@ -78,9 +86,13 @@ var (
     }
 
     APIResponseCacheConfig = CacheConfig{
-        TTL:       5 * time.Minute,
-        KeyPrefix: "api_response",
-        MaxSize:   10000,
+        TTL:               5 * time.Minute,
+        KeyPrefix:         "api_response",
+        MaxSize:           10000,
+        L1TTL:             10 * time.Second,
+        Codec:             MsgpackCodec,
+        EnableCompression: true,
+        Compression:       CompressionGzip,
     }
 
     DatabaseQueryCacheConfig = CacheConfig{
@@ -96,29 +108,92 @@ func NewCache() *Cache {
     }
 }
 
+// setScript writes an entry and adds it to the reverse index of each tag
+// in one step, so a tag invalidation never misses a freshly written key.
+// Tag sets live at least as long as their longest-lived entry.
+// The invalidation message for L1 copies is published in the same step,
+// and the namespace stats are updated (see stats.go).
+// KEYS: entry, stats hash, sizes hash, expiry set, namespaces set, tag sets...
+// ARGV: value, ttl in ms, key prefix, invalidation channel and message
+// (empty when the config has no L1 tier), raw and stored payload bytes,
+// 1 when compressed, current time in ms
+var setScript = redis.NewScript(statsLua + `
+local ttl = tonumber(ARGV[2])
+local now = tonumber(ARGV[9])
+sweep(ARGV[3], now, ` + strconv.Itoa(writeSweepLimit) + `)
+
+local size = string.len(ARGV[1])
+local old = redis.call('HGET', KEYS[3], KEYS[1])
+if old then
+    redis.call('HINCRBY', KEYS[2], 'bytes', size - tonumber(old))
+else
+    redis.call('HINCRBY', KEYS[2], 'entries', 1)
+    redis.call('HINCRBY', KEYS[2], 'bytes', size)
+end
+redis.call('HSET', KEYS[3], KEYS[1], size)
+redis.call('ZADD', KEYS[4], now + ttl, KEYS[1])
+redis.call('SADD', KEYS[5], ARGV[3])
+redis.call('HINCRBY', KEYS[2], 'sets', 1)
+redis.call('HINCRBY', KEYS[2], 'raw', ARGV[6])
+redis.call('HINCRBY', KEYS[2], 'stored', ARGV[7])
+if ARGV[8] == '1' then
+    redis.call('HINCRBY', KEYS[2], 'compressed_sets', 1)
+end
+
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+if ARGV[5] ~= '' then
+    redis.call('PUBLISH', ARGV[4], ARGV[5])
+end
+for i = 6, #KEYS do
+    redis.call('SADD', KEYS[i], KEYS[1])
+    if redis.call('PTTL', KEYS[i]) < ttl then
+        redis.call('PEXPIRE', KEYS[i], ttl)
+    end
+end
+return 1
+`)
+
 // Generic cache operations
-func (c *Cache) Set(ctx context.Context, key string, value interface{}, config CacheConfig) error {
-    fullKey := fmt.Sprintf("%s:%s", config.KeyPrefix, key)
-    
-    item := CacheItem{
-        Data:      value,
-        ExpiresAt: time.Now().Add(config.TTL),
-        Version:   1,
+
+// Set stores value under key. Tags such as "product:42" register the
+// entry for InvalidateByTag.
+func (c *Cache) Set(ctx context.Context, key string, value interface{}, config CacheConfig, tags ...string) error {
+    env, err := newEnvelope(config, value, 0)
+    if err != nil {
+        return fmt.Errorf("failed to encode cache item: %w", err)
     }
-    
-    data, err := json.Marshal(item)
+    return c.write(ctx, key, config, env, config.TTL, tags)
+}
+
+func (c *Cache) write(ctx context.Context, key string, config CacheConfig, env *envelope, ttl time.Duration, tags []string) error {
+    fullKey, err := c.fullKey(ctx, key, config)
     if err != nil {
-        return fmt.Errorf("failed to marshal cache item: %w", err)
+        return err
     }
 
-    pipe := c.client.Pipeline()
-    pipe.Set(ctx, fullKey, data, config.TTL)
-    
-    // Update cache statistics
-    pipe.Incr(ctx, "cache:stats:sets")
-    pipe.HIncrBy(ctx, "cache:stats:size", config.KeyPrefix, 1)
-    
-    _, err = pipe.Exec(ctx)
+    data, err := env.marshal()
+    if err != nil {
+        return fmt.Errorf("failed to encode cache item: %w", err)
+    }
+    compressed := 0
+    if env.compression != CompressionNone {
+        compressed = 1
+    }
+
+    prefix := config.KeyPrefix
+    keys := []string{fullKey, statsKey(prefix), sizesKey(prefix), expiryKey(prefix), namespacesKey}
+    for _, tag := range tags {
+        keys = append(keys, tagKey(tag))
+    }
+
+    message := ""
+    if local := c.local(config); local != nil {
+        local.remove(fullKey)
+        message = invalidationMessage(invalidation{Keys: []string{fullKey}})
+    }
+
+    err = setScript.Run(ctx, c.client, keys, data, ttl.Milliseconds(), config.KeyPrefix, invalidationChannel, message,
+        len(env.payload), len(data)-envelopeHeaderSize, compressed, time.Now().UnixMilli()).Err()
     if err != nil {
         log.Printf("Cache set error for key %s: %v", fullKey, err)
         return err
@@ -127,138 +202,222 @@ func (c *Cache) Set(ctx context.Context, key string, value interface{}, config C
     return nil
 }
 
+// Get reads key into dest. A negative entry left by GetOrLoad counts as
+// not found.
 func (c *Cache) Get(ctx context.Context, key string, config CacheConfig, dest interface{}) (bool, error) {
-    fullKey := fmt.Sprintf("%s:%s", config.KeyPrefix, key)
-    
-    data, err := c.client.Get(ctx, fullKey).Result()
+    fullKey, err := c.fullKey(ctx, key, config)
     if err != nil {
-        if err == redis.Nil {
-            // Cache miss
-            c.client.Incr(ctx, "cache:stats:misses")
-            return false, nil
-        }
-        return false, fmt.Errorf("cache get error: %w", err)
+        return false, err
     }
 
-    var item CacheItem
-    if err := json.Unmarshal([]byte(data), &item); err != nil {
-        return false, fmt.Errorf("failed to unmarshal cache item: %w", err)
+    env, found, err := c.getItem(ctx, fullKey, config)
+    if err != nil || !found || env.notFound() {
+        return false, err
     }
 
-    // Check if expired (additional safety check)
-    if time.Now().After(item.ExpiresAt) {
-        c.Delete(ctx, key, config)
-        c.client.Incr(ctx, "cache:stats:misses")
-        return false, nil
+    if err := env.decode(dest); err != nil {
+        return false, fmt.Errorf("failed to decode to destination: %w", err)
+    }
+    return true, nil
+}
+
+// getItem reads an entry from the L1 tier or Redis, counting the hit or
+// miss. Entries that cannot be parsed are dropped and count as misses.
+func (c *Cache) getItem(ctx context.Context, fullKey string, config CacheConfig) (*envelope, bool, error) {
+    local := c.local(config)
+    if local != nil {
+        if env, ok := local.get(fullKey); ok {
+            c.localHits.Add(1)
+            return env, true, nil
+        }
     }
 
-    // Unmarshal the actual data
-    itemData, err := json.Marshal(item.Data)
+    data, err := c.client.Get(ctx, fullKey).Bytes()
     if err != nil {
-        return false, fmt.Errorf("failed to marshal item data: %w", err)
+        if err == redis.Nil {
+            // Cache miss
+            c.countHit(ctx, config.KeyPrefix, false)
+            return nil, false, nil
+        }
+        return nil, false, fmt.Errorf("cache get error: %w", err)
     }
 
-    if err := json.Unmarshal(itemData, dest); err != nil {
-        return false, fmt.Errorf("failed to unmarshal to destination: %w", err)
+    env, err := parseEnvelope(data)
+
+    // Also drops entries that outlived their expiry (additional safety check)
+    if err != nil || time.Now().After(env.expiresAt) {
+        deleteScript.Run(ctx, c.client, []string{fullKey}, invalidationChannel, "")
+        c.countHit(ctx, config.KeyPrefix, false)
+        return nil, false, nil
+    }
+
+    if local != nil {
+        local.add(fullKey, env, localTTL(config, env.expiresAt))
     }
 
     // Cache hit
-    c.client.Incr(ctx, "cache:stats:hits")
-    return true, nil
+    c.countHit(ctx, config.KeyPrefix, true)
+    return env, true, nil
 }
 
 func (c *Cache) Delete(ctx context.Context, key string, config CacheConfig) error {
-    fullKey := fmt.Sprintf("%s:%s", config.KeyPrefix, key)
-    
-    pipe := c.client.Pipeline()
-    pipe.Del(ctx, fullKey)
-    pipe.HIncrBy(ctx, "cache:stats:size", config.KeyPrefix, -1)
-    
-    _, err := pipe.Exec(ctx)
-    return err
-}
-
-func (c *Cache) InvalidateByPattern(ctx context.Context, pattern string) error {
-    keys, err := c.client.Keys(ctx, pattern).Result()
+    fullKey, err := c.fullKey(ctx, key, config)
     if err != nil {
         return err
     }
+    
+    message := ""
+    if local := c.local(config); local != nil {
+        local.remove(fullKey)
+        message = invalidationMessage(invalidation{Keys: []string{fullKey}})
+    }
+
+    return deleteScript.Run(ctx, c.client, []string{fullKey}, invalidationChannel, message).Err()
+}
+
+// Keys scanned and unlinked per round trip
+const invalidateBatchSize = 500
+
+// InvalidateProgress reports how far an InvalidateByPattern call got.
+type InvalidateProgress struct {
+    Pattern string
+    Scanned int64
+    Deleted int64
+    Done    bool
+}
 
-    if len(keys) > 0 {
-        return c.client.Del(ctx, keys...).Err()
+// ProgressFunc is called after every batch. Returning an error stops the
+// invalidation.
+type ProgressFunc func(ctx context.Context, progress InvalidateProgress) error
+
+// InvalidateByPattern deletes the keys matching a glob pattern, walking
+// the keyspace with SCAN and unlinking in batches so Redis is never
+// blocked. It stops early when ctx is done. onProgress may be nil. To
+// drop a whole KeyPrefix, InvalidateNamespace is O(1).
+func (c *Cache) InvalidateByPattern(ctx context.Context, pattern string, onProgress ProgressFunc) (int64, error) {
+    progress := InvalidateProgress{Pattern: pattern}
+    var cursor uint64
+    for {
+        if err := ctx.Err(); err != nil {
+            return progress.Deleted, err
+        }
+
+        keys, next, err := c.client.Scan(ctx, cursor, pattern, invalidateBatchSize).Result()
+        if err != nil {
+            return progress.Deleted, err
+        }
+        progress.Scanned += int64(len(keys))
+
+        if len(keys) > 0 {
+            deleted, err := unlinkScript.Run(ctx, c.client, keys, invalidationChannel, invalidationMessage(invalidation{Keys: keys})).Int64()
+            if err != nil {
+                return progress.Deleted, err
+            }
+            progress.Deleted += deleted
+            c.evictLocal(keys...)
+        }
+
+        cursor = next
+        progress.Done = cursor == 0
+        if onProgress != nil {
+            if err := onProgress(ctx, progress); err != nil {
+                return progress.Deleted, err
+            }
+        }
+        if progress.Done {
+            return progress.Deleted, nil
+        }
     }
-    return nil
 }
 
+// invalidateTagScript deletes every entry of a tag together with the tag
+// set, so an entry tagged concurrently is either deleted or stays indexed.
+// It returns the deleted keys, which are also published for L1 eviction.
+// KEYS: tag set; ARGV: invalidation channel, origin
+var invalidateTagScript = redis.NewScript(statsLua + `
+local keys = redis.call('SMEMBERS', KEYS[1])
+for _, key in ipairs(keys) do
+    untrack(key)
+end
+for i = 1, #keys, 500 do
+    redis.call('UNLINK', unpack(keys, i, math.min(i + 499, #keys)))
+end
+redis.call('DEL', KEYS[1])
+if #keys > 0 then
+    redis.call('PUBLISH', ARGV[1], cjson.encode({origin = ARGV[2], keys = keys}))
+end
+return keys
+`)
+
 func (c *Cache) InvalidateByTag(ctx context.Context, tag string) error {
-    tagKey := fmt.Sprintf("tag:%s", tag)
-    keys, err := c.client.SMembers(ctx, tagKey).Result()
+    keys, err := invalidateTagScript.Run(ctx, c.client, []string{tagKey(tag)}, invalidationChannel, instanceID).StringSlice()
     if err != nil {
         return err
     }
+    c.evictLocal(keys...)
+    return nil
+}
 
-    if len(keys) > 0 {
-        pipe := c.client.Pipeline()
-        pipe.Del(ctx, keys...)
-        pipe.Del(ctx, tagKey)
-        _, err = pipe.Exec(ctx)
+// InvalidateByTags drops every entry carrying any of the tags.
+func (c *Cache) InvalidateByTags(ctx context.Context, tags ...string) error {
+    for _, tag := range tags {
+        if err := c.InvalidateByTag(ctx, tag); err != nil {
+            return err
+        }
     }
-    return err
+    return nil
 }
 
-func (c *Cache) GetStats(ctx context.Context) (*CacheStats, error) {
-    pipe := c.client.Pipeline()
-    hitsCmd := pipe.Get(ctx, "cache:stats:hits")
-    missesCmd := pipe.Get(ctx, "cache:stats:misses")
-    sizeCmd := pipe.HLen(ctx, "cache:stats:size")
-    infoCmd := pipe.Info(ctx, "memory")
-    
-    _, err := pipe.Exec(ctx)
-    if err != nil {
-        return nil, err
-    }
+// Keys of entries read through GetOrLoad
+const ProductListKey = "products"
 
-    hits, _ := hitsCmd.Int64()
-    misses, _ := missesCmd.Int64()
-    size, _ := sizeCmd.Result()
-    memInfo, _ := infoCmd.Result()
+func UserKey(userID int) string {
+    return fmt.Sprintf("id:%d", userID)
+}
 
-    var hitRate float64
-    if hits+misses > 0 {
-        hitRate = float64(hits) / float64(hits+misses)
-    }
+// High-level cache functions for specific use cases
+func CacheUser(ctx context.Context, userID int, user interface{}) error {
+    return DefaultCache.Set(ctx, UserKey(userID), user, UserCacheConfig)
+}
 
-    // Extract memory usage from INFO command
-    memoryUsage := extractMemoryUsage(memInfo)
+// InvalidateUser drops a cached user after their account changes.
+func InvalidateUser(ctx context.Context, userID int) error {
+    return DefaultCache.Delete(ctx, UserKey(userID), UserCacheConfig)
+}
 
-    return &CacheStats{
-        Hits:    hits,
-        Misses:  misses,
-        HitRate: hitRate,
-        Size:    size,
-        Memory:  memoryUsage,
-    }, nil
+// CacheProducts stores the product list. Pass ProductTag for every listed
+// product so an update to any of them drops the list.
+func CacheProducts(ctx context.Context, products interface{}, tags ...string) error {
+    return DefaultCache.Set(ctx, ProductListKey, products, ProductCacheConfig, tags...)
 }
 
-// High-level cache functions for specific use cases
-func CacheUser(ctx context.Context, userID int, user interface{}) error {
-    key := fmt.Sprintf("id:%d", userID)
-    return DefaultCache.Set(ctx, key, user, UserCacheConfig)
+func InvalidateProducts(ctx context.Context) error {
+    return DefaultCache.Delete(ctx, ProductListKey, ProductCacheConfig)
 }
 
-func CacheProducts(ctx context.Context, products interface{}) error {
-    key := "products"
-    return DefaultCache.Set(ctx, key, products, ProductCacheConfig)
+// OnProductUpdated subscribes to product.updated: product responses embed
+// prices and ratings, so every cached list and API response tagged with
+// the product is dropped.
+func OnProductUpdated(ctx context.Context, event events.Event) error {
+    var payload struct {
+        ProductID int `json:"product_id"`
+    }
+    if err := event.Decode(&payload); err != nil {
+        return err
+    }
+
+    if payload.ProductID == 0 {
+        return DefaultCache.InvalidateByTag(ctx, ProductListTag)
+    }
+    return DefaultCache.InvalidateByTag(ctx, ProductTag(payload.ProductID))
 }
 
 func GetCachedUser(ctx context.Context, userID int, dest interface{}) (bool, error) {
-    key := fmt.Sprintf("id:%d", userID)
-    return DefaultCache.Get(ctx, key, UserCacheConfig, dest)
+    return DefaultCache.Get(ctx, UserKey(userID), UserCacheConfig, dest)
 }
 
 func GetCachedProducts(ctx context.Context, dest interface{}) (bool, error) {
-    key := "products"
-    return DefaultCache.Get(ctx, key, ProductCacheConfig, dest)
+    return DefaultCache.Get(ctx, ProductListKey, ProductCacheConfig, dest)
 }
 
 func CacheSession(ctx context.Context, sessionID int, session interface{}) error {
@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes cache payloads. Its ID is stored with every entry, so
+// entries stay readable after a config switches codecs.
+type Codec interface {
+    ID() byte
+    Marshal(v interface{}) ([]byte, error)
+    Unmarshal(data []byte, v interface{}) error
+}
+
+// Built-in codec IDs; custom codecs registered with RegisterCodec should
+// use IDs from 16 up
+const (
+    jsonCodecID    byte = 1
+    msgpackCodecID byte = 2
+    gobCodecID     byte = 3
+)
+
+var (
+    JSONCodec    Codec = jsonCodec{}
+    MsgpackCodec Codec = msgpackCodec{}
+    GobCodec     Codec = gobCodec{}
+)
+
+var (
+    codecsMu sync.RWMutex
+    codecs   = map[byte]Codec{
+        jsonCodecID:    JSONCodec,
+        msgpackCodecID: MsgpackCodec,
+        gobCodecID:     GobCodec,
+    }
+)
+
+// RegisterCodec makes a custom codec available for reading entries. A
+// config selects it through CacheConfig.Codec.
+func RegisterCodec(codec Codec) {
+    codecsMu.Lock()
+    defer codecsMu.Unlock()
+    codecs[codec.ID()] = codec
+}
+
+func codecByID(id byte) (Codec, error) {
+    codecsMu.RLock()
+    defer codecsMu.RUnlock()
+    codec, ok := codecs[id]
+    if !ok {
+        return nil, fmt.Errorf("unknown cache codec %d", id)
+    }
+    return codec, nil
+}
+
+// codecFor returns the codec of a config, JSON by default.
+func codecFor(config CacheConfig) Codec {
+    if config.Codec == nil {
+        return JSONCodec
+    }
+    return config.Codec
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ID() byte { return jsonCodecID }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+    return json.Unmarshal(data, v)
+}
+
+// msgpackCodec reads the json struct tags, so fields are named and
+// omitted the same way as with JSONCodec. Custom JSON marshalers are not
+// used.
+type msgpackCodec struct{}
+
+func (msgpackCodec) ID() byte { return msgpackCodecID }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    enc := msgpack.NewEncoder(&buf)
+    enc.SetCustomStructTag("json")
+    if err := enc.Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+    dec := msgpack.NewDecoder(bytes.NewReader(data))
+    dec.SetCustomStructTag("json")
+    return dec.Decode(v)
+}
+
+// gobCodec only encodes exported fields and needs concrete types; values
+// holding interfaces must have them registered with gob.Register.
+type gobCodec struct{}
+
+func (gobCodec) ID() byte { return gobCodecID }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+    var buf bytes.Buffer
+    if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+    return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
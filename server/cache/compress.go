@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression selects how a config with EnableCompression compresses
+// payloads. The choice is stored in every entry's header, so entries
+// written with another algorithm stay readable.
+type Compression byte
+
+const (
+    CompressionNone Compression = 0
+    CompressionGzip Compression = 1
+    CompressionZstd Compression = 2
+)
+
+// Payloads smaller than this are stored as is unless the config sets
+// CompressThreshold; compressing them saves little and costs CPU
+const defaultCompressThreshold = 1024
+
+// Both are safe for concurrent use through EncodeAll and DecodeAll
+var (
+    zstdEncoder, _ = zstd.NewWriter(nil)
+    zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+)
+
+// compressionFor returns the algorithm for a payload of size bytes.
+func compressionFor(config CacheConfig, size int) Compression {
+    if !config.EnableCompression {
+        return CompressionNone
+    }
+    threshold := config.CompressThreshold
+    if threshold <= 0 {
+        threshold = defaultCompressThreshold
+    }
+    if size < threshold {
+        return CompressionNone
+    }
+    if config.Compression == CompressionNone {
+        return CompressionZstd
+    }
+    return config.Compression
+}
+
+func compress(c Compression, data []byte) ([]byte, error) {
+    switch c {
+    case CompressionNone:
+        return data, nil
+    case CompressionZstd:
+        return zstdEncoder.EncodeAll(data, nil), nil
+    case CompressionGzip:
+        var buf bytes.Buffer
+        w := gzip.NewWriter(&buf)
+        if _, err := w.Write(data); err != nil {
+            return nil, err
+        }
+        if err := w.Close(); err != nil {
+            return nil, err
+        }
+        return buf.Bytes(), nil
+    }
+    return nil, fmt.Errorf("unknown cache compression %d", c)
+}
+
+func decompress(c Compression, data []byte) ([]byte, error) {
+    switch c {
+    case CompressionNone:
+        return data, nil
+    case CompressionZstd:
+        return zstdDecoder.DecodeAll(data, nil)
+    case CompressionGzip:
+        r, err := gzip.NewReader(bytes.NewReader(data))
+        if err != nil {
+            return nil, err
+        }
+        defer r.Close()
+        return io.ReadAll(r)
+    }
+    return nil, fmt.Errorf("unknown cache compression %d", c)
+}
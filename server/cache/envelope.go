@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Entries are stored as a fixed header followed by the encoded payload:
+//
+//	version(1) codec(1) compression(1) flags(1) expires_at(8) stale_at(8) load_ms(4) payload
+//
+// Times are Unix milliseconds; a zero stale_at means no soft expiry. The
+// payload is compressed with the algorithm named in the header.
+const (
+    envelopeVersion    byte = 2
+    envelopeHeaderSize      = 24
+)
+
+const flagNotFound byte = 1 << 0 // Negative entry: the loader found nothing
+
+var errInvalidEnvelope = errors.New("invalid cache entry")
+
+// An envelope always holds its payload uncompressed; marshal compresses
+// and parseEnvelope decompresses, so L1 hits pay no decompression.
+type envelope struct {
+    codec       byte
+    compression Compression
+    flags       byte
+    expiresAt time.Time
+    staleAt   time.Time
+    loadTime  time.Duration
+    payload   []byte
+}
+
+// newEnvelope encodes value with the config's codec.
+func newEnvelope(config CacheConfig, value interface{}, loadTime time.Duration) (*envelope, error) {
+    codec := codecFor(config)
+    payload, err := codec.Marshal(value)
+    if err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    env := &envelope{
+        codec:       codec.ID(),
+        compression: compressionFor(config, len(payload)),
+        expiresAt:   now.Add(config.TTL),
+        loadTime:    loadTime,
+        payload:     payload,
+    }
+    if config.SoftTTL > 0 {
+        env.staleAt = now.Add(config.SoftTTL)
+    }
+    return env, nil
+}
+
+// notFoundEnvelope records that the loader found nothing.
+func notFoundEnvelope(config CacheConfig) *envelope {
+    return &envelope{
+        codec:     codecFor(config).ID(),
+        flags:     flagNotFound,
+        expiresAt: time.Now().Add(config.NegativeTTL),
+    }
+}
+
+func (e *envelope) notFound() bool {
+    return e.flags&flagNotFound != 0
+}
+
+func (e *envelope) decode(dest interface{}) error {
+    codec, err := codecByID(e.codec)
+    if err != nil {
+        return err
+    }
+    return codec.Unmarshal(e.payload, dest)
+}
+
+func (e *envelope) marshal() ([]byte, error) {
+    payload, err := compress(e.compression, e.payload)
+    if err != nil {
+        return nil, err
+    }
+
+    buf := make([]byte, envelopeHeaderSize, envelopeHeaderSize+len(payload))
+    buf[0] = envelopeVersion
+    buf[1] = e.codec
+    buf[2] = byte(e.compression)
+    buf[3] = e.flags
+    binary.BigEndian.PutUint64(buf[4:12], uint64(e.expiresAt.UnixMilli()))
+    if !e.staleAt.IsZero() {
+        binary.BigEndian.PutUint64(buf[12:20], uint64(e.staleAt.UnixMilli()))
+    }
+    binary.BigEndian.PutUint32(buf[20:24], uint32(min(e.loadTime.Milliseconds(), math.MaxUint32)))
+    return append(buf, payload...), nil
+}
+
+// parseEnvelope decodes a stored entry. Entries written in an older
+// format are rejected and treated as misses.
+func parseEnvelope(data []byte) (*envelope, error) {
+    if len(data) < envelopeHeaderSize || data[0] != envelopeVersion {
+        return nil, errInvalidEnvelope
+    }
+
+    env := &envelope{
+        codec:       data[1],
+        compression: Compression(data[2]),
+        flags:       data[3],
+        expiresAt:   time.UnixMilli(int64(binary.BigEndian.Uint64(data[4:12]))),
+        loadTime:    time.Duration(binary.BigEndian.Uint32(data[20:24])) * time.Millisecond,
+    }
+    if staleAt := int64(binary.BigEndian.Uint64(data[12:20])); staleAt != 0 {
+        env.staleAt = time.UnixMilli(staleAt)
+    }
+
+    payload, err := decompress(env.compression, data[envelopeHeaderSize:])
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", errInvalidEnvelope, err)
+    }
+    env.payload = payload
+    return env, nil
+}
+
+// shouldRefresh reports whether a hit is due for a background refresh:
+// past its soft expiry or, with EarlyRefreshBeta, at random before it,
+// more likely the closer expiry is and the slower the value was to load
+// (XFetch).
+func (e *envelope) shouldRefresh(config CacheConfig, now time.Time) bool {
+    expiry := e.expiresAt
+    if !e.staleAt.IsZero() {
+        expiry = e.staleAt
+    }
+
+    if config.EarlyRefreshBeta > 0 && e.loadTime > 0 {
+        gap := float64(e.loadTime) * config.EarlyRefreshBeta * -math.Log(1-rand.Float64())
+        now = now.Add(time.Duration(gap))
+    }
+    return !now.Before(expiry)
+}
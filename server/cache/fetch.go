@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Loader produces the value for GetOrLoad on a cache miss. Returning
+// ErrNotFound caches the absence for CacheConfig.NegativeTTL.
+type Loader func(ctx context.Context) (interface{}, error)
+
+// ErrNotFound is returned by loaders that found nothing and by GetOrLoad
+// for entries that remember it.
+var ErrNotFound = errors.New("cache: not found")
+
+const (
+    // A load holding the lock longer than this lets another instance take over
+    loadLockTTL = 10 * time.Second
+
+    // How long a miss waits for another instance's load before loading itself
+    loadWaitTimeout  = 3 * time.Second
+    loadPollInterval = 50 * time.Millisecond
+)
+
+var errLoadInProgress = errors.New("cache load in progress on another instance")
+
+// releaseLockScript deletes a load lock only if this caller still holds it.
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// GetOrLoad reads key, calling loader on a miss and caching its result
+// with the config's codec. Concurrent misses share one load per instance,
+// and a Redis lock lets a single instance load while the others wait for
+// its result. A hit past config.SoftTTL, or picked for early refresh by
+// XFetch, is returned as is while one request reloads it in the
+// background. The loader can tag the entry with TagResponse.
+func GetOrLoad[T any](ctx context.Context, key string, cfg CacheConfig, loader func(ctx context.Context) (T, error)) (T, error) {
+    var value T
+    env, err := DefaultCache.fetch(ctx, key, cfg, func(ctx context.Context) (interface{}, error) {
+        return loader(ctx)
+    })
+    if err != nil {
+        return value, err
+    }
+    if env.notFound() {
+        return value, ErrNotFound
+    }
+    if err := env.decode(&value); err != nil {
+        return value, fmt.Errorf("failed to decode cache item: %w", err)
+    }
+    return value, nil
+}
+
+func (c *Cache) fetch(ctx context.Context, key string, config CacheConfig, load Loader) (*envelope, error) {
+    fullKey, err := c.fullKey(ctx, key, config)
+    if err != nil {
+        // Redis is unavailable; serve straight from the source
+        log.Printf("Cache fetch error for key %s: %v", key, err)
+        return c.runLoader(ctx, config, load)
+    }
+
+    env, found, err := c.getItem(ctx, fullKey, config)
+    if err != nil {
+        log.Printf("Cache fetch error for key %s: %v", fullKey, err)
+    }
+    if found {
+        if env.shouldRefresh(config, time.Now()) {
+            c.refreshAsync(key, fullKey, config, load)
+        }
+        return env, nil
+    }
+
+    // Waiters must not fail because the first caller's request ended
+    result, err, _ := c.flight.Do(fullKey, func() (interface{}, error) {
+        return c.load(context.WithoutCancel(ctx), key, fullKey, config, load, true)
+    })
+    if err != nil {
+        return nil, err
+    }
+    return result.(*envelope), nil
+}
+
+func (c *Cache) refreshAsync(key, fullKey string, config CacheConfig, load Loader) {
+    if _, running := c.refreshing.LoadOrStore(fullKey, true); running {
+        return
+    }
+
+    go func() {
+        defer c.refreshing.Delete(fullKey)
+
+        ctx, cancel := context.WithTimeout(context.Background(), loadLockTTL)
+        defer cancel()
+        if _, err := c.load(ctx, key, fullKey, config, load, false); err != nil && !errors.Is(err, errLoadInProgress) {
+            log.Printf("Cache refresh error for key %s: %v", fullKey, err)
+        }
+    }()
+}
+
+// load runs the loader under the key's Redis lock and caches the result.
+// When another instance holds the lock, a waiting caller polls for that
+// instance's result and loads itself only if none arrives in time; a
+// background refresh gives up with errLoadInProgress. Without Redis the
+// loader simply runs.
+func (c *Cache) load(ctx context.Context, key, fullKey string, config CacheConfig, load Loader, wait bool) (*envelope, error) {
+    lockKey := "lock:" + fullKey
+    token := randomID()
+    locked, err := c.client.SetNX(ctx, lockKey, token, loadLockTTL).Result()
+    if err != nil {
+        log.Printf("Cache lock error for key %s: %v", fullKey, err)
+    }
+    if err == nil && !locked {
+        if !wait {
+            return nil, errLoadInProgress
+        }
+        if env, ok := c.waitForLoad(ctx, fullKey); ok {
+            return env, nil
+        }
+    }
+    if locked {
+        defer releaseLockScript.Run(ctx, c.client, []string{lockKey}, token)
+    }
+
+    loadCtx, collectedTags := WithTagCollector(ctx)
+    env, err := c.runLoader(loadCtx, config, load)
+    if err != nil {
+        return nil, err
+    }
+
+    // A failed write is logged by write; the loaded value is still served
+    ttl := config.TTL
+    if env.notFound() {
+        ttl = config.NegativeTTL
+    }
+    c.write(ctx, key, config, env, ttl, collectedTags())
+    return env, nil
+}
+
+// runLoader calls load and encodes its result. ErrNotFound becomes a
+// negative entry when the config caches those.
+func (c *Cache) runLoader(ctx context.Context, config CacheConfig, load Loader) (*envelope, error) {
+    start := time.Now()
+    value, err := load(ctx)
+    if errors.Is(err, ErrNotFound) && config.NegativeTTL > 0 {
+        return notFoundEnvelope(config), nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return newEnvelope(config, value, time.Since(start))
+}
+
+// waitForLoad polls for the value another instance is loading.
+func (c *Cache) waitForLoad(ctx context.Context, fullKey string) (*envelope, bool) {
+    deadline := time.NewTimer(loadWaitTimeout)
+    defer deadline.Stop()
+    ticker := time.NewTicker(loadPollInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return nil, false
+        case <-deadline.C:
+            return nil, false
+        case <-ticker.C:
+        }
+
+        data, err := c.client.Get(ctx, fullKey).Bytes()
+        if err == redis.Nil {
+            continue
+        }
+        if err != nil {
+            return nil, false
+        }
+
+        env, err := parseEnvelope(data)
+        if err != nil {
+            return nil, false
+        }
+        return env, true
+    }
+}
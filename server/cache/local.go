@@ -0,0 +1,198 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The optional L1 tier: a small in-process LRU per CacheConfig in front of
+// Redis, enabled by L1TTL and bounded by MaxSize entries. It holds the
+// encoded entry, so callers never share decoded values. Every write or
+// delete of a Redis entry is announced on invalidationChannel and evicts
+// the L1 copy on every instance; the short TTL bounds staleness if a
+// message is lost while reconnecting.
+
+const invalidationChannel = "cache:invalidate"
+
+// instanceID tells this process's own invalidation messages apart.
+var instanceID = randomID()
+
+func randomID() string {
+    buf := make([]byte, 8)
+    rand.Read(buf)
+    return hex.EncodeToString(buf)
+}
+
+type localCache struct {
+    mu      sync.Mutex
+    maxSize int
+    order   *list.List // Front is most recently used
+    entries map[string]*list.Element
+}
+
+type localEntry struct {
+    key       string
+    env       *envelope
+    expiresAt time.Time
+}
+
+func newLocalCache(maxSize int) *localCache {
+    return &localCache{
+        maxSize: maxSize,
+        order:   list.New(),
+        entries: make(map[string]*list.Element),
+    }
+}
+
+func (l *localCache) get(key string) (*envelope, bool) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    elem, ok := l.entries[key]
+    if !ok {
+        return nil, false
+    }
+    entry := elem.Value.(*localEntry)
+    if time.Now().After(entry.expiresAt) {
+        l.order.Remove(elem)
+        delete(l.entries, key)
+        return nil, false
+    }
+    l.order.MoveToFront(elem)
+    return entry.env, true
+}
+
+func (l *localCache) add(key string, env *envelope, ttl time.Duration) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    entry := &localEntry{key: key, env: env, expiresAt: time.Now().Add(ttl)}
+    if elem, ok := l.entries[key]; ok {
+        elem.Value = entry
+        l.order.MoveToFront(elem)
+        return
+    }
+
+    l.entries[key] = l.order.PushFront(entry)
+    for l.order.Len() > l.maxSize {
+        oldest := l.order.Back()
+        l.order.Remove(oldest)
+        delete(l.entries, oldest.Value.(*localEntry).key)
+    }
+}
+
+func (l *localCache) remove(keys ...string) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    for _, key := range keys {
+        if elem, ok := l.entries[key]; ok {
+            l.order.Remove(elem)
+            delete(l.entries, key)
+        }
+    }
+}
+
+func (l *localCache) purge() {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+
+    l.order.Init()
+    l.entries = make(map[string]*list.Element)
+}
+
+func (l *localCache) len() int {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    return l.order.Len()
+}
+
+// local returns the L1 tier of config, or nil when it has none.
+func (c *Cache) local(config CacheConfig) *localCache {
+    if config.L1TTL <= 0 || config.MaxSize <= 0 {
+        return nil
+    }
+    if l, ok := c.locals.Load(config.KeyPrefix); ok {
+        return l.(*localCache)
+    }
+    l, _ := c.locals.LoadOrStore(config.KeyPrefix, newLocalCache(int(config.MaxSize)))
+    return l.(*localCache)
+}
+
+// localTTL keeps an L1 copy from outliving its Redis entry.
+func localTTL(config CacheConfig, expiresAt time.Time) time.Duration {
+    ttl := time.Until(expiresAt)
+    if config.L1TTL < ttl {
+        ttl = config.L1TTL
+    }
+    return ttl
+}
+
+// invalidation is the message published when Redis entries change. Keys
+// are full keys; Prefix announces a namespace generation bump.
+type invalidation struct {
+    Origin string   `json:"origin"`
+    Keys   []string `json:"keys,omitempty"`
+    Prefix string   `json:"prefix,omitempty"`
+}
+
+func invalidationMessage(msg invalidation) string {
+    msg.Origin = instanceID
+    data, _ := json.Marshal(msg)
+    return string(data)
+}
+
+// evictLocal drops full keys from the L1 tier of their prefix.
+func (c *Cache) evictLocal(keys ...string) {
+    for _, key := range keys {
+        prefix, _, _ := strings.Cut(key, ":")
+        if l, ok := c.locals.Load(prefix); ok {
+            l.(*localCache).remove(key)
+        }
+    }
+}
+
+// StartInvalidationListener evicts L1 entries that other instances
+// rewrite or delete, until ctx is cancelled.
+func (c *Cache) StartInvalidationListener(ctx context.Context) {
+    pubsub := c.client.Subscribe(ctx, invalidationChannel)
+    go func() {
+        defer pubsub.Close()
+
+        messages := pubsub.Channel()
+        for {
+            select {
+            case <-ctx.Done():
+                return
+            case message, ok := <-messages:
+                if !ok {
+                    return
+                }
+
+                var msg invalidation
+                if err := json.Unmarshal([]byte(message.Payload), &msg); err != nil {
+                    log.Printf("Invalid cache invalidation message: %v", err)
+                    continue
+                }
+                if msg.Origin == instanceID {
+                    continue
+                }
+
+                c.evictLocal(msg.Keys...)
+                if msg.Prefix != "" {
+                    c.generations.Delete(msg.Prefix)
+                    if l, ok := c.locals.Load(msg.Prefix); ok {
+                        l.(*localCache).purge()
+                    }
+                }
+            }
+        }
+    }()
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Entries are stored as "<KeyPrefix>:v<generation>:<key>". Bumping the
+// generation of a prefix orphans all of its entries at once; they are
+// never read again and expire with their TTL.
+
+// How long an instance trusts its copy of a generation. Another instance
+// that misses the invalidation message may serve entries of the previous
+// generation for up to this long after InvalidateNamespace.
+const generationRefresh = time.Second
+
+type cachedGeneration struct {
+    value     int64
+    fetchedAt time.Time
+}
+
+func generationKey(prefix string) string {
+    return "cache:gen:" + prefix
+}
+
+// fullKey namespaces key with the prefix and its current generation.
+func (c *Cache) fullKey(ctx context.Context, key string, config CacheConfig) (string, error) {
+    generation, err := c.generation(ctx, config.KeyPrefix)
+    if err != nil {
+        return "", err
+    }
+    return fmt.Sprintf("%s:v%d:%s", config.KeyPrefix, generation, key), nil
+}
+
+func (c *Cache) generation(ctx context.Context, prefix string) (int64, error) {
+    if cached, ok := c.generations.Load(prefix); ok {
+        if g := cached.(cachedGeneration); time.Since(g.fetchedAt) < generationRefresh {
+            return g.value, nil
+        }
+    }
+
+    value, err := c.client.Get(ctx, generationKey(prefix)).Int64()
+    if err != nil && err != redis.Nil {
+        return 0, fmt.Errorf("cache generation error: %w", err)
+    }
+    c.generations.Store(prefix, cachedGeneration{value: value, fetchedAt: time.Now()})
+    return value, nil
+}
+
+// invalidateNamespaceScript bumps a generation and counts every live
+// entry of the prefix as evicted.
+// KEYS: generation, stats hash, sizes hash, expiry set
+// ARGV: invalidation channel, message
+var invalidateNamespaceScript = redis.NewScript(`
+local generation = redis.call('INCR', KEYS[1])
+local entries = tonumber(redis.call('HGET', KEYS[2], 'entries') or '0')
+redis.call('HINCRBY', KEYS[2], 'evictions', entries)
+redis.call('HSET', KEYS[2], 'entries', 0, 'bytes', 0)
+redis.call('UNLINK', KEYS[3], KEYS[4])
+redis.call('PUBLISH', ARGV[1], ARGV[2])
+return generation
+`)
+
+// InvalidateNamespace drops every entry of config.KeyPrefix in O(1) by
+// bumping its generation.
+func (c *Cache) InvalidateNamespace(ctx context.Context, config CacheConfig) error {
+    prefix := config.KeyPrefix
+    generation, err := invalidateNamespaceScript.Run(ctx, c.client,
+        []string{generationKey(prefix), statsKey(prefix), sizesKey(prefix), expiryKey(prefix)},
+        invalidationChannel, invalidationMessage(invalidation{Prefix: prefix}),
+    ).Int64()
+    if err != nil {
+        return err
+    }
+
+    c.generations.Store(prefix, cachedGeneration{value: generation, fetchedAt: time.Now()})
+    if l, ok := c.locals.Load(prefix); ok {
+        l.(*localCache).purge()
+    }
+    return nil
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stats are kept per KeyPrefix in three keys:
+//
+//	cache:stats:ns:<prefix>         hash of counters and gauges
+//	cache:stats:ns:<prefix>:sizes   hash of full key -> stored bytes
+//	cache:stats:ns:<prefix>:expiry  sorted set of full keys by expiry (ms)
+//
+// Writes and deletes adjust entries and bytes from the sizes hash, so an
+// overwrite does not count as a new entry. Redis does not report TTL
+// expiry to scripts, so expired entries are found through the expiry set:
+// every write sweeps a few, and GetStats sweeps the rest. The figures are
+// approximate: entries evicted by Redis under maxmemory are only noticed
+// once their TTL has passed.
+
+// Set of every prefix that has been written
+const namespacesKey = "cache:stats:namespaces"
+
+// Expired entries swept per write, and per round trip in GetStats
+const (
+    writeSweepLimit = 10
+    statsSweepLimit = 1000
+)
+
+var ErrUnknownNamespace = errors.New("unknown cache namespace")
+
+func statsKey(prefix string) string {
+    return "cache:stats:ns:" + prefix
+}
+
+func sizesKey(prefix string) string {
+    return statsKey(prefix) + ":sizes"
+}
+
+func expiryKey(prefix string) string {
+    return statsKey(prefix) + ":expiry"
+}
+
+// statsLua defines the Lua helpers shared by the scripts that write or
+// delete entries. untrack removes a deleted entry from its prefix's stats;
+// sweep does the same for entries whose expiry has passed.
+const statsLua = `
+local function nsKey(prefix)
+    return 'cache:stats:ns:' .. prefix
+end
+
+local function forget(prefix, keys)
+    local stats = nsKey(prefix)
+    local sizes = stats .. ':sizes'
+    local tracked, bytes = 0, 0
+    for _, key in ipairs(keys) do
+        local size = redis.call('HGET', sizes, key)
+        if size then
+            tracked = tracked + 1
+            bytes = bytes + tonumber(size)
+        end
+    end
+    if tracked > 0 then
+        redis.call('HDEL', sizes, unpack(keys))
+        redis.call('ZREM', stats .. ':expiry', unpack(keys))
+        redis.call('HINCRBY', stats, 'entries', -tracked)
+        redis.call('HINCRBY', stats, 'bytes', -bytes)
+        redis.call('HINCRBY', stats, 'evictions', tracked)
+    end
+    return tracked
+end
+
+local function untrack(key)
+    local prefix = string.match(key, '^(.-):v%d+:')
+    if prefix then
+        forget(prefix, {key})
+    end
+end
+
+local function sweep(prefix, now, limit)
+    local expired = redis.call('ZRANGEBYSCORE', nsKey(prefix) .. ':expiry', '-inf', now, 'LIMIT', 0, limit)
+    if #expired > 0 then
+        forget(prefix, expired)
+    end
+    return #expired
+end
+`
+
+// sweepScript removes up to ARGV[3] expired entries of prefix ARGV[1] at
+// time ARGV[2] (ms) from the stats and returns how many it removed.
+var sweepScript = redis.NewScript(statsLua + `
+return sweep(ARGV[1], ARGV[2], tonumber(ARGV[3]))
+`)
+
+// deleteScript deletes an entry, updating its stats and publishing the
+// deletion when ARGV[2] holds a message for channel ARGV[1].
+var deleteScript = redis.NewScript(statsLua + `
+untrack(KEYS[1])
+local deleted = redis.call('UNLINK', KEYS[1])
+if ARGV[2] ~= '' then
+    redis.call('PUBLISH', ARGV[1], ARGV[2])
+end
+return deleted
+`)
+
+// unlinkScript deletes a batch of keys, updating the stats of those that
+// are cache entries, and publishes them for L1 eviction.
+// ARGV: invalidation channel, message
+var unlinkScript = redis.NewScript(statsLua + `
+for _, key in ipairs(KEYS) do
+    untrack(key)
+end
+local deleted = redis.call('UNLINK', unpack(KEYS))
+redis.call('PUBLISH', ARGV[1], ARGV[2])
+return deleted
+`)
+
+// NamespaceStats are the stats of one KeyPrefix. Hits, misses, sets and
+// evictions count since the stats were created; entries and bytes are
+// the live entries of the current generation.
+type NamespaceStats struct {
+    Namespace string  `json:"namespace"`
+    Hits      int64   `json:"hits"`
+    Misses    int64   `json:"misses"`
+    HitRate   float64 `json:"hit_rate"`
+    Sets      int64   `json:"sets"`
+    Evictions int64   `json:"evictions"` // Deleted, invalidated or expired
+    Entries   int64   `json:"entries"`
+    Bytes     int64   `json:"bytes"` // Stored size of the live entries
+
+    // Payload bytes written, before and after compression
+    RawBytes       int64 `json:"raw_bytes"`
+    StoredBytes    int64 `json:"stored_bytes"`
+    CompressedSets int64 `json:"compressed_sets"`
+}
+
+type CacheStats struct {
+    Hits      int64   `json:"hits"`
+    Misses    int64   `json:"misses"`
+    HitRate   float64 `json:"hit_rate"`
+    Sets      int64   `json:"sets"`
+    Evictions int64   `json:"evictions"`
+    Size      int64   `json:"size"` // Live entries
+    Bytes     int64   `json:"bytes"`
+    Memory    string  `json:"memory_usage"`
+    L1Hits    int64   `json:"l1_hits"`    // This instance only; not included in Hits
+    L1Entries int     `json:"l1_entries"` // This instance only
+
+    // Payload bytes written, before and after compression;
+    // StoredBytes / RawBytes is the compression ratio
+    RawBytes         int64   `json:"raw_bytes"`
+    StoredBytes      int64   `json:"stored_bytes"`
+    CompressionRatio float64 `json:"compression_ratio"`
+    CompressedSets   int64   `json:"compressed_sets"`
+
+    Namespaces []NamespaceStats `json:"namespaces"`
+}
+
+// Configs returns the built-in cache configs, one per namespace.
+func Configs() []CacheConfig {
+    return []CacheConfig{
+        UserCacheConfig,
+        ProductCacheConfig,
+        SessionCacheConfig,
+        APIResponseCacheConfig,
+        DatabaseQueryCacheConfig,
+    }
+}
+
+func configByPrefix(prefix string) (CacheConfig, bool) {
+    for _, config := range Configs() {
+        if config.KeyPrefix == prefix {
+            return config, true
+        }
+    }
+    return CacheConfig{}, false
+}
+
+// FlushNamespace drops every entry of a built-in namespace.
+func (c *Cache) FlushNamespace(ctx context.Context, prefix string) error {
+    config, ok := configByPrefix(prefix)
+    if !ok {
+        return ErrUnknownNamespace
+    }
+    return c.InvalidateNamespace(ctx, config)
+}
+
+// countHit records a hit or miss for a prefix.
+func (c *Cache) countHit(ctx context.Context, prefix string, hit bool) {
+    field := "misses"
+    if hit {
+        field = "hits"
+    }
+    c.client.HIncrBy(ctx, statsKey(prefix), field, 1)
+}
+
+// GetStats sweeps expired entries from the stats, then reports every
+// namespace that has been written or is built in.
+func (c *Cache) GetStats(ctx context.Context) (*CacheStats, error) {
+    prefixes, err := c.client.SMembers(ctx, namespacesKey).Result()
+    if err != nil {
+        return nil, err
+    }
+    for _, config := range Configs() {
+        prefixes = append(prefixes, config.KeyPrefix)
+    }
+
+    now := time.Now().UnixMilli()
+    seen := make(map[string]bool)
+    pipe := c.client.Pipeline()
+    var names []string
+    var cmds []*redis.MapStringStringCmd
+    for _, prefix := range prefixes {
+        if seen[prefix] {
+            continue
+        }
+        seen[prefix] = true
+
+        for {
+            swept, err := sweepScript.Run(ctx, c.client, []string{statsKey(prefix), sizesKey(prefix), expiryKey(prefix)}, prefix, now, statsSweepLimit).Int()
+            if err != nil {
+                return nil, err
+            }
+            if swept < statsSweepLimit {
+                break
+            }
+        }
+        names = append(names, prefix)
+        cmds = append(cmds, pipe.HGetAll(ctx, statsKey(prefix)))
+    }
+    infoCmd := pipe.Info(ctx, "memory")
+    if _, err := pipe.Exec(ctx); err != nil {
+        return nil, err
+    }
+
+    memInfo, _ := infoCmd.Result()
+    stats := &CacheStats{
+        // Extract memory usage from INFO command
+        Memory:     extractMemoryUsage(memInfo),
+        L1Hits:     c.localHits.Load(),
+        Namespaces: make([]NamespaceStats, 0, len(names)),
+    }
+    for i, name := range names {
+        fields := cmds[i].Val()
+        ns := NamespaceStats{Namespace: name}
+        for field, dest := range map[string]*int64{
+            "hits":            &ns.Hits,
+            "misses":          &ns.Misses,
+            "sets":            &ns.Sets,
+            "evictions":       &ns.Evictions,
+            "entries":         &ns.Entries,
+            "bytes":           &ns.Bytes,
+            "raw":             &ns.RawBytes,
+            "stored":          &ns.StoredBytes,
+            "compressed_sets": &ns.CompressedSets,
+        } {
+            *dest, _ = strconv.ParseInt(fields[field], 10, 64)
+        }
+        ns.HitRate = hitRate(ns.Hits, ns.Misses)
+        stats.Namespaces = append(stats.Namespaces, ns)
+
+        stats.Hits += ns.Hits
+        stats.Misses += ns.Misses
+        stats.Sets += ns.Sets
+        stats.Evictions += ns.Evictions
+        stats.Size += ns.Entries
+        stats.Bytes += ns.Bytes
+        stats.RawBytes += ns.RawBytes
+        stats.StoredBytes += ns.StoredBytes
+        stats.CompressedSets += ns.CompressedSets
+    }
+    stats.HitRate = hitRate(stats.Hits, stats.Misses)
+    if stats.RawBytes > 0 {
+        stats.CompressionRatio = float64(stats.StoredBytes) / float64(stats.RawBytes)
+    }
+
+    c.locals.Range(func(_, l interface{}) bool {
+        stats.L1Entries += l.(*localCache).len()
+        return true
+    })
+    return stats, nil
+}
+
+func hitRate(hits, misses int64) float64 {
+    if hits+misses == 0 {
+        return 0
+    }
+    return float64(hits) / float64(hits+misses)
+}
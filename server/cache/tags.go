@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ProductListTag marks every cached response that lists products.
+const ProductListTag = "products"
+
+// ProductTag marks cached data that contains the product.
+func ProductTag(productID int) string {
+    return fmt.Sprintf("product:%d", productID)
+}
+
+// CategoryTag marks cached data that contains products of the category.
+func CategoryTag(category string) string {
+    return "category:" + strings.ToLower(strings.TrimSpace(category))
+}
+
+func tagKey(tag string) string {
+    return "tag:" + tag
+}
+
+type tagCollectorKey struct{}
+
+type tagCollector struct {
+    mu   sync.Mutex
+    tags []string
+    seen map[string]bool
+}
+
+// WithTagCollector returns a context that collects the tags added with
+// TagResponse, and a function that returns them. APICacheMiddleware uses
+// it to tag the response it stores, Fetch to tag what its loader returns.
+func WithTagCollector(ctx context.Context) (context.Context, func() []string) {
+    collector := &tagCollector{seen: make(map[string]bool)}
+    collected := func() []string {
+        collector.mu.Lock()
+        defer collector.mu.Unlock()
+        return append([]string(nil), collector.tags...)
+    }
+    return context.WithValue(ctx, tagCollectorKey{}, collector), collected
+}
+
+// TagResponse tags the response or Fetch value being built under ctx,
+// e.g. with ProductTag for every product it contains. It does nothing
+// when the result is not cached.
+func TagResponse(ctx context.Context, tags ...string) {
+    collector, ok := ctx.Value(tagCollectorKey{}).(*tagCollector)
+    if !ok {
+        return
+    }
+
+    collector.mu.Lock()
+    defer collector.mu.Unlock()
+    for _, tag := range tags {
+        if !collector.seen[tag] {
+            collector.seen[tag] = true
+            collector.tags = append(collector.tags, tag)
+        }
+    }
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// CartReminderIntervals are how long a saved cart must sit idle before each
+// abandoned cart reminder. Their count is the most reminders a cart gets.
+var CartReminderIntervals = []time.Duration{time.Hour, 24 * time.Hour, 72 * time.Hour}
+
+// InitCartRecovery reads CART_REMINDER_INTERVALS, a comma-separated list of
+// increasing durations such as "1h,24h,72h". "off" disables reminders.
+func InitCartRecovery() error {
+    value := strings.TrimSpace(getEnv("CART_REMINDER_INTERVALS", ""))
+    switch value {
+    case "":
+        return nil
+    case "off":
+        CartReminderIntervals = nil
+        log.Println("Abandoned cart reminders disabled")
+        return nil
+    }
+
+    var intervals []time.Duration
+    for _, part := range strings.Split(value, ",") {
+        d, err := time.ParseDuration(strings.TrimSpace(part))
+        if err != nil {
+            return fmt.Errorf("invalid CART_REMINDER_INTERVALS: %w", err)
+        }
+        if d <= 0 || (len(intervals) > 0 && d <= intervals[len(intervals)-1]) {
+            return fmt.Errorf("CART_REMINDER_INTERVALS must be positive and increasing")
+        }
+        intervals = append(intervals, d)
+    }
+
+    CartReminderIntervals = intervals
+    log.Printf("Abandoned cart reminders after %v of inactivity", intervals)
+    return nil
+}
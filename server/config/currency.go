@@ -0,0 +1,37 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"server/money"
+)
+
+// InitCurrency configures the base catalog currency and loads exchange
+// rates from EXCHANGE_RATES_FILE. Without a file, only the base currency
+// is supported.
+func InitCurrency() error {
+    base, ok := money.NormalizeCurrency(getEnv("BASE_CURRENCY", "USD"))
+    if !ok {
+        return fmt.Errorf("invalid BASE_CURRENCY")
+    }
+
+    path := getEnv("EXCHANGE_RATES_FILE", "")
+    if path == "" {
+        money.SetRateSource(base, &money.StaticRates{Base: base})
+        log.Printf("No exchange rates configured, serving prices in %s only", base)
+        return nil
+    }
+
+    rates, err := money.LoadStaticRates(path)
+    if err != nil {
+        return fmt.Errorf("failed to load exchange rates: %w", err)
+    }
+    if rates.Base != base {
+        return fmt.Errorf("exchange rates base %s does not match BASE_CURRENCY %s", rates.Base, base)
+    }
+
+    money.SetRateSource(base, rates)
+    log.Printf("Exchange rates loaded for %v", rates.Currencies())
+    return nil
+}
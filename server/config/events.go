@@ -0,0 +1,22 @@
+package config
+
+import (
+	"context"
+	"log"
+
+	"server/events"
+)
+
+// StartEvents launches the outbox dispatcher. Events are mirrored to the
+// Redis stream named by EVENTS_STREAM when it is set. Subscribers must be
+// registered before this runs.
+func StartEvents(ctx context.Context) {
+    cfg := events.DefaultDispatcherConfig
+    if stream := getEnv("EVENTS_STREAM", ""); stream != "" {
+        cfg.Redis = RedisClient
+        cfg.Stream = stream
+        log.Printf("Publishing events to Redis stream %s", stream)
+    }
+
+    events.NewDispatcher(DB, cfg).Start(ctx)
+}
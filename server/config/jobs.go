@@ -0,0 +1,21 @@
+package config
+
+import (
+	"context"
+	"log"
+
+	"server/jobs"
+)
+
+// StartJobs runs the scheduler for the registered jobs. Instances started
+// with JOBS_ENABLED=false never pick up scheduled runs but can still
+// trigger jobs by hand. Jobs must be registered before this runs.
+func StartJobs(ctx context.Context) {
+    jobs.SetRedis(RedisClient)
+
+    if getEnv("JOBS_ENABLED", "true") == "false" {
+        log.Println("Scheduled jobs disabled on this instance")
+        return
+    }
+    jobs.Start(ctx)
+}
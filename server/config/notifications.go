@@ -0,0 +1,51 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"server/notifications"
+)
+
+// InitNotifications selects the mailer from MAIL_DRIVER: "file" (the
+// default) drops messages into MAIL_DROP_DIR for development, "smtp"
+// sends through SMTP_HOST. Links in emails point at APP_URL.
+func InitNotifications() error {
+    notifications.Configure(notifications.Config{
+        From:    getEnv("MAIL_FROM", "Shop <no-reply@localhost>"),
+        BaseURL: getEnv("APP_URL", "http://localhost:3000"),
+    })
+
+    switch driver := getEnv("MAIL_DRIVER", "file"); driver {
+    case "file":
+        dir := getEnv("MAIL_DROP_DIR", "mail")
+        notifications.SetMailer(&notifications.FileMailer{Dir: dir})
+        log.Printf("Emails will be written to %s", dir)
+    case "smtp":
+        port, err := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+        if err != nil {
+            return fmt.Errorf("invalid SMTP_PORT: %w", err)
+        }
+        host := getEnv("SMTP_HOST", "")
+        if host == "" {
+            return fmt.Errorf("SMTP_HOST is required when MAIL_DRIVER is smtp")
+        }
+        notifications.SetMailer(&notifications.SMTPMailer{
+            Host:     host,
+            Port:     port,
+            Username: getEnv("SMTP_USERNAME", ""),
+            Password: getEnv("SMTP_PASSWORD", ""),
+        })
+        log.Printf("Sending email through %s:%d", host, port)
+    default:
+        return fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+    }
+    return nil
+}
+
+// StartNotifications launches the worker that sends queued emails.
+func StartNotifications(ctx context.Context) {
+    notifications.NewWorker(DB, notifications.DefaultWorkerConfig).Start(ctx)
+}
@@ -0,0 +1,23 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"server/payments"
+)
+
+// InitPayments selects the payment provider named by PAYMENT_PROVIDER.
+// Only the manual provider ships with the server.
+func InitPayments() error {
+    name := getEnv("PAYMENT_PROVIDER", "manual")
+    switch name {
+    case "manual":
+        payments.SetProvider(payments.ManualProvider{})
+    default:
+        return fmt.Errorf("%w: %s", payments.ErrUnknownProvider, name)
+    }
+
+    log.Printf("Payment provider: %s", name)
+    return nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// TrustedProxies are the networks of the load balancers and reverse
+// proxies in front of the server. Forwarding headers are only believed
+// when a request arrives from one of them.
+var TrustedProxies []*net.IPNet
+
+// InitProxies reads TRUSTED_PROXIES, a comma-separated list of CIDRs or
+// single IPs such as "10.0.0.0/8,127.0.0.1". Empty trusts no proxy, so
+// the client IP is always the connection's address.
+func InitProxies() error {
+    value := strings.TrimSpace(getEnv("TRUSTED_PROXIES", ""))
+    if value == "" {
+        TrustedProxies = nil
+        return nil
+    }
+
+    var networks []*net.IPNet
+    for _, part := range strings.Split(value, ",") {
+        network, err := ParseCIDR(part)
+        if err != nil {
+            return fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+        }
+        networks = append(networks, network)
+    }
+
+    TrustedProxies = networks
+    log.Printf("Trusting forwarding headers from %v", networks)
+    return nil
+}
+
+// ParseCIDR accepts a CIDR or a single IP address.
+func ParseCIDR(entry string) (*net.IPNet, error) {
+    entry = strings.TrimSpace(entry)
+    if !strings.Contains(entry, "/") {
+        ip := net.ParseIP(entry)
+        if ip == nil {
+            return nil, fmt.Errorf("invalid IP address %q", entry)
+        }
+        bits := 128
+        if ip.To4() != nil {
+            ip = ip.To4()
+            bits = 32
+        }
+        return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+    }
+    _, network, err := net.ParseCIDR(entry)
+    return network, err
+}
+
+// IsTrustedProxy reports whether ip belongs to TrustedProxies.
+func IsTrustedProxy(ip net.IP) bool {
+    for _, network := range TrustedProxies {
+        if network.Contains(ip) {
+            return true
+        }
+    }
+    return false
+}
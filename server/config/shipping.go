@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"server/money"
+	"server/shipping"
+)
+
+// InitShipping loads zones and shipping methods from SHIPPING_METHODS_FILE.
+// Without a file every order ships at a flat rate. Must run after
+// InitCurrency.
+func InitShipping() error {
+    path := getEnv("SHIPPING_METHODS_FILE", "")
+    if path == "" {
+        shipping.SetCalculator(shipping.DefaultTable(money.BaseCurrency()))
+        log.Println("No shipping methods configured, using a flat rate")
+        return nil
+    }
+
+    table, err := shipping.LoadTable(path)
+    if err != nil {
+        return fmt.Errorf("failed to load shipping methods: %w", err)
+    }
+
+    shipping.SetCalculator(table)
+    log.Printf("Shipping table loaded with %d zones and %d methods", len(table.Zones), len(table.Methods))
+    return nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"server/tax"
+)
+
+// InitTax loads the tax rate table from TAX_RATES_FILE. Without a file no
+// tax is charged.
+func InitTax() error {
+    path := getEnv("TAX_RATES_FILE", "")
+    if path == "" {
+        tax.SetCalculator(tax.NoTax{})
+        log.Println("No tax rate table configured, tax will not be charged")
+        return nil
+    }
+
+    table, err := tax.LoadTable(path)
+    if err != nil {
+        return fmt.Errorf("failed to load tax rates: %w", err)
+    }
+
+    tax.SetCalculator(table)
+    log.Printf("Tax rate table loaded with %d rules", len(table.Rules))
+    return nil
+}
@@ -0,0 +1,216 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type DispatcherConfig struct {
+    PollInterval time.Duration
+    BatchSize    int
+    Timeout      time.Duration // Per event, across all subscribers and the stream
+    MaxAttempts  int           // After this many failures an event is parked as failed
+    BaseBackoff  time.Duration // Doubled on every failed attempt
+    MaxBackoff   time.Duration
+
+    // Optional Redis Streams mirror; events are XADDed to Stream when set
+    Redis        *redis.Client
+    Stream       string
+    StreamMaxLen int64
+}
+
+var DefaultDispatcherConfig = DispatcherConfig{
+    PollInterval: time.Second,
+    BatchSize:    100,
+    Timeout:      30 * time.Second,
+    MaxAttempts:  10,
+    BaseBackoff:  time.Second,
+    MaxBackoff:   10 * time.Minute,
+    StreamMaxLen: 100000,
+}
+
+// Dispatcher polls the outbox and delivers pending events. Several server
+// instances can run one each: rows are leased with SKIP LOCKED.
+type Dispatcher struct {
+    db     *sql.DB
+    config DispatcherConfig
+}
+
+func NewDispatcher(db *sql.DB, config DispatcherConfig) *Dispatcher {
+    return &Dispatcher{db: db, config: config}
+}
+
+// Start runs the dispatch loop in a goroutine until ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+    go func() {
+        ticker := time.NewTicker(d.config.PollInterval)
+        defer ticker.Stop()
+
+        for {
+            // Drain full batches straight away, then wait for the next tick
+            for {
+                n, err := d.dispatchBatch(ctx)
+                if err != nil {
+                    log.Printf("Outbox dispatch error: %v", err)
+                    break
+                }
+                if n < d.config.BatchSize {
+                    break
+                }
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+}
+
+type outboxRow struct {
+    event    Event
+    attempts int
+}
+
+// dispatchBatch leases due events by pushing their next attempt past the
+// delivery timeout and commits, so no rows stay locked while subscribers
+// run. Each event is then marked on its own; a crashed dispatcher's lease
+// simply expires.
+func (d *Dispatcher) dispatchBatch(ctx context.Context) (int, error) {
+    lease := 2 * d.config.Timeout
+    leasedAt := time.Now()
+    rows, err := d.db.QueryContext(ctx, `
+        UPDATE outbox_events
+        SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+        WHERE id IN (
+            SELECT id
+            FROM outbox_events
+            WHERE published_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, event_type, payload, attempts, created_at`,
+        d.config.BatchSize, lease.Milliseconds(),
+    )
+    if err != nil {
+        return 0, err
+    }
+
+    var batch []outboxRow
+    for rows.Next() {
+        var row outboxRow
+        var payload []byte
+        if err := rows.Scan(&row.event.ID, &row.event.Type, &payload, &row.attempts, &row.event.OccurredAt); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        row.event.Payload = payload
+        batch = append(batch, row)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    // RETURNING does not keep the subquery's order
+    sort.Slice(batch, func(i, j int) bool { return batch[i].event.ID < batch[j].event.ID })
+
+    for _, row := range batch {
+        // Leave the rest to expire rather than deliver past the lease
+        if time.Since(leasedAt) > lease-d.config.Timeout {
+            break
+        }
+
+        deliverCtx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+        deliverErr := d.deliver(deliverCtx, row.event)
+        cancel()
+
+        if deliverErr != nil {
+            if err := d.markFailed(ctx, row, deliverErr); err != nil {
+                log.Printf("Outbox event %d: failed to record attempt: %v", row.event.ID, err)
+            }
+            continue
+        }
+
+        _, err := d.db.ExecContext(ctx, "UPDATE outbox_events SET published_at = NOW(), attempts = attempts + 1 WHERE id = $1", row.event.ID)
+        if err != nil {
+            log.Printf("Outbox event %d: failed to mark published: %v", row.event.ID, err)
+        }
+    }
+
+    return len(batch), nil
+}
+
+// deliver hands the event to every subscriber and then to the stream. A
+// failure anywhere retries the whole event, so subscribers that already
+// succeeded see it again.
+func (d *Dispatcher) deliver(ctx context.Context, event Event) (err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("subscriber panicked: %v", r)
+        }
+    }()
+
+    for _, handler := range handlersFor(event.Type) {
+        if err := handler(ctx, event); err != nil {
+            return err
+        }
+    }
+
+    if d.config.Redis != nil && d.config.Stream != "" {
+        err := d.config.Redis.XAdd(ctx, &redis.XAddArgs{
+            Stream: d.config.Stream,
+            MaxLen: d.config.StreamMaxLen,
+            Approx: true,
+            Values: []interface{}{
+                "id", strconv.FormatInt(event.ID, 10),
+                "type", event.Type,
+                "payload", string(event.Payload),
+                "occurred_at", event.OccurredAt.UTC().Format(time.RFC3339Nano),
+            },
+        }).Err()
+        if err != nil {
+            return fmt.Errorf("redis stream: %w", err)
+        }
+    }
+
+    return nil
+}
+
+func (d *Dispatcher) markFailed(ctx context.Context, row outboxRow, cause error) error {
+    attempts := row.attempts + 1
+    if attempts >= d.config.MaxAttempts {
+        log.Printf("Outbox event %d (%s) failed %d times, giving up: %v", row.event.ID, row.event.Type, attempts, cause)
+        _, err := d.db.ExecContext(ctx,
+            "UPDATE outbox_events SET attempts = $1, last_error = $2, failed_at = NOW() WHERE id = $3",
+            attempts, cause.Error(), row.event.ID,
+        )
+        return err
+    }
+
+    _, err := d.db.ExecContext(ctx,
+        "UPDATE outbox_events SET attempts = $1, last_error = $2, next_attempt_at = NOW() + $3 * INTERVAL '1 millisecond' WHERE id = $4",
+        attempts, cause.Error(), d.backoff(attempts).Milliseconds(), row.event.ID,
+    )
+    return err
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+    delay := d.config.BaseBackoff
+    for i := 1; i < attempts && delay < d.config.MaxBackoff; i++ {
+        delay *= 2
+    }
+    if delay > d.config.MaxBackoff {
+        delay = d.config.MaxBackoff
+    }
+    return delay
+}
@@ -0,0 +1,98 @@
+// Package events records domain events in a transactional outbox and
+// delivers them to subscribers after the writing transaction commits.
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Event types. Payloads are small JSON objects carrying the IDs a
+// subscriber needs to load the current state.
+const (
+    UserCreated      = "user.created"
+    OrderCreated     = "order.created"
+    OrderPaid        = "order.paid"
+    OrderShipped     = "order.shipped"
+    OrderDelivered   = "order.delivered"
+    ReturnRequested  = "return.requested"
+    RefundIssued     = "refund.issued"
+    ProductUpdated   = "product.updated"
+    InventoryUpdated = "inventory.updated"
+
+    // AllEvents subscribes a handler to every event type
+    AllEvents = "*"
+)
+
+type Event struct {
+    ID         int64           `json:"id"` // Stable across redeliveries, for deduplication
+    Type       string          `json:"type"`
+    Payload    json.RawMessage `json:"payload"`
+    OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Types lists every event type, for validating subscription filters.
+var Types = []string{
+    UserCreated, OrderCreated, OrderPaid, OrderShipped, OrderDelivered,
+    ReturnRequested, RefundIssued, ProductUpdated, InventoryUpdated,
+}
+
+func IsValidType(eventType string) bool {
+    for _, t := range Types {
+        if t == eventType {
+            return true
+        }
+    }
+    return false
+}
+
+// Decode unmarshals the payload into v.
+func (e Event) Decode(v interface{}) error {
+    return json.Unmarshal(e.Payload, v)
+}
+
+// Handler processes one event. Delivery is at least once, so handlers must
+// tolerate seeing the same event ID twice. Returning an error schedules the
+// event for another attempt.
+type Handler func(ctx context.Context, event Event) error
+
+// Publish writes an event to the outbox in the caller's transaction. It is
+// delivered only if, and after, the transaction commits.
+func Publish(tx *sql.Tx, eventType string, payload interface{}) error {
+    data, err := json.Marshal(payload)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(
+        "INSERT INTO outbox_events (event_type, payload) VALUES ($1, $2)",
+        eventType, data,
+    )
+    return err
+}
+
+var (
+    mu          sync.RWMutex
+    subscribers = make(map[string][]Handler)
+)
+
+// Subscribe registers an in-process handler for an event type, or for
+// every type with AllEvents. Register handlers before starting the
+// dispatcher.
+func Subscribe(eventType string, handler Handler) {
+    mu.Lock()
+    defer mu.Unlock()
+    subscribers[eventType] = append(subscribers[eventType], handler)
+}
+
+func handlersFor(eventType string) []Handler {
+    mu.RLock()
+    defer mu.RUnlock()
+
+    handlers := make([]Handler, 0, len(subscribers[eventType])+len(subscribers[AllEvents]))
+    handlers = append(handlers, subscribers[eventType]...)
+    return append(handlers, subscribers[AllEvents]...)
+}
@@ -10,10 +10,14 @@ require (
 require (
 	github.com/cespare/xxhash/v2 v2.3.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
 
 require (
-	github.com/golang-jwt/jwt/v5 v5.3.0 // indirect
+	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/klauspost/compress v1.20.1
 	github.com/redis/go-redis/v9 v9.13.0
-	golang.org/x/crypto v0.41.0 // indirect
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/crypto v0.41.0
+	golang.org/x/sync v0.16.0
 )
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"server/cache"
+	"server/utils"
+)
+
+// GetCacheStats reports cache stats overall and per namespace.
+func GetCacheStats(w http.ResponseWriter, r *http.Request) {
+    stats, err := cache.DefaultCache.GetStats(r.Context())
+    if err != nil {
+        utils.WriteError(w, http.StatusServiceUnavailable, "Failed to load cache stats")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, stats)
+}
+
+// FlushCache drops every entry of the namespace given in the query.
+func FlushCache(w http.ResponseWriter, r *http.Request) {
+    namespace := r.URL.Query().Get("namespace")
+    if namespace == "" {
+        utils.WriteError(w, http.StatusBadRequest, "namespace is required")
+        return
+    }
+
+    if err := cache.DefaultCache.FlushNamespace(r.Context(), namespace); err != nil {
+        if errors.Is(err, cache.ErrUnknownNamespace) {
+            utils.WriteError(w, http.StatusNotFound, "Unknown cache namespace")
+            return
+        }
+        utils.WriteError(w, http.StatusServiceUnavailable, "Failed to flush cache")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, map[string]string{
+        "namespace": namespace,
+        "status":    "flushed",
+    })
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"time"
+)
+
+type SaveCartRequest struct {
+    Items []models.CartItemInput `json:"items"`
+}
+
+type CartLinkRequest struct {
+    Token string `json:"token"`
+}
+
+// SavedCartResponse is a saved cart priced at today's prices. When it can
+// no longer be priced, e.g. a product was removed, the stored items are
+// returned with the reason in cart_error.
+type SavedCartResponse struct {
+    Items     []models.CartItemInput `json:"items"`
+    UpdatedAt time.Time              `json:"updated_at"`
+    Cart      *models.Cart           `json:"cart,omitempty"`
+    CartError string                 `json:"cart_error,omitempty"`
+}
+
+func GetMyCart(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    saved, err := models.GetSavedCart(userID)
+    if err != nil {
+        writeSavedCartError(w, err)
+        return
+    }
+    writeSavedCart(w, r, saved)
+}
+
+// SaveMyCart stores the client's cart so it follows the user across
+// devices. Saving an empty cart deletes it.
+func SaveMyCart(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    var req SaveCartRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    currency, err := utils.RequestCurrency(r)
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if len(req.Items) == 0 {
+        if err := models.DeleteSavedCart(userID); err != nil {
+            utils.WriteError(w, http.StatusInternalServerError, "Failed to save cart")
+            return
+        }
+        w.WriteHeader(http.StatusNoContent)
+        return
+    }
+
+    cart, err := models.BuildCart(userID, currency, req.Items)
+    if err != nil {
+        writeCartError(w, err)
+        return
+    }
+
+    if err := models.SaveCart(userID, currency, req.Items); err != nil {
+        log.Printf("Failed to save cart for user %d: %v", userID, err)
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to save cart")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, SavedCartResponse{Items: req.Items, UpdatedAt: time.Now(), Cart: cart})
+}
+
+func DeleteMyCart(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    if err := models.DeleteSavedCart(userID); err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to delete cart")
+        return
+    }
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// RestoreCart opens the saved cart from the signed link in a reminder
+// email. The link works without signing in; checking out still requires it.
+func RestoreCart(w http.ResponseWriter, r *http.Request) {
+    var req CartLinkRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    saved, err := models.RestoreCart(r.Context(), req.Token)
+    if err != nil {
+        writeSavedCartError(w, err)
+        return
+    }
+    writeSavedCart(w, r, saved)
+}
+
+// UnsubscribeCartReminders handles the unsubscribe link in reminder emails.
+func UnsubscribeCartReminders(w http.ResponseWriter, r *http.Request) {
+    var req CartLinkRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    if err := models.UnsubscribeCartReminders(r.Context(), req.Token); err != nil {
+        writeSavedCartError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "You will no longer receive cart reminders"})
+}
+
+// GetCartRecoveryStats reports abandoned cart conversion for carts first
+// reminded between from and to (RFC 3339 or YYYY-MM-DD). The default is
+// the last 30 days.
+func GetCartRecoveryStats(w http.ResponseWriter, r *http.Request) {
+    to := time.Now()
+    from := to.AddDate(0, 0, -30)
+
+    var err error
+    if value := r.URL.Query().Get("from"); value != "" {
+        if from, err = parseStatsTime(value); err != nil {
+            utils.WriteError(w, http.StatusBadRequest, "Invalid from date")
+            return
+        }
+    }
+    if value := r.URL.Query().Get("to"); value != "" {
+        if to, err = parseStatsTime(value); err != nil {
+            utils.WriteError(w, http.StatusBadRequest, "Invalid to date")
+            return
+        }
+    }
+    if !from.Before(to) {
+        utils.WriteError(w, http.StatusBadRequest, "from must be before to")
+        return
+    }
+
+    stats, err := models.GetCartRecoveryStats(r.Context(), from, to)
+    if err != nil {
+        log.Printf("Failed to load cart recovery stats: %v", err)
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load cart recovery stats")
+        return
+    }
+    utils.WriteJSON(w, http.StatusOK, stats)
+}
+
+func parseStatsTime(value string) (time.Time, error) {
+    if t, err := time.Parse(time.RFC3339, value); err == nil {
+        return t, nil
+    }
+    return time.Parse("2006-01-02", value)
+}
+
+// writeSavedCart prices a saved cart in the requested currency, or in the
+// currency it was saved in when none is requested.
+func writeSavedCart(w http.ResponseWriter, r *http.Request, saved *models.SavedCart) {
+    currency := saved.Currency
+    if r.URL.Query().Get("currency") != "" || r.Header.Get("Accept-Currency") != "" {
+        var err error
+        if currency, err = utils.RequestCurrency(r); err != nil {
+            utils.WriteError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+    }
+
+    resp := SavedCartResponse{Items: saved.Items, UpdatedAt: saved.UpdatedAt}
+    cart, err := models.BuildCart(saved.UserID, currency, saved.Items)
+    switch {
+    case err == nil:
+        resp.Cart = cart
+    case errors.Is(err, models.ErrEmptyCart),
+        errors.Is(err, models.ErrInvalidQuantity),
+        errors.Is(err, models.ErrInvalidVariant),
+        errors.Is(err, models.ErrProductNotFound):
+        resp.CartError = err.Error()
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to price cart")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+func writeSavedCartError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, models.ErrCartNotFound):
+        utils.WriteError(w, http.StatusNotFound, err.Error())
+    case errors.Is(err, models.ErrInvalidCartLink):
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load cart")
+    }
+}
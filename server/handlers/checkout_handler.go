@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"server/config"
+	"server/models"
+	"server/promotions"
+	"server/shipping"
+	"server/tax"
+	"server/utils"
+)
+
+type CartRequest struct {
+    Items           []models.CartItemInput `json:"items"`
+    CouponCode      string                 `json:"coupon_code,omitempty"`
+    ShippingAddress *models.Address        `json:"shipping_address,omitempty"`
+    ShippingMethod  string                 `json:"shipping_method,omitempty"` // Cheapest when empty
+}
+
+type CartQuoteResponse struct {
+    *models.Cart
+    CouponError string `json:"coupon_error,omitempty"`
+}
+
+// QuoteCart prices the client's cart and validates an optional coupon. An
+// unusable coupon does not fail the request; the reason is returned in
+// coupon_error so the storefront can show it next to the code field. Tax
+// is only included once a shipping address is known; until then shipping
+// is the default zone's rate and marked shipping_pending.
+func QuoteCart(w http.ResponseWriter, r *http.Request) {
+    var req CartRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    currency, err := utils.RequestCurrency(r)
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    userID, _ := utils.UserIDFromContext(r.Context())
+    cart, err := models.BuildCart(userID, currency, req.Items)
+    if err != nil {
+        writeCartError(w, err)
+        return
+    }
+
+    if req.ShippingAddress != nil {
+        if err := req.ShippingAddress.Validate(); err != nil {
+            utils.WriteError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        if err := applyShippingAddress(cart, *req.ShippingAddress, req.ShippingMethod); err != nil {
+            writeShippingError(w, err)
+            return
+        }
+    }
+
+    resp := CartQuoteResponse{Cart: cart}
+    if req.CouponCode != "" {
+        if err := cart.ApplyCoupon(req.CouponCode); err != nil {
+            if !promotions.IsValidationError(err) {
+                utils.WriteError(w, http.StatusInternalServerError, "Failed to validate coupon")
+                return
+            }
+            resp.CouponError = err.Error()
+        }
+    }
+
+    utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// Checkout turns the submitted cart into a pending order. The coupon is
+// re-validated and redeemed in the same transaction as the order insert.
+func Checkout(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    var req CartRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    currency, err := utils.RequestCurrency(r)
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    if req.ShippingAddress == nil {
+        utils.WriteError(w, http.StatusBadRequest, "Shipping address is required")
+        return
+    }
+    if err := req.ShippingAddress.Validate(); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    cart, err := models.BuildCart(userID, currency, req.Items)
+    if err != nil {
+        writeCartError(w, err)
+        return
+    }
+
+    if err := applyShippingAddress(cart, *req.ShippingAddress, req.ShippingMethod); err != nil {
+        writeShippingError(w, err)
+        return
+    }
+
+    tx, err := config.DB.Begin()
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Database error")
+        return
+    }
+    defer tx.Rollback()
+
+    if req.CouponCode != "" {
+        if err := cart.RedeemCoupon(tx, req.CouponCode); err != nil {
+            writeCouponError(w, err)
+            return
+        }
+    }
+
+    order, err := models.CreateOrder(tx, cart, *req.ShippingAddress)
+    if err != nil {
+        log.Printf("Failed to create order for user %d: %v", userID, err)
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to create order")
+        return
+    }
+
+    if cart.Coupon != nil {
+        if err := promotions.RecordRedemption(tx, cart.Coupon, userID, order.ID); err != nil {
+            utils.WriteError(w, http.StatusInternalServerError, "Failed to redeem coupon")
+            return
+        }
+    }
+
+    // Clears the saved cart and credits any abandoned cart reminders
+    if err := models.CompleteCart(tx, userID, order.ID); err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to create order")
+        return
+    }
+
+    if err = tx.Commit(); err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to commit transaction")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, order)
+}
+
+// applyShippingAddress prices shipping and tax for the destination.
+func applyShippingAddress(cart *models.Cart, address models.Address, method string) error {
+    if err := cart.ApplyShipping(shipping.Default(), address.ShippingDestination(), method); err != nil {
+        return err
+    }
+    return cart.ApplyTax(tax.Default(), address.TaxLocation())
+}
+
+func writeShippingError(w http.ResponseWriter, err error) {
+    if errors.Is(err, shipping.ErrMethodUnavailable) {
+        utils.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+        return
+    }
+    utils.WriteError(w, http.StatusInternalServerError, "Failed to calculate shipping and tax")
+}
+
+func writeCartError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, models.ErrEmptyCart),
+        errors.Is(err, models.ErrInvalidQuantity),
+        errors.Is(err, models.ErrInvalidVariant),
+        errors.Is(err, models.ErrProductNotFound):
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to price cart")
+    }
+}
+
+func writeCouponError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, promotions.ErrCouponNotFound):
+        utils.WriteError(w, http.StatusNotFound, err.Error())
+    case errors.Is(err, promotions.ErrUsageLimitReached),
+        errors.Is(err, promotions.ErrPerUserLimitReached):
+        utils.WriteError(w, http.StatusConflict, err.Error())
+    case promotions.IsValidationError(err):
+        utils.WriteError(w, http.StatusUnprocessableEntity, err.Error())
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to redeem coupon")
+    }
+}
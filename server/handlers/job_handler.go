@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"server/jobs"
+	"server/utils"
+)
+
+// GetJobs lists the scheduled jobs with their run metrics.
+func GetJobs(w http.ResponseWriter, r *http.Request) {
+    statuses, err := jobs.List(r.Context())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load jobs")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, statuses)
+}
+
+// RunJob starts a job immediately. It runs in the background; poll
+// GET /admin/jobs for the outcome.
+func RunJob(w http.ResponseWriter, r *http.Request) {
+    name := r.PathValue("name")
+    if err := jobs.Trigger(r.Context(), name); err != nil {
+        switch {
+        case errors.Is(err, jobs.ErrJobNotFound):
+            utils.WriteError(w, http.StatusNotFound, "Job not found")
+        case errors.Is(err, jobs.ErrJobRunning):
+            utils.WriteError(w, http.StatusConflict, err.Error())
+        default:
+            utils.WriteError(w, http.StatusServiceUnavailable, "Failed to start job")
+        }
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusAccepted, map[string]string{
+        "job":    name,
+        "status": "started",
+    })
+}
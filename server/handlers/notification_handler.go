@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"server/notifications"
+	"server/utils"
+)
+
+// GetEmailTemplates lists the email templates and their locales.
+func GetEmailTemplates(w http.ResponseWriter, r *http.Request) {
+    utils.WriteJSON(w, http.StatusOK, notifications.ListTemplates())
+}
+
+// PreviewEmailTemplate renders a template with sample data. ?locale=
+// picks the language and ?format=html or text returns that part alone so
+// it can be opened in a browser; the default is JSON with every part.
+func PreviewEmailTemplate(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    rendered, err := notifications.Preview(r.PathValue("name"), query.Get("locale"))
+    if err != nil {
+        if errors.Is(err, notifications.ErrTemplateNotFound) {
+            utils.WriteError(w, http.StatusNotFound, "Template not found")
+            return
+        }
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to render template")
+        return
+    }
+
+    switch query.Get("format") {
+    case "html":
+        w.Header().Set("Content-Type", "text/html; charset=utf-8")
+        w.Write([]byte(rendered.HTML))
+    case "text":
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.Write([]byte(rendered.Text))
+    case "", "json":
+        utils.WriteJSON(w, http.StatusOK, rendered)
+    default:
+        utils.WriteError(w, http.StatusBadRequest, "Format must be one of json, html, text")
+    }
+}
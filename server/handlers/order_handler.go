@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"server/models"
+	"server/shipping"
+	"server/utils"
+	"strconv"
+)
+
+// OrderDetailResponse is an order with everything that happened to it.
+type OrderDetailResponse struct {
+    *models.Order
+    Payments  []models.Payment  `json:"payments"`
+    Shipments []models.Shipment `json:"shipments"`
+}
+
+type ReorderResponse struct {
+    Cart            *models.Cart         `json:"cart"` // Null when nothing could be re-added
+    ShippingAddress models.Address       `json:"shipping_address"`
+    Skipped         []models.SkippedItem `json:"skipped"`
+}
+
+func GetMyOrders(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    status := r.URL.Query().Get("status")
+    if status != "" && !models.IsValidOrderStatus(status) {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid order status")
+        return
+    }
+
+    page := utils.ParsePagination(r)
+    orders, total, err := models.ListUserOrders(userID, status, page.PageSize, page.Offset())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load orders")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, page.Response(orders, total))
+}
+
+func GetMyOrder(w http.ResponseWriter, r *http.Request) {
+    order, ok := loadOwnOrder(w, r)
+    if !ok {
+        return
+    }
+
+    payments, err := models.GetPaymentsByOrder(order.ID)
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load payments")
+        return
+    }
+
+    shipments, err := models.GetShipmentsByOrder(order.ID)
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load shipments")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, OrderDetailResponse{Order: order, Payments: payments, Shipments: shipments})
+}
+
+// Reorder prices a new cart from a past order at today's prices, for the
+// same address. Lines that are no longer available are listed as skipped.
+func Reorder(w http.ResponseWriter, r *http.Request) {
+    order, ok := loadOwnOrder(w, r)
+    if !ok {
+        return
+    }
+
+    currency, err := utils.RequestCurrency(r)
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    items, skipped, err := models.ReorderItems(order)
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to rebuild cart")
+        return
+    }
+
+    resp := ReorderResponse{ShippingAddress: order.ShippingAddress, Skipped: skipped}
+    if len(items) == 0 {
+        utils.WriteJSON(w, http.StatusOK, resp)
+        return
+    }
+
+    cart, err := models.BuildCart(order.UserID, currency, items)
+    if err != nil {
+        writeCartError(w, err)
+        return
+    }
+
+    // The old method may no longer serve the address; fall back to the cheapest
+    err = applyShippingAddress(cart, order.ShippingAddress, order.ShippingMethod)
+    if errors.Is(err, shipping.ErrMethodUnavailable) {
+        err = applyShippingAddress(cart, order.ShippingAddress, "")
+    }
+    if err != nil {
+        writeShippingError(w, err)
+        return
+    }
+
+    resp.Cart = cart
+    utils.WriteJSON(w, http.StatusOK, resp)
+}
+
+// loadOwnOrder loads the order named in the path if it belongs to the
+// caller. Orders of other users are reported as not found, so their IDs
+// cannot be probed.
+func loadOwnOrder(w http.ResponseWriter, r *http.Request) (*models.Order, bool) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return nil, false
+    }
+
+    orderID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+        return nil, false
+    }
+
+    order, err := models.GetOrderByID(orderID)
+    if err != nil && !errors.Is(err, models.ErrOrderNotFound) {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load order")
+        return nil, false
+    }
+    if err != nil || order.UserID != userID {
+        utils.WriteError(w, http.StatusNotFound, "Order not found")
+        return nil, false
+    }
+
+    return order, true
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type ForgotPasswordRequest struct {
+    Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+    Token    string `json:"token"`
+    Password string `json:"password"`
+}
+
+// ForgotPassword emails a reset link. It answers the same way whether or
+// not the address is registered.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+    var req ForgotPasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    req.Email = strings.TrimSpace(req.Email)
+    if req.Email == "" {
+        utils.WriteError(w, http.StatusBadRequest, "Email is required")
+        return
+    }
+
+    if err := models.RequestPasswordReset(r.Context(), req.Email); err != nil {
+        log.Printf("Failed to start password reset: %v", err)
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to start password reset")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusAccepted, map[string]string{
+        "message": "If an account exists for that email, a reset link is on its way",
+    })
+}
+
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+    var req ResetPasswordRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    if req.Token == "" || req.Password == "" {
+        utils.WriteError(w, http.StatusBadRequest, "Token and Password are required")
+        return
+    }
+
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to hash password")
+        return
+    }
+
+    if err := models.ResetPassword(r.Context(), req.Token, hashedPassword); err != nil {
+        if errors.Is(err, models.ErrInvalidResetToken) {
+            utils.WriteError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to reset password")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Password updated; please log in again"})
+}
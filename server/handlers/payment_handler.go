@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/models"
+	"server/payments"
+	"server/utils"
+	"strconv"
+)
+
+type PayOrderRequest struct {
+    Token string `json:"token"` // Payment method token, if the provider needs one
+}
+
+func PayOrder(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    orderID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+
+    var req PayOrderRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    payment, err := models.PayOrder(r.Context(), orderID, userID, req.Token)
+    if err != nil {
+        switch {
+        case errors.Is(err, models.ErrOrderNotFound):
+            utils.WriteError(w, http.StatusNotFound, "Order not found")
+        case errors.Is(err, models.ErrOrderNotPayable):
+            utils.WriteError(w, http.StatusConflict, err.Error())
+        case errors.Is(err, models.ErrPaymentInProgress):
+            utils.WriteError(w, http.StatusConflict, err.Error())
+        case errors.Is(err, payments.ErrDeclined):
+            utils.WriteError(w, http.StatusPaymentRequired, err.Error())
+        case errors.Is(err, models.ErrPaymentUnsettled):
+            utils.WriteError(w, http.StatusBadGateway, "Payment outcome unknown; the order stays pending until it is reconciled")
+        default:
+            utils.WriteError(w, http.StatusInternalServerError, "Failed to process payment")
+        }
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, payment)
+}
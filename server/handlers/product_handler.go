@@ -3,11 +3,17 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"server/cache"
 	"server/models"
 	"server/utils"
 )
 
 func GetAllProducts(w http.ResponseWriter, r *http.Request) {
+	currency, err := utils.RequestCurrency(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	products, err := models.GetAllProducts()
 	if err != nil {
@@ -15,6 +21,14 @@ func GetAllProducts(w http.ResponseWriter, r *http.Request) {
         return
 	}
 
+	products, err = models.LocalizeProducts(products, currency)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, "Failed to price products")
+		return
+	}
+
+	cache.TagResponse(r.Context(), models.ProductCacheTags(products)...)
+
 	// Return the products as JSON
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(products)
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/money"
+	"server/promotions"
+	"server/utils"
+)
+
+func CreatePromotion(w http.ResponseWriter, r *http.Request) {
+    req := promotions.Promotion{IsActive: true}
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    if msg := validatePromotion(&req); msg != "" {
+        utils.WriteError(w, http.StatusBadRequest, msg)
+        return
+    }
+
+    promotion, err := promotions.Create(&req)
+    if err != nil {
+        if errors.Is(err, promotions.ErrCodeExists) {
+            utils.WriteError(w, http.StatusConflict, "Coupon code already exists")
+            return
+        }
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to create promotion")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, promotion)
+}
+
+func ListPromotions(w http.ResponseWriter, r *http.Request) {
+    list, err := promotions.List()
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load promotions")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, list)
+}
+
+func validatePromotion(p *promotions.Promotion) string {
+    if promotions.NormalizeCode(p.Code) == "" {
+        return "Code is required"
+    }
+    if p.MinSubtotal.IsNegative() || p.PerUserLimit < 0 || p.UsageLimit < 0 {
+        return "Limits and minimum subtotal cannot be negative"
+    }
+
+    // Amount and MinSubtotal share the promotion's currency
+    currency := p.Amount.Currency
+    if currency == "" {
+        currency = p.MinSubtotal.Currency
+    }
+    if currency == "" {
+        currency = money.BaseCurrency()
+    }
+    if (p.Amount.Currency != "" && p.Amount.Currency != currency) ||
+        (p.MinSubtotal.Currency != "" && p.MinSubtotal.Currency != currency) {
+        return "amount and min_subtotal must use the same currency"
+    }
+    if !money.IsSupported(currency) {
+        return "Unsupported currency"
+    }
+    p.Amount.Currency, p.MinSubtotal.Currency = currency, currency
+    if p.StartsAt != nil && p.EndsAt != nil && p.EndsAt.Before(*p.StartsAt) {
+        return "ends_at must be after starts_at"
+    }
+
+    switch p.Type {
+    case promotions.TypePercentage:
+        if p.Value <= 0 || p.Value > 100 {
+            return "Percentage value must be between 0 and 100"
+        }
+    case promotions.TypeFixedAmount:
+        if p.Amount.Amount <= 0 {
+            return "Fixed amount must be positive"
+        }
+    case promotions.TypeFreeShipping:
+    case promotions.TypeBuyXGetY:
+        if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+            return "buy_quantity and get_quantity must be positive"
+        }
+        if p.Value < 0 || p.Value > 100 {
+            return "Buy X get Y value must be a percentage between 0 and 100"
+        }
+    default:
+        return "Type must be one of percentage, fixed_amount, free_shipping, buy_x_get_y"
+    }
+
+    return ""
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/middleware"
+	"server/utils"
+)
+
+// GetRateLimitAccessLists returns the CIDR allow and deny lists.
+func GetRateLimitAccessLists(w http.ResponseWriter, r *http.Request) {
+    lists, err := middleware.GetAccessLists(r.Context())
+    if err != nil {
+        utils.WriteError(w, http.StatusServiceUnavailable, "Failed to load access lists")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, lists)
+}
+
+// SetRateLimitAccessLists replaces both lists. Allowed addresses skip rate
+// limits; denied ones get 403 on every rate-limited route.
+func SetRateLimitAccessLists(w http.ResponseWriter, r *http.Request) {
+    var req middleware.AccessLists
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    lists, err := middleware.SetAccessLists(r.Context(), req)
+    if err != nil {
+        if errors.Is(err, middleware.ErrInvalidCIDR) {
+            utils.WriteError(w, http.StatusBadRequest, err.Error())
+            return
+        }
+        utils.WriteError(w, http.StatusServiceUnavailable, "Failed to save access lists")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, lists)
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/models"
+	"server/payments"
+	"server/utils"
+	"strconv"
+	"strings"
+)
+
+type CreateReturnRequest struct {
+    Items   []models.ReturnItem `json:"items"`
+    Reason  string              `json:"reason"`
+    Comment string              `json:"comment"`
+}
+
+type ReturnActionRequest struct {
+    Note string `json:"note"`
+}
+
+type ReceiveReturnRequest struct {
+    Note    string `json:"note"`
+    Restock *bool  `json:"restock"` // Defaults to true
+}
+
+type RefundReturnRequest struct {
+    Note   string `json:"note"`
+    Amount *int64 `json:"amount"` // Minor units; omit to refund everything due
+}
+
+func CreateReturn(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    orderID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+
+    var req CreateReturnRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    req.Comment = strings.TrimSpace(req.Comment)
+    if !models.IsValidReturnReason(req.Reason) {
+        utils.WriteError(w, http.StatusBadRequest, "Reason must be one of damaged, wrong_item, not_as_described, size_fit, no_longer_needed, other")
+        return
+    }
+    if len(req.Comment) > 2000 {
+        utils.WriteError(w, http.StatusBadRequest, "Comment must be at most 2000 characters")
+        return
+    }
+
+    ret, err := models.CreateReturn(orderID, userID, req.Reason, req.Comment, req.Items)
+    if err != nil {
+        writeReturnError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, ret)
+}
+
+func GetMyReturns(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    page := utils.ParsePagination(r)
+    returns, total, err := models.ListUserReturns(userID, page.PageSize, page.Offset())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load returns")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, page.Response(returns, total))
+}
+
+// GetReturnQueue lists returns for staff, requested ones by default.
+func GetReturnQueue(w http.ResponseWriter, r *http.Request) {
+    status := r.URL.Query().Get("status")
+    if status == "" {
+        status = models.ReturnStatusRequested
+    }
+    if !models.IsValidReturnStatus(status) {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid return status")
+        return
+    }
+
+    page := utils.ParsePagination(r)
+    returns, total, err := models.ListReturnsByStatus(status, page.PageSize, page.Offset())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load returns")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, page.Response(returns, total))
+}
+
+func GetReturn(w http.ResponseWriter, r *http.Request) {
+    returnID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid return ID")
+        return
+    }
+
+    ret, err := models.GetReturnByID(returnID)
+    if err != nil {
+        writeReturnError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+func ApproveReturn(w http.ResponseWriter, r *http.Request) {
+    moderateReturn(w, r, models.ApproveReturn)
+}
+
+func RejectReturn(w http.ResponseWriter, r *http.Request) {
+    moderateReturn(w, r, models.RejectReturn)
+}
+
+func moderateReturn(w http.ResponseWriter, r *http.Request, action func(returnID, actorID int, note string) (*models.Return, error)) {
+    actorID, returnID, ok := returnActionParams(w, r)
+    if !ok {
+        return
+    }
+
+    var req ReturnActionRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    ret, err := action(returnID, actorID, strings.TrimSpace(req.Note))
+    if err != nil {
+        writeReturnError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+func ReceiveReturn(w http.ResponseWriter, r *http.Request) {
+    actorID, returnID, ok := returnActionParams(w, r)
+    if !ok {
+        return
+    }
+
+    var req ReceiveReturnRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    restock := req.Restock == nil || *req.Restock
+    ret, err := models.ReceiveReturn(returnID, actorID, strings.TrimSpace(req.Note), restock)
+    if err != nil {
+        writeReturnError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+func RefundReturn(w http.ResponseWriter, r *http.Request) {
+    actorID, returnID, ok := returnActionParams(w, r)
+    if !ok {
+        return
+    }
+
+    var req RefundReturnRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+    if req.Amount != nil && *req.Amount < 0 {
+        utils.WriteError(w, http.StatusBadRequest, "Refund amount cannot be negative")
+        return
+    }
+
+    ret, err := models.RefundReturn(r.Context(), returnID, actorID, req.Amount, strings.TrimSpace(req.Note))
+    if err != nil {
+        writeReturnError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+func returnActionParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+    actorID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return 0, 0, false
+    }
+
+    returnID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid return ID")
+        return 0, 0, false
+    }
+
+    return actorID, returnID, true
+}
+
+func writeReturnError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, models.ErrOrderNotFound):
+        utils.WriteError(w, http.StatusNotFound, "Order not found")
+    case errors.Is(err, models.ErrReturnNotFound):
+        utils.WriteError(w, http.StatusNotFound, "Return not found")
+    case errors.Is(err, models.ErrOrderNotReturnable),
+        errors.Is(err, models.ErrInvalidReturnTransition):
+        utils.WriteError(w, http.StatusConflict, err.Error())
+    case errors.Is(err, models.ErrInvalidReturnItems),
+        errors.Is(err, models.ErrRefundTooLarge):
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+    case errors.Is(err, payments.ErrRefundFailed):
+        utils.WriteError(w, http.StatusBadGateway, err.Error())
+    case errors.Is(err, models.ErrRefundUnsettled):
+        utils.WriteError(w, http.StatusBadGateway, "Refund outcome unknown; the return stays refunding until it is reconciled")
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to process return")
+    }
+}
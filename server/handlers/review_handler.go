@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+)
+
+type CreateReviewRequest struct {
+    Rating int    `json:"rating"`
+    Title  string `json:"title"`
+    Body   string `json:"body"`
+}
+
+type ModerateReviewRequest struct {
+    Note string `json:"note"`
+}
+
+func CreateReview(w http.ResponseWriter, r *http.Request) {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    productID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid product ID")
+        return
+    }
+
+    var req CreateReviewRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    req.Title = strings.TrimSpace(req.Title)
+    req.Body = strings.TrimSpace(req.Body)
+
+    if req.Rating < 1 || req.Rating > 5 {
+        utils.WriteError(w, http.StatusBadRequest, "Rating must be between 1 and 5")
+        return
+    }
+    if req.Title == "" || len(req.Title) > 200 {
+        utils.WriteError(w, http.StatusBadRequest, "Title is required and must be at most 200 characters")
+        return
+    }
+    if len(req.Body) > 5000 {
+        utils.WriteError(w, http.StatusBadRequest, "Review body must be at most 5000 characters")
+        return
+    }
+
+    review, err := models.CreateReview(productID, userID, req.Rating, req.Title, req.Body)
+    if err != nil {
+        switch {
+        case errors.Is(err, models.ErrReviewExists):
+            utils.WriteError(w, http.StatusConflict, "You have already reviewed this product")
+        case errors.Is(err, models.ErrProductNotFound):
+            utils.WriteError(w, http.StatusNotFound, "Product not found")
+        default:
+            utils.WriteError(w, http.StatusInternalServerError, "Failed to create review")
+        }
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, review)
+}
+
+func GetProductReviews(w http.ResponseWriter, r *http.Request) {
+    productID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid product ID")
+        return
+    }
+
+    sort := r.URL.Query().Get("sort")
+    if sort == "" {
+        sort = "newest"
+    }
+    if !models.IsValidReviewSort(sort) {
+        utils.WriteError(w, http.StatusBadRequest, "Sort must be one of newest, oldest, highest, lowest")
+        return
+    }
+
+    page := utils.ParsePagination(r)
+    reviews, total, err := models.ListProductReviews(productID, sort, page.PageSize, page.Offset())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load reviews")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, page.Response(reviews, total))
+}
+
+// GetReviewQueue lists reviews for staff moderation, pending by default.
+func GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+    status := r.URL.Query().Get("status")
+    if status == "" {
+        status = models.ReviewStatusPending
+    }
+    if status != models.ReviewStatusPending && status != models.ReviewStatusApproved && status != models.ReviewStatusRejected {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid review status")
+        return
+    }
+
+    page := utils.ParsePagination(r)
+    reviews, total, err := models.ListReviewsByStatus(status, page.PageSize, page.Offset())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load review queue")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, page.Response(reviews, total))
+}
+
+func ApproveReview(w http.ResponseWriter, r *http.Request) {
+    moderateReview(w, r, models.ReviewStatusApproved)
+}
+
+func RejectReview(w http.ResponseWriter, r *http.Request) {
+    moderateReview(w, r, models.ReviewStatusRejected)
+}
+
+func moderateReview(w http.ResponseWriter, r *http.Request, status string) {
+    moderatorID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+        return
+    }
+
+    reviewID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid review ID")
+        return
+    }
+
+    // The note is optional, so an empty body is fine
+    var req ModerateReviewRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    review, err := models.ModerateReview(reviewID, moderatorID, status, strings.TrimSpace(req.Note))
+    if err != nil {
+        if errors.Is(err, models.ErrReviewNotFound) {
+            utils.WriteError(w, http.StatusNotFound, "Review not found")
+            return
+        }
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to moderate review")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, review)
+}
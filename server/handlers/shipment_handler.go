@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CreateShipmentRequest struct {
+    Carrier        string                `json:"carrier"`
+    TrackingNumber string                `json:"tracking_number"`
+    Items          []models.ShipmentItem `json:"items"` // Empty ships all remaining items
+}
+
+type UpdateShipmentRequest struct {
+    Carrier        string `json:"carrier"`
+    TrackingNumber string `json:"tracking_number"`
+}
+
+type ShipmentEventRequest struct {
+    Status      string     `json:"status"`
+    Description string     `json:"description"`
+    Location    string     `json:"location"`
+    OccurredAt  *time.Time `json:"occurred_at"`
+}
+
+func CreateShipment(w http.ResponseWriter, r *http.Request) {
+    orderID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+
+    var req CreateShipmentRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    req.Carrier = strings.TrimSpace(req.Carrier)
+    req.TrackingNumber = strings.TrimSpace(req.TrackingNumber)
+    if req.Carrier == "" || req.TrackingNumber == "" {
+        utils.WriteError(w, http.StatusBadRequest, "Carrier and tracking number are required")
+        return
+    }
+
+    shipment, err := models.CreateShipment(orderID, req.Carrier, req.TrackingNumber, req.Items)
+    if err != nil {
+        writeShipmentError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, shipment)
+}
+
+func GetOrderShipments(w http.ResponseWriter, r *http.Request) {
+    orderID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid order ID")
+        return
+    }
+
+    shipments, err := models.GetShipmentsByOrder(orderID)
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load shipments")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, shipments)
+}
+
+// GetMyOrderShipments shows the tracking history of one of the caller's
+// orders.
+func GetMyOrderShipments(w http.ResponseWriter, r *http.Request) {
+    order, ok := loadOwnOrder(w, r)
+    if !ok {
+        return
+    }
+
+    shipments, err := models.GetShipmentsByOrder(order.ID)
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load shipments")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, shipments)
+}
+
+func UpdateShipment(w http.ResponseWriter, r *http.Request) {
+    shipmentID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid shipment ID")
+        return
+    }
+
+    var req UpdateShipmentRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    shipment, err := models.UpdateShipment(shipmentID, strings.TrimSpace(req.Carrier), strings.TrimSpace(req.TrackingNumber))
+    if err != nil {
+        writeShipmentError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, shipment)
+}
+
+func AddShipmentEvent(w http.ResponseWriter, r *http.Request) {
+    shipmentID, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid shipment ID")
+        return
+    }
+
+    var req ShipmentEventRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    event := models.ShipmentEvent{
+        Status:      strings.TrimSpace(req.Status),
+        Description: strings.TrimSpace(req.Description),
+        Location:    strings.TrimSpace(req.Location),
+    }
+    if req.OccurredAt != nil {
+        event.OccurredAt = *req.OccurredAt
+    }
+
+    shipment, err := models.AddShipmentEvent(shipmentID, event)
+    if err != nil {
+        writeShipmentError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, shipment)
+}
+
+func writeShipmentError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, models.ErrOrderNotFound):
+        utils.WriteError(w, http.StatusNotFound, "Order not found")
+    case errors.Is(err, models.ErrShipmentNotFound):
+        utils.WriteError(w, http.StatusNotFound, "Shipment not found")
+    case errors.Is(err, models.ErrOrderNotShippable):
+        utils.WriteError(w, http.StatusConflict, err.Error())
+    case errors.Is(err, models.ErrInvalidShipmentItems),
+        errors.Is(err, models.ErrInvalidShipmentStatus):
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to save shipment")
+    }
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/models"
+	"server/shipping"
+	"server/utils"
+)
+
+type ShippingRatesRequest struct {
+    Items           []models.CartItemInput `json:"items"`
+    ShippingAddress models.Address         `json:"shipping_address"`
+}
+
+type ShippingRatesResponse struct {
+    Rates []shipping.Rate `json:"rates"`
+}
+
+// GetShippingRates quotes every shipping method available for the cart and
+// destination, cheapest first. The same rates are charged by /cart/quote
+// and /checkout when the method is passed as shipping_method.
+func GetShippingRates(w http.ResponseWriter, r *http.Request) {
+    var req ShippingRatesRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    if err := req.ShippingAddress.Validate(); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    currency, err := utils.RequestCurrency(r)
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+
+    cart, err := models.BuildCart(0, currency, req.Items)
+    if err != nil {
+        writeCartError(w, err)
+        return
+    }
+
+    rates, err := cart.ShippingRates(shipping.Default(), req.ShippingAddress.ShippingDestination())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to calculate shipping rates")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, ShippingRatesResponse{Rates: rates})
+}
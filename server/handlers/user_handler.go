@@ -9,6 +9,7 @@ import (
 	"os"
 	"server/config"
 	"server/models"
+	"server/notifications"
 	"server/utils"
 	"strings"
 	"time"
@@ -74,7 +75,8 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
     }
 
     // Create user with session
-    user, session, err := models.CreateUser(req.Name, req.Email, hashedPassword, ipAddress, device, deviceID)
+    locale := notifications.MatchLocale(r.Header.Get("Accept-Language"))
+    user, session, err := models.CreateUser(req.Name, req.Email, hashedPassword, locale, ipAddress, device, deviceID)
     if err != nil {
         utils.WriteError(w, http.StatusInternalServerError, "Failed to create user")
         return
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"server/events"
+	"server/utils"
+	"server/webhooks"
+	"strconv"
+	"strings"
+)
+
+type CreateWebhookRequest struct {
+    URL         string   `json:"url"`
+    Description string   `json:"description"`
+    EventTypes  []string `json:"event_types"` // Empty subscribes to every event
+    Secret      string   `json:"secret"`      // Generated when omitted
+}
+
+type UpdateWebhookRequest struct {
+    URL         *string   `json:"url"`
+    Description *string   `json:"description"`
+    EventTypes  *[]string `json:"event_types"`
+    IsActive    *bool     `json:"is_active"` // true re-enables an endpoint disabled for failing
+}
+
+func CreateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+    var req CreateWebhookRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    req.URL = strings.TrimSpace(req.URL)
+    req.Description = strings.TrimSpace(req.Description)
+    if msg := validateWebhook(req.URL, req.Description, req.EventTypes); msg != "" {
+        utils.WriteError(w, http.StatusBadRequest, msg)
+        return
+    }
+
+    if req.Secret == "" {
+        secret, err := webhooks.NewSecret()
+        if err != nil {
+            utils.WriteError(w, http.StatusInternalServerError, "Failed to generate secret")
+            return
+        }
+        req.Secret = secret
+    } else if len(req.Secret) < 16 {
+        utils.WriteError(w, http.StatusBadRequest, "Secret must be at least 16 characters")
+        return
+    }
+
+    endpoint, err := webhooks.CreateEndpoint(req.URL, req.Description, req.Secret, normalizeEventTypes(req.EventTypes))
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to create webhook")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusCreated, endpoint)
+}
+
+func GetWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+    endpoints, err := webhooks.ListEndpoints()
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load webhooks")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, endpoints)
+}
+
+func GetWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+        return
+    }
+
+    endpoint, err := webhooks.GetEndpoint(id)
+    if err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, endpoint)
+}
+
+func UpdateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+        return
+    }
+
+    var req UpdateWebhookRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid JSON format")
+        return
+    }
+
+    endpoint, err := webhooks.GetEndpoint(id)
+    if err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    if req.URL != nil {
+        endpoint.URL = strings.TrimSpace(*req.URL)
+    }
+    if req.Description != nil {
+        endpoint.Description = strings.TrimSpace(*req.Description)
+    }
+    if req.EventTypes != nil {
+        endpoint.EventTypes = *req.EventTypes
+    }
+    if req.IsActive != nil {
+        endpoint.IsActive = *req.IsActive
+    }
+    if msg := validateWebhook(endpoint.URL, endpoint.Description, endpoint.EventTypes); msg != "" {
+        utils.WriteError(w, http.StatusBadRequest, msg)
+        return
+    }
+
+    endpoint, err = webhooks.UpdateEndpoint(id, endpoint.URL, endpoint.Description, normalizeEventTypes(endpoint.EventTypes), endpoint.IsActive)
+    if err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, endpoint)
+}
+
+func DeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+        return
+    }
+
+    if err := webhooks.DeleteEndpoint(id); err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    w.WriteHeader(http.StatusNoContent)
+}
+
+// RotateWebhookSecret issues a new signing secret. Deliveries sent after
+// this are signed with the new secret only.
+func RotateWebhookSecret(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+        return
+    }
+
+    endpoint, err := webhooks.RotateSecret(id)
+    if err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, endpoint)
+}
+
+// GetWebhookDeliveries returns an endpoint's delivery log, optionally
+// filtered by ?status=pending|succeeded|failed.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid webhook ID")
+        return
+    }
+
+    status := r.URL.Query().Get("status")
+    switch status {
+    case "", webhooks.DeliveryPending, webhooks.DeliverySucceeded, webhooks.DeliveryFailed:
+    default:
+        utils.WriteError(w, http.StatusBadRequest, "Status must be one of pending, succeeded, failed")
+        return
+    }
+
+    if _, err := webhooks.GetEndpoint(id); err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    page := utils.ParsePagination(r)
+    deliveries, total, err := webhooks.ListDeliveries(id, status, page.PageSize, page.Offset())
+    if err != nil {
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to load deliveries")
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusOK, page.Response(deliveries, total))
+}
+
+// RedeliverWebhook queues a delivery to be sent again. The endpoint
+// receives the same event ID, so receivers can deduplicate.
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+    id, err := strconv.Atoi(r.PathValue("id"))
+    if err != nil {
+        utils.WriteError(w, http.StatusBadRequest, "Invalid delivery ID")
+        return
+    }
+
+    delivery, err := webhooks.Redeliver(id)
+    if err != nil {
+        writeWebhookError(w, err)
+        return
+    }
+
+    utils.WriteJSON(w, http.StatusAccepted, delivery)
+}
+
+func validateWebhook(rawURL, description string, eventTypes []string) string {
+    u, err := url.Parse(rawURL)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+        return "URL must be an absolute http or https URL"
+    }
+    if len(rawURL) > 2000 {
+        return "URL must be at most 2000 characters"
+    }
+    if len(description) > 500 {
+        return "Description must be at most 500 characters"
+    }
+    for _, eventType := range eventTypes {
+        if eventType != events.AllEvents && !events.IsValidType(eventType) {
+            return "Unknown event type: " + eventType
+        }
+    }
+    return ""
+}
+
+// normalizeEventTypes removes duplicates; "*" anywhere means every event.
+func normalizeEventTypes(eventTypes []string) []string {
+    seen := make(map[string]bool)
+    result := []string{}
+    for _, eventType := range eventTypes {
+        if eventType == events.AllEvents {
+            return []string{}
+        }
+        if !seen[eventType] {
+            seen[eventType] = true
+            result = append(result, eventType)
+        }
+    }
+    return result
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+    switch {
+    case errors.Is(err, webhooks.ErrEndpointNotFound):
+        utils.WriteError(w, http.StatusNotFound, "Webhook not found")
+    case errors.Is(err, webhooks.ErrDeliveryNotFound):
+        utils.WriteError(w, http.StatusNotFound, "Delivery not found")
+    default:
+        utils.WriteError(w, http.StatusInternalServerError, "Failed to process webhook")
+    }
+}
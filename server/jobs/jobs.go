@@ -0,0 +1,375 @@
+// Package jobs runs scheduled maintenance tasks. Every server instance
+// runs the scheduler; a Redis lock makes sure each run happens on one
+// instance only.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+    ErrJobNotFound   = errors.New("job not found")
+    ErrJobRunning    = errors.New("job is already running")
+    ErrNotConfigured = errors.New("jobs are not configured")
+)
+
+// Func does one run of a job and reports how many items it processed.
+type Func func(ctx context.Context) (int, error)
+
+type Job struct {
+    Name        string
+    Description string
+    Schedule    Schedule
+    Timeout     time.Duration // Defaults to DefaultTimeout
+    Run         Func
+}
+
+const DefaultTimeout = 5 * time.Minute
+
+const (
+    TriggerSchedule = "schedule"
+    TriggerManual   = "manual"
+)
+
+var (
+    mu       sync.RWMutex
+    registry = make(map[string]*Job)
+    client   *redis.Client
+    instance = instanceID()
+)
+
+// Register adds a job. Register jobs before calling Start.
+func Register(job Job) {
+    if job.Timeout <= 0 {
+        job.Timeout = DefaultTimeout
+    }
+
+    mu.Lock()
+    defer mu.Unlock()
+    registry[job.Name] = &job
+}
+
+// SetRedis sets the client used for locks and metrics. Manual triggers
+// work once it is set, even on instances that do not run the scheduler.
+func SetRedis(rdb *redis.Client) {
+    mu.Lock()
+    defer mu.Unlock()
+    client = rdb
+}
+
+// Start runs the scheduler for every registered job until ctx is
+// cancelled.
+func Start(ctx context.Context) {
+    mu.RLock()
+    defer mu.RUnlock()
+
+    for _, job := range registry {
+        go schedule(ctx, job)
+    }
+}
+
+func schedule(ctx context.Context, job *Job) {
+    for {
+        next := job.Schedule.Next(time.Now())
+        if next.IsZero() {
+            log.Printf("Job %s: schedule %s never fires", job.Name, job.Schedule)
+            return
+        }
+
+        timer := time.NewTimer(time.Until(next))
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return
+        case <-timer.C:
+        }
+
+        release, err := acquire(ctx, job, next.Unix())
+        if err != nil {
+            if !errors.Is(err, ErrJobRunning) && !errors.Is(err, errSlotTaken) {
+                log.Printf("Job %s: not started: %v", job.Name, err)
+            }
+            continue
+        }
+        execute(ctx, job, TriggerSchedule, release)
+    }
+}
+
+// Trigger starts a job now, outside its schedule. The run happens in the
+// background; its outcome shows up in the job's metrics.
+func Trigger(ctx context.Context, name string) error {
+    job, err := lookup(name)
+    if err != nil {
+        return err
+    }
+
+    release, err := acquire(ctx, job, 0)
+    if err != nil {
+        return err
+    }
+
+    go execute(context.Background(), job, TriggerManual, release)
+    return nil
+}
+
+func lookup(name string) (*Job, error) {
+    mu.RLock()
+    defer mu.RUnlock()
+
+    job, ok := registry[name]
+    if !ok {
+        return nil, ErrJobNotFound
+    }
+    return job, nil
+}
+
+func redisClient() *redis.Client {
+    mu.RLock()
+    defer mu.RUnlock()
+    return client
+}
+
+var errSlotTaken = errors.New("scheduled run already claimed")
+
+// acquireScript takes the job's lock unless it is held, and for scheduled
+// runs also claims the slot so an instance whose timer fires late does not
+// repeat a run another instance already finished.
+var acquireScript = redis.NewScript(`
+    if redis.call('EXISTS', KEYS[1]) == 1 then
+        return 0
+    end
+    local slot = tonumber(ARGV[3])
+    if slot > 0 then
+        local last = tonumber(redis.call('GET', KEYS[2]) or '0')
+        if last >= slot then
+            return -1
+        end
+        redis.call('SET', KEYS[2], slot, 'PX', ARGV[4])
+    end
+    redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+    return 1
+`)
+
+// releaseScript deletes the lock only if this run still owns it.
+var releaseScript = redis.NewScript(`
+    if redis.call('GET', KEYS[1]) == ARGV[1] then
+        return redis.call('DEL', KEYS[1])
+    end
+    return 0
+`)
+
+// Slot claims outlive any interval a job is likely to use
+const slotRetention = 7 * 24 * time.Hour
+
+func lockKey(name string) string    { return "jobs:lock:" + name }
+func slotKey(name string) string    { return "jobs:slot:" + name }
+func metricsKey(name string) string { return "jobs:metrics:" + name }
+
+func acquire(ctx context.Context, job *Job, slot int64) (func(), error) {
+    rdb := redisClient()
+    if rdb == nil {
+        return nil, ErrNotConfigured
+    }
+
+    token, err := newToken()
+    if err != nil {
+        return nil, err
+    }
+
+    // The lock outlives the run's timeout so a crashed instance frees it
+    ttl := job.Timeout + time.Minute
+    result, err := acquireScript.Run(ctx, rdb,
+        []string{lockKey(job.Name), slotKey(job.Name)},
+        token, ttl.Milliseconds(), slot, slotRetention.Milliseconds(),
+    ).Int()
+    if err != nil {
+        return nil, err
+    }
+    switch result {
+    case 0:
+        return nil, ErrJobRunning
+    case -1:
+        return nil, errSlotTaken
+    }
+
+    return func() {
+        if err := releaseScript.Run(context.Background(), rdb, []string{lockKey(job.Name)}, token).Err(); err != nil {
+            log.Printf("Job %s: failed to release lock: %v", job.Name, err)
+        }
+    }, nil
+}
+
+func execute(ctx context.Context, job *Job, trigger string, release func()) {
+    defer release()
+
+    runCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+    defer cancel()
+
+    started := time.Now()
+    processed, err := run(runCtx, job)
+    duration := time.Since(started)
+
+    if err != nil {
+        log.Printf("Job %s (%s) failed after %s: %v", job.Name, trigger, duration, err)
+    } else if processed > 0 {
+        log.Printf("Job %s (%s) processed %d items in %s", job.Name, trigger, processed, duration)
+    }
+
+    recordRun(job.Name, trigger, started, duration, processed, err)
+}
+
+func run(ctx context.Context, job *Job) (processed int, err error) {
+    defer func() {
+        if r := recover(); r != nil {
+            err = fmt.Errorf("job panicked: %v", r)
+        }
+    }()
+    return job.Run(ctx)
+}
+
+func recordRun(name, trigger string, started time.Time, duration time.Duration, processed int, runErr error) {
+    rdb := redisClient()
+    if rdb == nil {
+        return
+    }
+
+    status, lastError := "succeeded", ""
+    if runErr != nil {
+        status, lastError = "failed", runErr.Error()
+    }
+
+    ctx := context.Background()
+    pipe := rdb.TxPipeline()
+    key := metricsKey(name)
+    pipe.HIncrBy(ctx, key, "runs", 1)
+    if runErr != nil {
+        pipe.HIncrBy(ctx, key, "failures", 1)
+    }
+    pipe.HIncrBy(ctx, key, "total_processed", int64(processed))
+    pipe.HIncrBy(ctx, key, "total_duration_ms", duration.Milliseconds())
+    pipe.HSet(ctx, key,
+        "last_status", status,
+        "last_error", lastError,
+        "last_trigger", trigger,
+        "last_instance", instance,
+        "last_started_at", started.UTC().Format(time.RFC3339),
+        "last_duration_ms", duration.Milliseconds(),
+        "last_processed", processed,
+    )
+    if _, err := pipe.Exec(ctx); err != nil {
+        log.Printf("Job %s: failed to record metrics: %v", name, err)
+    }
+}
+
+// Status describes a job and its metrics, aggregated across instances.
+type Status struct {
+    Name           string     `json:"name"`
+    Description    string     `json:"description"`
+    Schedule       string     `json:"schedule"`
+    NextRunAt      *time.Time `json:"next_run_at,omitempty"`
+    Running        bool       `json:"running"`
+    Runs           int64      `json:"runs"`
+    Failures       int64      `json:"failures"`
+    TotalProcessed int64      `json:"total_processed"`
+    AvgDurationMS  int64      `json:"avg_duration_ms"`
+    LastStatus     string     `json:"last_status,omitempty"`
+    LastError      string     `json:"last_error,omitempty"`
+    LastTrigger    string     `json:"last_trigger,omitempty"`
+    LastInstance   string     `json:"last_instance,omitempty"`
+    LastStartedAt  *time.Time `json:"last_started_at,omitempty"`
+    LastDurationMS int64      `json:"last_duration_ms"`
+    LastProcessed  int64      `json:"last_processed"`
+}
+
+// List returns the status of every registered job, sorted by name.
+func List(ctx context.Context) ([]Status, error) {
+    mu.RLock()
+    jobs := make([]*Job, 0, len(registry))
+    for _, job := range registry {
+        jobs = append(jobs, job)
+    }
+    mu.RUnlock()
+    sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+
+    rdb := redisClient()
+    if rdb == nil {
+        return nil, ErrNotConfigured
+    }
+
+    pipe := rdb.Pipeline()
+    metrics := make([]*redis.MapStringStringCmd, len(jobs))
+    running := make([]*redis.IntCmd, len(jobs))
+    for i, job := range jobs {
+        metrics[i] = pipe.HGetAll(ctx, metricsKey(job.Name))
+        running[i] = pipe.Exists(ctx, lockKey(job.Name))
+    }
+    if _, err := pipe.Exec(ctx); err != nil {
+        return nil, err
+    }
+
+    now := time.Now()
+    statuses := make([]Status, 0, len(jobs))
+    for i, job := range jobs {
+        m := metrics[i].Val()
+        status := Status{
+            Name:           job.Name,
+            Description:    job.Description,
+            Schedule:       job.Schedule.String(),
+            Running:        running[i].Val() > 0,
+            Runs:           parseInt(m["runs"]),
+            Failures:       parseInt(m["failures"]),
+            TotalProcessed: parseInt(m["total_processed"]),
+            LastStatus:     m["last_status"],
+            LastError:      m["last_error"],
+            LastTrigger:    m["last_trigger"],
+            LastInstance:   m["last_instance"],
+            LastDurationMS: parseInt(m["last_duration_ms"]),
+            LastProcessed:  parseInt(m["last_processed"]),
+        }
+        if status.Runs > 0 {
+            status.AvgDurationMS = parseInt(m["total_duration_ms"]) / status.Runs
+        }
+        if next := job.Schedule.Next(now); !next.IsZero() {
+            status.NextRunAt = &next
+        }
+        if started, err := time.Parse(time.RFC3339, m["last_started_at"]); err == nil {
+            status.LastStartedAt = &started
+        }
+        statuses = append(statuses, status)
+    }
+
+    return statuses, nil
+}
+
+func parseInt(s string) int64 {
+    n, _ := strconv.ParseInt(s, 10, 64)
+    return n
+}
+
+func newToken() (string, error) {
+    buf := make([]byte, 16)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(buf), nil
+}
+
+func instanceID() string {
+    host, err := os.Hostname()
+    if err != nil {
+        host = "unknown"
+    }
+    return host + ":" + strconv.Itoa(os.Getpid())
+}
@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a job runs next. Every instance must compute the
+// same times for the leader lock to deduplicate runs, so schedules only
+// depend on the clock.
+type Schedule interface {
+    Next(after time.Time) time.Time
+    String() string
+}
+
+type interval time.Duration
+
+// Every runs a job at fixed intervals aligned to the Unix epoch, e.g.
+// Every(time.Hour) fires on the hour.
+func Every(d time.Duration) Schedule {
+    if d < time.Second {
+        d = time.Second
+    }
+    return interval(d)
+}
+
+func (i interval) Next(after time.Time) time.Time {
+    d := time.Duration(i)
+    return after.Truncate(d).Add(d)
+}
+
+func (i interval) String() string {
+    return "every " + time.Duration(i).String()
+}
+
+// cron is a five-field cron expression: minute, hour, day of month, month
+// and day of week, each holding the allowed values as a bitset.
+type cron struct {
+    expr                          string
+    minute, hour, dom, month, dow uint64
+    domRestricted, dowRestricted  bool
+}
+
+type cronField struct {
+    name     string
+    min, max int
+}
+
+var cronFields = []cronField{
+    {"minute", 0, 59},
+    {"hour", 0, 23},
+    {"day of month", 1, 31},
+    {"month", 1, 12},
+    {"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// ParseCron parses a standard five-field cron expression. Fields accept
+// "*", single values, ranges "a-b", steps "*/n" or "a-b/n", and
+// comma-separated lists of those. Times are evaluated in UTC.
+func ParseCron(expr string) (Schedule, error) {
+    fields := strings.Fields(expr)
+    if len(fields) != len(cronFields) {
+        return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+    }
+
+    sets := make([]uint64, len(fields))
+    for i, field := range fields {
+        set, err := parseCronField(field, cronFields[i])
+        if err != nil {
+            return nil, fmt.Errorf("cron expression %q: %w", expr, err)
+        }
+        sets[i] = set
+    }
+
+    // Sunday may be written as 7
+    dow := sets[4]
+    if dow&(1<<7) != 0 {
+        dow |= 1
+    }
+
+    return &cron{
+        expr:          expr,
+        minute:        sets[0],
+        hour:          sets[1],
+        dom:           sets[2],
+        month:         sets[3],
+        dow:           dow,
+        domRestricted: !strings.HasPrefix(fields[2], "*"),
+        dowRestricted: !strings.HasPrefix(fields[4], "*"),
+    }, nil
+}
+
+// MustParseCron is ParseCron for schedules written in code.
+func MustParseCron(expr string) Schedule {
+    s, err := ParseCron(expr)
+    if err != nil {
+        panic(err)
+    }
+    return s
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+    var set uint64
+    for _, part := range strings.Split(field, ",") {
+        rangePart, stepPart, hasStep := strings.Cut(part, "/")
+        step := 1
+        if hasStep {
+            n, err := strconv.Atoi(stepPart)
+            if err != nil || n <= 0 {
+                return 0, fmt.Errorf("invalid step %q in %s", stepPart, spec.name)
+            }
+            step = n
+        }
+
+        lo, hi := spec.min, spec.max
+        if rangePart != "*" {
+            from, to, isRange := strings.Cut(rangePart, "-")
+            var err error
+            if lo, err = strconv.Atoi(from); err != nil {
+                return 0, fmt.Errorf("invalid value %q in %s", from, spec.name)
+            }
+            hi = lo
+            if isRange {
+                if hi, err = strconv.Atoi(to); err != nil {
+                    return 0, fmt.Errorf("invalid value %q in %s", to, spec.name)
+                }
+            } else if hasStep {
+                hi = spec.max
+            }
+        }
+        if lo < spec.min || hi > spec.max || lo > hi {
+            return 0, fmt.Errorf("%s must be within %d-%d", spec.name, spec.min, spec.max)
+        }
+
+        for v := lo; v <= hi; v += step {
+            set |= 1 << uint(v)
+        }
+    }
+    return set, nil
+}
+
+func (c *cron) Next(after time.Time) time.Time {
+    t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+
+    // Five years covers every valid expression, including Feb 29
+    limit := t.AddDate(5, 0, 0)
+    for t.Before(limit) {
+        if c.month&(1<<uint(t.Month())) == 0 {
+            t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+            continue
+        }
+        if !c.dayMatches(t) {
+            t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+            continue
+        }
+        if c.hour&(1<<uint(t.Hour())) == 0 {
+            t = t.Truncate(time.Hour).Add(time.Hour)
+            continue
+        }
+        if c.minute&(1<<uint(t.Minute())) == 0 {
+            t = t.Add(time.Minute)
+            continue
+        }
+        return t
+    }
+
+    // Unreachable for a parsed expression such as "0 0 31 2 *"; never run
+    return time.Time{}
+}
+
+// dayMatches follows cron's rule that when both day fields are restricted
+// a day matching either one is enough. A field starting with "*", such as
+// "*/2", is not restricted.
+func (c *cron) dayMatches(t time.Time) bool {
+    dom := c.dom&(1<<uint(t.Day())) != 0
+    dow := c.dow&(1<<uint(t.Weekday())) != 0
+    if c.domRestricted && c.dowRestricted {
+        return dom || dow
+    }
+    return dom && dow
+}
+
+func (c *cron) String() string {
+    return c.expr
+}
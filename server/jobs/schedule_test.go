@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+    tests := []struct {
+        expr    string
+        wantErr bool
+    }{
+        {"* * * * *", false},
+        {"*/15 0-6/2 1,15 1-12 1-5", false},
+        {"0 0 * * 7", false},
+        {"0 0 30 2 *", false},
+        {"* * * *", true},
+        {"* * * * * *", true},
+        {"60 * * * *", true},
+        {"* 24 * * *", true},
+        {"* * 0 * *", true},
+        {"* * * 13 *", true},
+        {"* * * * 8", true},
+        {"*/0 * * * *", true},
+        {"5-1 * * * *", true},
+        {"a * * * *", true},
+    }
+
+    for _, tt := range tests {
+        _, err := ParseCron(tt.expr)
+        if (err != nil) != tt.wantErr {
+            t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+        }
+    }
+}
+
+func TestCronNext(t *testing.T) {
+    // A Monday
+    after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+    tests := []struct {
+        name string
+        expr string
+        want time.Time
+    }{
+        {"every minute", "* * * * *", time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)},
+        {"minute step", "*/15 * * * *", time.Date(2024, 1, 1, 0, 15, 0, 0, time.UTC)},
+        {"hour step", "0 */6 * * *", time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)},
+        {"range with step", "30 9-17/4 * * *", time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)},
+        {"hour range", "0 1-2 * * *", time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)},
+        {"list", "0 0 10,20 * *", time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)},
+        {"month range", "0 0 1 3-5 *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+        {"sunday as 0", "0 0 * * 0", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+        {"sunday as 7", "0 0 * * 7", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+        {"weekday range", "0 8 * * 6-7", time.Date(2024, 1, 6, 8, 0, 0, 0, time.UTC)},
+        {"dom or dow", "0 0 15 * 5", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+        {"dom or dow, dom first", "0 0 3 * 5", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+        {"stepped dom and dow", "0 0 */2 * 5", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+        {"dom and stepped dow", "0 0 2 * */3", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+        {"leap day", "0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+        {"impossible date", "0 0 30 2 *", time.Time{}},
+        {"impossible day of month", "0 0 31 4,6,9,11 *", time.Time{}},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            s, err := ParseCron(tt.expr)
+            if err != nil {
+                t.Fatalf("ParseCron(%q): %v", tt.expr, err)
+            }
+            if got := s.Next(after); !got.Equal(tt.want) {
+                t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestCronNextIsAfter(t *testing.T) {
+    s := MustParseCron("30 * * * *")
+    after := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+    want := time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC)
+    if got := s.Next(after); !got.Equal(want) {
+        t.Errorf("Next = %v, want %v", got, want)
+    }
+}
+
+func TestEveryNext(t *testing.T) {
+    after := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+    want := time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)
+    if got := Every(15 * time.Minute).Next(after); !got.Equal(want) {
+        t.Errorf("Next = %v, want %v", got, want)
+    }
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"server/cache"
 	"server/config"
+	"server/events"
+	"server/jobs"
+	"server/models"
 	"server/routes"
+	"server/webhooks"
 
 	"github.com/joho/godotenv"
 )
@@ -31,6 +37,78 @@ func main() {
     if err := cache.InitCache(); err != nil {
         log.Fatal("Failed to initialize cache:", err)
     }
+    cache.DefaultCache.StartInvalidationListener(context.Background())
+
+    if err := config.InitCurrency(); err != nil {
+        log.Fatal("Failed to initialize currencies:", err)
+    }
+
+    if err := config.InitTax(); err != nil {
+        log.Fatal("Failed to initialize tax rates:", err)
+    }
+
+    if err := config.InitShipping(); err != nil {
+        log.Fatal("Failed to initialize shipping methods:", err)
+    }
+
+    if err := config.InitPayments(); err != nil {
+        log.Fatal("Failed to initialize payments:", err)
+    }
+
+    if err := config.InitNotifications(); err != nil {
+        log.Fatal("Failed to initialize notifications:", err)
+    }
+
+    if err := config.InitCartRecovery(); err != nil {
+        log.Fatal("Failed to initialize cart recovery:", err)
+    }
+
+    if err := config.InitProxies(); err != nil {
+        log.Fatal("Failed to initialize trusted proxies:", err)
+    }
+
+    // Register event subscribers before the outbox dispatcher starts
+    events.Subscribe(events.ProductUpdated, cache.OnProductUpdated)
+    events.Subscribe(events.AllEvents, webhooks.OnEvent)
+    events.Subscribe(events.OrderPaid, models.OnOrderPaid)
+    events.Subscribe(events.OrderShipped, models.OnOrderShipped)
+    events.Subscribe(events.OrderDelivered, models.OnOrderDelivered)
+    config.StartEvents(context.Background())
+    config.StartNotifications(context.Background())
+    webhooks.NewWorker(webhooks.DefaultWorkerConfig).Start(context.Background())
+
+    // Scheduled maintenance; each run happens on one instance only
+    jobs.Register(jobs.Job{
+        Name:        "session-cleanup",
+        Description: "Delete expired user sessions",
+        Schedule:    jobs.MustParseCron("15 * * * *"),
+        Run:         models.DeleteExpiredSessions,
+    })
+    jobs.Register(jobs.Job{
+        Name:        "blacklist-cleanup",
+        Description: "Delete expired blacklisted tokens",
+        Schedule:    jobs.MustParseCron("45 * * * *"),
+        Run:         models.DeleteExpiredBlacklistedTokens,
+    })
+    jobs.Register(jobs.Job{
+        Name:        "password-reset-cleanup",
+        Description: "Delete expired password reset tokens",
+        Schedule:    jobs.MustParseCron("30 3 * * *"),
+        Run:         models.DeleteExpiredPasswordResets,
+    })
+    jobs.Register(jobs.Job{
+        Name:        "cart-reminders",
+        Description: "Email reminders for carts left idle past CART_REMINDER_INTERVALS",
+        Schedule:    jobs.Every(15 * time.Minute),
+        Run:         models.SendCartReminders,
+    })
+    jobs.Register(jobs.Job{
+        Name:        "payment-reconcile",
+        Description: "Settle payments, refunds and returns left unfinished by a crash or provider timeout",
+        Schedule:    jobs.Every(5 * time.Minute),
+        Run:         models.ReconcilePayments,
+    })
+    config.StartJobs(context.Background())
 
     // Setup routes
     mux := routes.SetupRoutes()
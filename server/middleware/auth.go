@@ -3,7 +3,9 @@ package middleware
 
 import (
 	"context"
+	"database/sql"
 	"net/http"
+	"server/models"
 	"server/utils"
 	"strings"
 )
@@ -29,11 +31,76 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
             return
         }
 
-        // Add user info to context
-        ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-        ctx = context.WithValue(ctx, "email", claims.Email)
-        ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+        next.ServeHTTP(w, r.WithContext(withClaims(r.Context(), claims)))
+    }
+}
+
+// OptionalAuthMiddleware adds user info to the context when a valid access
+// token is present, but lets anonymous requests through unchanged.
+func OptionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        token := r.Header.Get("Authorization")
+        if token == "" {
+            if cookie, err := r.Cookie("access_token"); err == nil {
+                token = cookie.Value
+            }
+        }
+
+        if token != "" {
+            claims, err := utils.ValidateToken(strings.TrimPrefix(token, "Bearer "))
+            if err == nil && claims.TokenType == "access" {
+                r = r.WithContext(withClaims(r.Context(), claims))
+            }
+        }
+
+        next.ServeHTTP(w, r)
+    }
+}
+
+// Add user info to context
+func withClaims(ctx context.Context, claims *utils.Claims) context.Context {
+    ctx = context.WithValue(ctx, "user_id", claims.UserID)
+    ctx = context.WithValue(ctx, "email", claims.Email)
+    ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+    return ctx
+}
+
+// StaffMiddleware restricts a route to staff and admin users. It must be
+// applied after AuthMiddleware so the user ID is on the context.
+func StaffMiddleware(next http.HandlerFunc) http.HandlerFunc {
+    return requireUser(next, (*models.User).IsStaff, "Staff access required")
+}
+
+// AdminMiddleware restricts a route to admin users, for settings that
+// reach outside the store such as webhooks. Apply after AuthMiddleware.
+func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+    return requireUser(next, (*models.User).IsAdmin, "Admin access required")
+}
+
+func requireUser(next http.HandlerFunc, allowed func(*models.User) bool, denied string) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        userID, ok := utils.UserIDFromContext(r.Context())
+        if !ok {
+            utils.WriteError(w, http.StatusUnauthorized, "Access token required")
+            return
+        }
+
+        // The cached user may hold a stale role
+        role, err := models.GetUserRole(userID)
+        if err == sql.ErrNoRows {
+            utils.WriteError(w, http.StatusUnauthorized, "User not found")
+            return
+        }
+        if err != nil {
+            utils.WriteError(w, http.StatusInternalServerError, "Database error")
+            return
+        }
+
+        if !allowed(&models.User{ID: userID, Role: role}) {
+            utils.WriteError(w, http.StatusForbidden, denied)
+            return
+        }
 
-        next.ServeHTTP(w, r.WithContext(ctx))
+        next.ServeHTTP(w, r)
     }
 }
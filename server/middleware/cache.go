@@ -7,15 +7,19 @@ import (
 	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"server/cache"
+	"server/utils"
 )
 
 type ResponseCache struct {
     StatusCode int                 `json:"status_code"`
     Headers    map[string][]string `json:"headers"`
     Body       []byte              `json:"body"`
+    ETag       string              `json:"etag"`
     CachedAt   time.Time           `json:"cached_at"`
 }
 
@@ -35,7 +39,74 @@ func (rw *responseWriter) WriteHeader(statusCode int) {
     rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// bufferedWriter holds the whole response back, so validators computed
+// from the body can still be sent as headers.
+type bufferedWriter struct {
+    header     http.Header
+    statusCode int
+    body       bytes.Buffer
+}
+
+func (bw *bufferedWriter) Header() http.Header {
+    return bw.header
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+    return bw.body.Write(b)
+}
+
+func (bw *bufferedWriter) WriteHeader(statusCode int) {
+    bw.statusCode = statusCode
+}
+
+// CachePolicy controls how APICacheMiddleware caches a route.
+type CachePolicy struct {
+    TTL         time.Duration // Also the max-age sent to clients
+    VaryHeaders []string      // Request headers that select a representation
+    VaryCookies []string      // Cookies that select a representation
+
+    // Private responses belong to one user: they are cached per user ID
+    // and sent with Cache-Control: private. The middleware must then run
+    // after AuthMiddleware or OptionalAuthMiddleware. Public routes do not
+    // cache requests that carry credentials.
+    Private bool
+
+    // Lets a request with Cache-Control: no-cache skip the cached copy;
+    // the fresh response replaces it
+    AllowNoCacheBypass bool
+
+    MaxBodySize int // Larger responses are sent but not cached
+}
+
+// DefaultCachePolicy is the policy of APICacheMiddleware, apart from TTL.
+var DefaultCachePolicy = CachePolicy{
+    TTL:                cache.APIResponseCacheConfig.TTL,
+    VaryHeaders:        []string{"Accept", "Accept-Language", "Accept-Encoding", "Accept-Currency"},
+    AllowNoCacheBypass: true,
+    MaxBodySize:        1 << 20,
+}
+
+// Headers set by the middleware itself, which are not stored with a
+// response
+var cacheControlHeaders = []string{"X-Cache", "X-Cache-Date", "Age", "ETag", "Last-Modified", "Cache-Control", "Vary"}
+
+// APICacheMiddleware caches GET responses in Redis for cacheDuration with
+// DefaultCachePolicy. Responses carry a strong ETag and Last-Modified,
+// cached or not, so clients and CDNs can revalidate with If-None-Match or
+// If-Modified-Since and get a 304.
 func APICacheMiddleware(cacheDuration time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+    policy := DefaultCachePolicy
+    policy.TTL = cacheDuration
+    return APICacheMiddlewareWithPolicy(policy)
+}
+
+func APICacheMiddlewareWithPolicy(policy CachePolicy) func(http.HandlerFunc) http.HandlerFunc {
+    if policy.TTL <= 0 {
+        policy.TTL = cache.APIResponseCacheConfig.TTL
+    }
+    cacheConfig := cache.APIResponseCacheConfig
+    cacheConfig.TTL = policy.TTL
+
     return func(next http.HandlerFunc) http.HandlerFunc {
         return func(w http.ResponseWriter, r *http.Request) {
             // Only cache GET requests
@@ -44,82 +115,195 @@ func APICacheMiddleware(cacheDuration time.Duration) func(http.HandlerFunc) http
                 return
             }
 
-            // Skip caching for authenticated requests with user-specific data
-            if r.Header.Get("Authorization") != "" {
+            // Responses for a signed-in user must never reach the shared
+            // cache of a public route, nor another user's entry
+            identity, ok := cacheIdentity(r, policy)
+            if !ok {
                 next.ServeHTTP(w, r)
                 return
             }
 
             ctx := r.Context()
-            cacheKey := generateCacheKey(r)
+            cacheKey := generateCacheKey(r, policy, identity)
 
             // Try to get from cache
-            var cachedResponse ResponseCache
-            found, err := cache.DefaultCache.Get(ctx, cacheKey, cache.APIResponseCacheConfig, &cachedResponse)
-            
-            if err == nil && found {
-                // Serve from cache
-                w.Header().Set("X-Cache", "HIT")
-                w.Header().Set("X-Cache-Date", cachedResponse.CachedAt.Format(time.RFC3339))
-                
-                // Set original headers
-                for key, values := range cachedResponse.Headers {
-                    for _, value := range values {
-                        w.Header().Add(key, value)
+            bypass := policy.AllowNoCacheBypass && requestsNoCache(r)
+            if !bypass {
+                var cachedResponse ResponseCache
+                found, err := cache.DefaultCache.Get(ctx, cacheKey, cacheConfig, &cachedResponse)
+                if err == nil && found {
+                    // Serve from cache
+                    w.Header().Set("X-Cache", "HIT")
+                    w.Header().Set("X-Cache-Date", cachedResponse.CachedAt.Format(time.RFC3339))
+                    w.Header().Set("Age", strconv.Itoa(int(time.Since(cachedResponse.CachedAt).Seconds())))
+
+                    // Set original headers
+                    for key, values := range cachedResponse.Headers {
+                        w.Header()[key] = append([]string(nil), values...)
                     }
+
+                    writeCacheable(w, r, policy, cachedResponse.StatusCode, cachedResponse.Body, cachedResponse.ETag, cachedResponse.CachedAt)
+                    return
                 }
-                
-                w.WriteHeader(cachedResponse.StatusCode)
-                w.Write(cachedResponse.Body)
+            }
+
+            // Cache miss - execute request; only headers set by the
+            // handler belong to the stored response
+            before := w.Header().Clone()
+            bw := &bufferedWriter{
+                header:     w.Header(),
+                statusCode: http.StatusOK,
+            }
+
+            // Handlers tag the response with what it contains, e.g. products
+            tagCtx, collectedTags := cache.WithTagCollector(ctx)
+            next.ServeHTTP(bw, r.WithContext(tagCtx))
+
+            // Only successful responses are cached or get validators
+            if bw.statusCode < 200 || bw.statusCode >= 300 {
+                w.WriteHeader(bw.statusCode)
+                w.Write(bw.body.Bytes())
                 return
             }
 
-            // Cache miss - execute request
-            w.Header().Set("X-Cache", "MISS")
-            rw := &responseWriter{
-                ResponseWriter: w,
-                statusCode:     http.StatusOK,
-                body:           &bytes.Buffer{},
+            headers := addedHeaders(before, w.Header())
+            for _, header := range cacheControlHeaders {
+                delete(headers, header)
+            }
+            responseToCache := ResponseCache{
+                StatusCode: bw.statusCode,
+                Headers:    headers,
+                Body:       bw.body.Bytes(),
+                ETag:       strongETag(bw.body.Bytes()),
+                CachedAt:   time.Now().Truncate(time.Second),
+            }
+            if bypass {
+                w.Header().Set("X-Cache", "BYPASS")
+            } else {
+                w.Header().Set("X-Cache", "MISS")
+            }
+            writeCacheable(w, r, policy, responseToCache.StatusCode, responseToCache.Body, responseToCache.ETag, responseToCache.CachedAt)
+
+            if policy.MaxBodySize > 0 && len(responseToCache.Body) > policy.MaxBodySize {
+                return
+            }
+            // A response that sets cookies is specific to its request
+            if headers["Set-Cookie"] != nil {
+                return
             }
 
-            next.ServeHTTP(rw, r)
+            tags := collectedTags()
+
+            // Cache the response asynchronously
+            go func() {
+                cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+                defer cancel()
 
-            // Only cache successful responses
-            if rw.statusCode >= 200 && rw.statusCode < 300 {
-                responseToCache := ResponseCache{
-                    StatusCode: rw.statusCode,
-                   // Headers:    w.Header().Clone(),
-                    Body:       rw.body.Bytes(),
-                    CachedAt:   time.Now(),
+                if err := cache.DefaultCache.Set(cacheCtx, cacheKey, responseToCache, cacheConfig, tags...); err != nil {
+                    // Log cache error but don't affect the response
+                    fmt.Printf("Failed to cache response: %v\n", err)
                 }
+            }()
+        }
+    }
+}
 
-                // Cache the response asynchronously
-                go func() {
-                    cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-                    defer cancel()
-                    
-                    if err := cache.DefaultCache.Set(cacheCtx, cacheKey, responseToCache, cache.APIResponseCacheConfig); err != nil {
-                        // Log cache error but don't affect the response
-                        fmt.Printf("Failed to cache response: %v\n", err)
-                    }
-                }()
-            }
+// cacheIdentity returns whose copy of a response a request may use: ""
+// for the shared copy, or the user ID on private routes. It reports false
+// when the request must not be cached, because it carries credentials the
+// policy cannot scope the entry to.
+func cacheIdentity(r *http.Request, policy CachePolicy) (string, bool) {
+    if policy.Private {
+        if userID, ok := utils.UserIDFromContext(r.Context()); ok {
+            return "user:" + strconv.Itoa(userID), true
+        }
+    }
+    if hasCredentials(r) {
+        return "", false
+    }
+    return "", true
+}
+
+// hasCredentials reports a bearer token or an auth cookie, valid or not.
+func hasCredentials(r *http.Request) bool {
+    if r.Header.Get("Authorization") != "" {
+        return true
+    }
+    for _, name := range []string{"access_token", "refresh_token"} {
+        if _, err := r.Cookie(name); err == nil {
+            return true
+        }
+    }
+    return false
+}
+
+func requestsNoCache(r *http.Request) bool {
+    for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+        if d := strings.ToLower(strings.TrimSpace(directive)); d == "no-cache" || d == "no-store" {
+            return true
         }
     }
+    return r.Header.Get("Cache-Control") == "" && r.Header.Get("Pragma") == "no-cache"
 }
 
-func generateCacheKey(r *http.Request) string {
+// writeCacheable sends a response with its validators and caching
+// headers, or 304 when the client's copy is still current.
+func writeCacheable(w http.ResponseWriter, r *http.Request, policy CachePolicy, statusCode int, body []byte, etag string, lastModified time.Time) {
+    if etag == "" {
+        etag = strongETag(body)
+    }
+
+    visibility := "public"
+    if policy.Private {
+        visibility = "private"
+    }
+    vary := append([]string(nil), policy.VaryHeaders...)
+    if policy.Private {
+        vary = append(vary, "Authorization", "Cookie")
+    } else if len(policy.VaryCookies) > 0 {
+        vary = append(vary, "Cookie")
+    }
+
+    h := w.Header()
+    h.Set("ETag", etag)
+    h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+    h.Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, int(policy.TTL.Seconds())))
+    if len(vary) > 0 {
+        h.Set("Vary", strings.Join(vary, ", "))
+    }
+
+    if statusCode == http.StatusOK && notModified(r, etag, lastModified) {
+        h.Del("Content-Type")
+        h.Del("Content-Length")
+        w.WriteHeader(http.StatusNotModified)
+        return
+    }
+
+    w.WriteHeader(statusCode)
+    w.Write(body)
+}
+
+func generateCacheKey(r *http.Request, policy CachePolicy, identity string) string {
     h := sha256.New()
-    h.Write([]byte(r.URL.Path))
-    h.Write([]byte(r.URL.RawQuery))
-    
+    fmt.Fprintf(h, "%s\n%s\n%s\n", r.URL.Path, r.URL.RawQuery, identity)
+
     // Include relevant headers in cache key
-    cacheHeaders := []string{"Accept", "Accept-Language", "Accept-Encoding"}
-    for _, header := range cacheHeaders {
+    for _, header := range policy.VaryHeaders {
         if value := r.Header.Get(header); value != "" {
-            h.Write([]byte(header + ":" + value))
+            fmt.Fprintf(h, "%s:%s\n", header, value)
+        }
+    }
+    for _, name := range policy.VaryCookies {
+        if cookie, err := r.Cookie(name); err == nil {
+            fmt.Fprintf(h, "Cookie %s:%s\n", name, cookie.Value)
         }
     }
-    
+
+    // Prices in the body depend on the resolved currency, whether it came
+    // from ?currency= or Accept-Currency
+    if currency, err := utils.RequestCurrency(r); err == nil {
+        fmt.Fprintf(h, "Currency:%s\n", currency)
+    }
+
     return hex.EncodeToString(h.Sum(nil))[:16]
 }
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// strongETag derives a strong validator from the exact bytes of a body.
+func strongETag(body []byte) string {
+    sum := sha256.Sum256(body)
+    return `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified evaluates the conditional headers of a GET request. As RFC
+// 9110 requires, If-Modified-Since is ignored when If-None-Match is sent.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+    if inm := r.Header.Get("If-None-Match"); inm != "" {
+        return etagListMatches(inm, etag)
+    }
+
+    if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+        since, err := http.ParseTime(ims)
+        if err != nil {
+            return false
+        }
+        return !lastModified.Truncate(time.Second).After(since)
+    }
+    return false
+}
+
+// etagListMatches uses the weak comparison If-None-Match calls for, so a
+// W/ prefix added by a proxy still matches.
+func etagListMatches(list, etag string) bool {
+    if strings.TrimSpace(list) == "*" {
+        return true
+    }
+    etag = strings.TrimPrefix(etag, "W/")
+    for _, candidate := range strings.Split(list, ",") {
+        if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+            return true
+        }
+    }
+    return false
+}
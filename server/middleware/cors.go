@@ -9,7 +9,7 @@ func EnableCORS(next http.Handler) http.Handler {
         w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000")
         w.Header().Set("Access-Control-Allow-Credentials", "true")
         w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
         
         if r.Method == "OPTIONS" {
             w.WriteHeader(http.StatusOK)
@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"server/config"
+	"server/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+    IdempotencyHeader = "Idempotency-Key"
+
+    idempotencyInFlight  = "in_flight"
+    idempotencyCompleted = "completed"
+
+    maxIdempotencyKeyLength = 255
+    maxIdempotentBodySize   = 1 << 20
+)
+
+type IdempotencyConfig struct {
+    TTL         time.Duration // How long a completed response is replayed
+    LockTimeout time.Duration // How long an in-flight request holds its key
+    KeyPrefix   string
+}
+
+var DefaultIdempotency = IdempotencyConfig{
+    TTL:         24 * time.Hour,
+    LockTimeout: time.Minute,
+    KeyPrefix:   "idempotency",
+}
+
+type idempotencyRecord struct {
+    State       string              `json:"state"`
+    Fingerprint string              `json:"fingerprint"`
+    StatusCode  int                 `json:"status_code,omitempty"`
+    Headers     map[string][]string `json:"headers,omitempty"`
+    Body        []byte              `json:"body,omitempty"`
+}
+
+// IdempotencyMiddleware makes unsafe requests that carry an Idempotency-Key
+// header safe to retry. The first request claims the key and its response
+// is stored; a retry with the same body gets that response replayed, a
+// retry while the first is still running gets 409 and a reuse of the key
+// with a different body gets 422. Keys are scoped per user, so it must run
+// after AuthMiddleware on authenticated routes. Requests without the
+// header pass through untouched.
+func IdempotencyMiddleware() func(http.HandlerFunc) http.HandlerFunc {
+    return IdempotencyMiddlewareWithConfig(DefaultIdempotency)
+}
+
+func IdempotencyMiddlewareWithConfig(cfg IdempotencyConfig) func(http.HandlerFunc) http.HandlerFunc {
+    return func(next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+            idempotencyKey := r.Header.Get(IdempotencyHeader)
+            if idempotencyKey == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+                next.ServeHTTP(w, r)
+                return
+            }
+            if len(idempotencyKey) > maxIdempotencyKeyLength {
+                utils.WriteError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+                return
+            }
+
+            body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+            if err != nil {
+                utils.WriteError(w, http.StatusBadRequest, "Failed to read request body")
+                return
+            }
+            if len(body) > maxIdempotentBodySize {
+                utils.WriteError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+                return
+            }
+            r.Body = io.NopCloser(bytes.NewReader(body))
+
+            key := idempotencyRedisKey(cfg, r, idempotencyKey)
+            fingerprint := requestFingerprint(r, body)
+
+            ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
+            record, claimed, err := claimIdempotencyKey(ctx, key, fingerprint, cfg.LockTimeout)
+            cancel()
+            if err != nil {
+                log.Printf("Idempotency store error: %v", err)
+                // Fail open - same trade-off as the rate limiter
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            if !claimed {
+                switch {
+                case record.Fingerprint != fingerprint:
+                    utils.WriteError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request")
+                case record.State == idempotencyInFlight:
+                    utils.WriteError(w, http.StatusConflict, "A request with this Idempotency-Key is already in progress")
+                default:
+                    replayIdempotentResponse(w, record)
+                }
+                return
+            }
+
+            // Only headers set by the handler belong to the stored response
+            before := w.Header().Clone()
+            rw := &responseWriter{
+                ResponseWriter: w,
+                statusCode:     http.StatusOK,
+                body:           &bytes.Buffer{},
+            }
+
+            next.ServeHTTP(rw, r)
+
+            storeCtx, storeCancel := context.WithTimeout(context.Background(), 2*time.Second)
+            defer storeCancel()
+
+            // Server errors are not final; release the key so the retry runs again
+            if rw.statusCode >= 500 {
+                if err := config.RedisClient.Del(storeCtx, key).Err(); err != nil {
+                    log.Printf("Failed to release idempotency key: %v", err)
+                }
+                return
+            }
+
+            completed := idempotencyRecord{
+                State:       idempotencyCompleted,
+                Fingerprint: fingerprint,
+                StatusCode:  rw.statusCode,
+                Headers:     addedHeaders(before, w.Header()),
+                Body:        rw.body.Bytes(),
+            }
+            if err := storeIdempotencyRecord(storeCtx, key, completed, cfg.TTL); err != nil {
+                log.Printf("Failed to store idempotent response: %v", err)
+            }
+        }
+    }
+}
+
+// claimIdempotencyKey atomically marks the key in flight. When the key is
+// already taken the existing record is returned instead.
+func claimIdempotencyKey(ctx context.Context, key, fingerprint string, lockTimeout time.Duration) (*idempotencyRecord, bool, error) {
+    claim, err := json.Marshal(idempotencyRecord{State: idempotencyInFlight, Fingerprint: fingerprint})
+    if err != nil {
+        return nil, false, err
+    }
+
+    // The existing record can expire between SETNX and GET; one retry covers it
+    for attempt := 0; attempt < 2; attempt++ {
+        ok, err := config.RedisClient.SetNX(ctx, key, claim, lockTimeout).Result()
+        if err != nil {
+            return nil, false, err
+        }
+        if ok {
+            return nil, true, nil
+        }
+
+        data, err := config.RedisClient.Get(ctx, key).Bytes()
+        if err == redis.Nil {
+            continue
+        }
+        if err != nil {
+            return nil, false, err
+        }
+
+        var record idempotencyRecord
+        if err := json.Unmarshal(data, &record); err != nil {
+            return nil, false, err
+        }
+        return &record, false, nil
+    }
+
+    return nil, false, fmt.Errorf("idempotency key %s could not be claimed", key)
+}
+
+func storeIdempotencyRecord(ctx context.Context, key string, record idempotencyRecord, ttl time.Duration) error {
+    data, err := json.Marshal(record)
+    if err != nil {
+        return err
+    }
+    return config.RedisClient.Set(ctx, key, data, ttl).Err()
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, record *idempotencyRecord) {
+    for key, values := range record.Headers {
+        w.Header().Del(key)
+        for _, value := range values {
+            w.Header().Add(key, value)
+        }
+    }
+    w.Header().Set("Idempotent-Replayed", "true")
+    w.WriteHeader(record.StatusCode)
+    w.Write(record.Body)
+}
+
+func idempotencyRedisKey(cfg IdempotencyConfig, r *http.Request, idempotencyKey string) string {
+    // Scope by caller and endpoint so clients cannot collide with each other
+    scope := "anonymous"
+    if userID, ok := utils.UserIDFromContext(r.Context()); ok {
+        scope = fmt.Sprintf("user:%d", userID)
+    }
+
+    h := sha256.New()
+    h.Write([]byte(r.Method + " " + r.URL.Path + "\n" + idempotencyKey))
+    return fmt.Sprintf("%s:%s:%s", cfg.KeyPrefix, scope, hex.EncodeToString(h.Sum(nil)))
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+    h := sha256.New()
+    h.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+    h.Write(body)
+    return hex.EncodeToString(h.Sum(nil))
+}
+
+func addedHeaders(before, after http.Header) map[string][]string {
+    added := make(map[string][]string)
+    for key, values := range after {
+        if fmt.Sprint(before[key]) != fmt.Sprint(values) {
+            added[key] = values
+        }
+    }
+    return added
+}
@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"server/config"
+)
+
+// Rate limit access lists live in Redis so they can change at runtime:
+//
+//	rate_limit:allow     set of CIDRs (or single IPs) that skip rate limits
+//	rate_limit:deny      set of CIDRs (or single IPs) that get 403
+//	rate_limit:api_keys  hash of hex SHA-256 of an API key -> plan name
+const (
+    allowListKey = "rate_limit:allow"
+    denyListKey  = "rate_limit:deny"
+    apiKeysKey   = "rate_limit:api_keys"
+)
+
+// APIKeyHeader identifies API clients. Keys not registered in Redis are
+// ignored and the request is limited by IP.
+const APIKeyHeader = "X-API-Key"
+
+var ErrInvalidCIDR = errors.New("invalid CIDR")
+
+// How long an instance trusts its copy of the CIDR lists
+const accessListRefresh = 5 * time.Second
+
+type accessLists struct {
+    allow []*net.IPNet
+    deny  []*net.IPNet
+}
+
+var (
+    accessMu        sync.Mutex
+    cachedAccess    accessLists
+    accessFetchedAt time.Time
+)
+
+// currentAccessLists returns the CIDR lists, refreshed from Redis at most
+// every accessListRefresh. On a Redis error the previous lists stay in use.
+func currentAccessLists(ctx context.Context) accessLists {
+    accessMu.Lock()
+    defer accessMu.Unlock()
+    if time.Since(accessFetchedAt) < accessListRefresh {
+        return cachedAccess
+    }
+
+    pipe := config.RedisClient.Pipeline()
+    allowCmd := pipe.SMembers(ctx, allowListKey)
+    denyCmd := pipe.SMembers(ctx, denyListKey)
+    if _, err := pipe.Exec(ctx); err != nil {
+        log.Printf("Rate limit access list error: %v", err)
+        return cachedAccess
+    }
+
+    cachedAccess = accessLists{
+        allow: parseCIDRs(allowCmd.Val()),
+        deny:  parseCIDRs(denyCmd.Val()),
+    }
+    accessFetchedAt = time.Now()
+    return cachedAccess
+}
+
+func parseCIDRs(entries []string) []*net.IPNet {
+    var networks []*net.IPNet
+    for _, entry := range entries {
+        network, err := config.ParseCIDR(entry)
+        if err != nil {
+            log.Printf("Ignoring rate limit access list entry %q: %v", entry, err)
+            continue
+        }
+        networks = append(networks, network)
+    }
+    return networks
+}
+
+func (l accessLists) check(ip string) (allowed, denied bool) {
+    parsed := net.ParseIP(ip)
+    if parsed == nil {
+        return false, false
+    }
+    // Deny wins when an address is on both lists
+    for _, network := range l.deny {
+        if network.Contains(parsed) {
+            return false, true
+        }
+    }
+    for _, network := range l.allow {
+        if network.Contains(parsed) {
+            return true, false
+        }
+    }
+    return false, false
+}
+
+// AccessLists is the content of the CIDR lists, as stored.
+type AccessLists struct {
+    Allow []string `json:"allow"`
+    Deny  []string `json:"deny"`
+}
+
+func GetAccessLists(ctx context.Context) (*AccessLists, error) {
+    pipe := config.RedisClient.Pipeline()
+    allowCmd := pipe.SMembers(ctx, allowListKey)
+    denyCmd := pipe.SMembers(ctx, denyListKey)
+    if _, err := pipe.Exec(ctx); err != nil {
+        return nil, err
+    }
+    return &AccessLists{Allow: allowCmd.Val(), Deny: denyCmd.Val()}, nil
+}
+
+// SetAccessLists replaces both lists atomically. Entries are normalized
+// to CIDR notation; an invalid entry rejects the whole update. Other
+// instances pick up the change within accessListRefresh.
+func SetAccessLists(ctx context.Context, lists AccessLists) (*AccessLists, error) {
+    normalized := AccessLists{Allow: []string{}, Deny: []string{}}
+    for _, list := range []struct {
+        entries []string
+        dest    *[]string
+    }{{lists.Allow, &normalized.Allow}, {lists.Deny, &normalized.Deny}} {
+        for _, entry := range list.entries {
+            network, err := config.ParseCIDR(entry)
+            if err != nil {
+                return nil, fmt.Errorf("%w: %v", ErrInvalidCIDR, err)
+            }
+            *list.dest = append(*list.dest, network.String())
+        }
+    }
+
+    pipe := config.RedisClient.TxPipeline()
+    pipe.Del(ctx, allowListKey, denyListKey)
+    if len(normalized.Allow) > 0 {
+        pipe.SAdd(ctx, allowListKey, toInterfaces(normalized.Allow)...)
+    }
+    if len(normalized.Deny) > 0 {
+        pipe.SAdd(ctx, denyListKey, toInterfaces(normalized.Deny)...)
+    }
+    if _, err := pipe.Exec(ctx); err != nil {
+        return nil, err
+    }
+
+    accessMu.Lock()
+    accessFetchedAt = time.Time{}
+    accessMu.Unlock()
+    return &normalized, nil
+}
+
+func toInterfaces(values []string) []interface{} {
+    result := make([]interface{}, len(values))
+    for i, v := range values {
+        result[i] = v
+    }
+    return result
+}
+
+// HashAPIKey is how API keys are stored in rate_limit:api_keys.
+func HashAPIKey(key string) string {
+    sum := sha256.Sum256([]byte(key))
+    return hex.EncodeToString(sum[:])
+}
+
+// lookupAPIKey returns the hash and plan of a registered API key.
+func lookupAPIKey(ctx context.Context, key string) (string, string, bool) {
+    hash := HashAPIKey(key)
+    plan, err := config.RedisClient.HGet(ctx, apiKeysKey, hash).Result()
+    if err != nil {
+        return "", "", false
+    }
+    if plan == "" {
+        plan = APIKeyPlan
+    }
+    return hash, plan, true
+}
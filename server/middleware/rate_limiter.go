@@ -2,15 +2,18 @@ package middleware
 
 import (
 	"context"
-	"crypto/sha256"
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"server/config"
+	"server/models"
 	"server/utils"
 
 	"github.com/redis/go-redis/v9"
@@ -20,17 +23,54 @@ type RateLimiter struct {
     client *redis.Client
 }
 
+// RateLimitAlgorithm selects how a RateLimitConfig counts requests.
+type RateLimitAlgorithm string
+
+const (
+    // SlidingWindowLog stores a timestamp per request: exact, but memory
+    // grows with the limit
+    SlidingWindowLog RateLimitAlgorithm = "sliding_log"
+
+    // SlidingWindowCounter weighs the previous fixed window's count by its
+    // overlap with the sliding window: two counters per tier
+    SlidingWindowCounter RateLimitAlgorithm = "sliding_counter"
+
+    // TokenBucket refills each tier continuously at limit per period
+    TokenBucket RateLimitAlgorithm = "token_bucket"
+
+    // GCRA is a token bucket kept as a single timestamp per tier
+    GCRA RateLimitAlgorithm = "gcra"
+)
+
+// RateLimitConfig limits requests per identity. Every non-zero tier is
+// enforced. With the sliding window algorithms BurstSize caps requests in
+// any one second; with TokenBucket and GCRA it is the bucket capacity of
+// the per-minute tier, i.e. how many requests may arrive back to back.
 type RateLimitConfig struct {
+    Algorithm         RateLimitAlgorithm // SlidingWindowLog when empty
     RequestsPerMinute int
     RequestsPerHour   int
     RequestsPerDay    int
     BurstSize         int
-    WindowSize        time.Duration
+    WindowSize        time.Duration // Period of RequestsPerMinute; a minute when zero
     KeyPrefix         string
+
+    // Plans replace the tiers for some identities: users by role, API
+    // keys by the plan they are registered with (APIKeyPlan by default)
+    // and anonymous clients under AnonymousPlan. Identities without a
+    // matching plan use the tiers above.
+    Plans map[string]RateLimitConfig
 }
 
+// Plan names for identities that are not users
+const (
+    AnonymousPlan = "anonymous"
+    APIKeyPlan    = "api_key"
+)
+
 type RateLimitResult struct {
     Allowed           bool
+    Tier              string // The most restrictive tier, which the other fields describe
     Limit             int
     Remaining         int
     ResetTime         time.Time
@@ -40,15 +80,24 @@ type RateLimitResult struct {
 var (
     // Different rate limits for different endpoints
     DefaultRateLimit = RateLimitConfig{
+        Algorithm:         GCRA,
         RequestsPerMinute: 60,
         RequestsPerHour:   1000,
         RequestsPerDay:    10000,
         BurstSize:         10,
         WindowSize:        time.Minute,
         KeyPrefix:         "rate_limit",
+        Plans: map[string]RateLimitConfig{
+            // Shared addresses such as offices and mobile carriers get
+            // the default limits; signed-in staff and API clients more
+            "staff": {RequestsPerMinute: 300, RequestsPerHour: 10000, RequestsPerDay: 100000, BurstSize: 50},
+            "admin": {RequestsPerMinute: 300, RequestsPerHour: 10000, RequestsPerDay: 100000, BurstSize: 50},
+            APIKeyPlan: {RequestsPerMinute: 600, RequestsPerHour: 20000, RequestsPerDay: 200000, BurstSize: 100},
+        },
     }
 
     AuthRateLimit = RateLimitConfig{
+        Algorithm:         SlidingWindowLog,
         RequestsPerMinute: 10,
         RequestsPerHour:   100,
         RequestsPerDay:    500,
@@ -56,158 +105,301 @@ var (
         WindowSize:        time.Minute,
         KeyPrefix:         "auth_rate_limit",
     }
-
-    // Sliding window rate limiter Lua script
-    slidingWindowScript = `
-        local key = KEYS[1]
-        local window = tonumber(ARGV[1])
-        local limit = tonumber(ARGV[2])
-        local current_time = tonumber(ARGV[3])
-        
-        -- Remove expired entries
-        redis.call('ZREMRANGEBYSCORE', key, 0, current_time - window)
-        
-        -- Count current requests in window
-        local current_requests = redis.call('ZCARD', key)
-        
-        if current_requests < limit then
-            -- Add current request
-            redis.call('ZADD', key, current_time, current_time .. ':' .. math.random())
-            redis.call('EXPIRE', key, window)
-            return {1, limit - current_requests - 1, current_time + window}
-        else
-            local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
-            local reset_time = current_time + window
-            if #oldest > 0 then
-                reset_time = tonumber(oldest[2]) + window
-            end
-            return {0, 0, reset_time}
-        end
-    `
-
-    // Token bucket rate limiter Lua script
-    tokenBucketScript = `
-        local key = KEYS[1]
-        local capacity = tonumber(ARGV[1])
-        local tokens = tonumber(ARGV[2])
-        local interval = tonumber(ARGV[3])
-        local current_time = tonumber(ARGV[4])
-        
-        local bucket = redis.call('HMGET', key, 'tokens', 'last_refill')
-        local tokens_count = tonumber(bucket[1]) or capacity
-        local last_refill = tonumber(bucket[2]) or current_time
-        
-        -- Calculate tokens to add
-        local time_passed = current_time - last_refill
-        local tokens_to_add = math.floor(time_passed / interval) * tokens
-        tokens_count = math.min(capacity, tokens_count + tokens_to_add)
-        
-        if tokens_count >= 1 then
-            tokens_count = tokens_count - 1
-            redis.call('HMSET', key, 'tokens', tokens_count, 'last_refill', current_time)
-            redis.call('EXPIRE', key, interval * capacity)
-            return {1, tokens_count, current_time + interval}
-        else
-            redis.call('HMSET', key, 'tokens', tokens_count, 'last_refill', current_time)
-            redis.call('EXPIRE', key, interval * capacity)
-            return {0, tokens_count, current_time + interval}
-        end
-    `
 )
 
+// rateLimitScript checks every tier of a request and records the request
+// in all of them only if each allows it, so a denied request consumes
+// nothing. Times are in milliseconds.
+// KEYS: one per tier
+// ARGV: algorithm, now, unique request id, then limit, period and
+// capacity for each tier
+// Returns allowed, then remaining, reset time and retry delay per tier.
+var rateLimitScript = redis.NewScript(`
+local algorithm = ARGV[1]
+local now = tonumber(ARGV[2])
+local request_id = ARGV[3]
+
+local checks = {}
+
+checks.sliding_log = function(key, limit, period)
+    redis.call('ZREMRANGEBYSCORE', key, '-inf', now - period)
+    local count = redis.call('ZCARD', key)
+    local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+    local reset = now + period
+    if #oldest > 0 then
+        reset = tonumber(oldest[2]) + period
+    end
+    local commit = function()
+        redis.call('ZADD', key, now, now .. ':' .. request_id)
+        redis.call('PEXPIRE', key, period)
+    end
+    if count < limit then
+        return true, limit - count - 1, reset, 0, commit
+    end
+    -- A slot frees up when the request that pushed the count over expires
+    local blocking = redis.call('ZRANGE', key, count - limit, count - limit, 'WITHSCORES')
+    return false, 0, reset, tonumber(blocking[2]) + period - now, commit
+end
+
+checks.sliding_counter = function(key, limit, period)
+    local window = math.floor(now / period)
+    local current_key = key .. ':' .. window
+    local current = tonumber(redis.call('GET', current_key) or '0')
+    local previous = tonumber(redis.call('GET', key .. ':' .. (window - 1)) or '0')
+    local elapsed = now - window * period
+    local estimate = previous * (period - elapsed) / period + current
+    local reset = (window + 1) * period
+    local commit = function()
+        redis.call('INCR', current_key)
+        redis.call('PEXPIRE', current_key, 2 * period)
+    end
+    if estimate + 1 <= limit then
+        return true, math.floor(limit - estimate - 1), reset, 0, commit
+    end
+    local retry
+    if current + 1 > limit then
+        -- Wait for the next window, then for this one's weight to fade
+        retry = reset - now + math.ceil(period * (1 - (limit - 1) / current))
+    else
+        retry = math.ceil(period * (1 - (limit - current - 1) / previous)) - elapsed
+    end
+    return false, 0, reset, math.max(retry, 1), commit
+end
+
+checks.token_bucket = function(key, limit, period, capacity)
+    local rate = limit / period
+    local bucket = redis.call('HMGET', key, 'tokens', 'updated_at')
+    local tokens = tonumber(bucket[1]) or capacity
+    local updated_at = tonumber(bucket[2]) or now
+    tokens = math.min(capacity, tokens + math.max(0, now - updated_at) * rate)
+    local commit = function()
+        redis.call('HSET', key, 'tokens', tokens - 1, 'updated_at', now)
+        redis.call('PEXPIRE', key, math.ceil(capacity / rate))
+    end
+    if tokens >= 1 then
+        return true, math.floor(tokens - 1), now + math.ceil((capacity - tokens + 1) / rate), 0, commit
+    end
+    return false, 0, now + math.ceil((capacity - tokens) / rate), math.ceil((1 - tokens) / rate), commit
+end
+
+checks.gcra = function(key, limit, period, capacity)
+    local interval = period / limit
+    local tat = math.max(tonumber(redis.call('GET', key) or '0'), now)
+    local new_tat = tat + interval
+    local allow_at = new_tat - capacity * interval
+    local commit = function()
+        redis.call('SET', key, new_tat, 'PX', math.ceil(new_tat - now))
+    end
+    if now >= allow_at then
+        return true, math.floor((now - allow_at) / interval), math.ceil(new_tat), 0, commit
+    end
+    return false, 0, math.ceil(tat), math.ceil(allow_at - now), commit
+end
+
+local check = checks[algorithm]
+local allowed = 1
+local results = {}
+local commits = {}
+for i, key in ipairs(KEYS) do
+    local base = 3 + (i - 1) * 3
+    local ok, remaining, reset, retry, commit = check(key,
+        tonumber(ARGV[base + 1]), tonumber(ARGV[base + 2]), tonumber(ARGV[base + 3]))
+    if not ok then
+        allowed = 0
+    end
+    commits[i] = commit
+    table.insert(results, remaining)
+    table.insert(results, reset)
+    table.insert(results, retry)
+end
+
+if allowed == 1 then
+    for _, commit in ipairs(commits) do
+        commit()
+    end
+end
+table.insert(results, 1, allowed)
+return results
+`)
+
+type rateLimitTier struct {
+    name     string
+    limit    int
+    period   time.Duration
+    capacity int // Bucket size for TokenBucket and GCRA
+}
+
+// forPlan returns the config for an identity's plan. Algorithm, key
+// prefix and window come from the base config unless the plan sets them.
+func (c RateLimitConfig) forPlan(plan string) RateLimitConfig {
+    planConfig, ok := c.Plans[plan]
+    if !ok {
+        return c
+    }
+    if planConfig.Algorithm == "" {
+        planConfig.Algorithm = c.Algorithm
+    }
+    if planConfig.KeyPrefix == "" {
+        planConfig.KeyPrefix = c.KeyPrefix
+    }
+    if planConfig.WindowSize == 0 {
+        planConfig.WindowSize = c.WindowSize
+    }
+    planConfig.Plans = nil
+    return planConfig
+}
+
+// tiers lists the configured limits of a config.
+func (c RateLimitConfig) tiers() []rateLimitTier {
+    bucket := c.Algorithm == TokenBucket || c.Algorithm == GCRA
+    minute := c.WindowSize
+    if minute <= 0 {
+        minute = time.Minute
+    }
+
+    var tiers []rateLimitTier
+    if c.BurstSize > 0 && !bucket {
+        tiers = append(tiers, rateLimitTier{"burst", c.BurstSize, time.Second, c.BurstSize})
+    }
+    if c.RequestsPerMinute > 0 {
+        capacity := c.RequestsPerMinute
+        if c.BurstSize > 0 && bucket {
+            capacity = c.BurstSize
+        }
+        tiers = append(tiers, rateLimitTier{"minute", c.RequestsPerMinute, minute, capacity})
+    }
+    if c.RequestsPerHour > 0 {
+        tiers = append(tiers, rateLimitTier{"hour", c.RequestsPerHour, time.Hour, c.RequestsPerHour})
+    }
+    if c.RequestsPerDay > 0 {
+        tiers = append(tiers, rateLimitTier{"day", c.RequestsPerDay, 24 * time.Hour, c.RequestsPerDay})
+    }
+    return tiers
+}
+
 func NewRateLimiter() *RateLimiter {
     return &RateLimiter{
         client: config.RedisClient,
     }
 }
 
+// CheckRateLimit counts a request against every tier of config in one
+// atomic step. The result describes the most restrictive tier: when the
+// request is denied, the one that blocks it longest, otherwise the one
+// with the fewest requests left.
 func (rl *RateLimiter) CheckRateLimit(ctx context.Context, identifier string, config RateLimitConfig) (*RateLimitResult, error) {
-    // Use sliding window algorithm
-    return rl.slidingWindowCheck(ctx, identifier, config)
-}
+    algorithm := config.Algorithm
+    if algorithm == "" {
+        algorithm = SlidingWindowLog
+    }
+    tiers := config.tiers()
+    if len(tiers) == 0 {
+        return &RateLimitResult{Allowed: true}, nil
+    }
 
-func (rl *RateLimiter) slidingWindowCheck(ctx context.Context, identifier string, config RateLimitConfig) (*RateLimitResult, error) {
-    key := fmt.Sprintf("%s:%s:%s", config.KeyPrefix, identifier, "sliding")
-    currentTime := time.Now().Unix()
-    windowSeconds := int64(config.WindowSize.Seconds())
+    now := time.Now()
+    keys := make([]string, len(tiers))
+    args := []interface{}{string(algorithm), now.UnixMilli(), randomToken()}
+    for i, tier := range tiers {
+        keys[i] = fmt.Sprintf("%s:%s:%s:%s", config.KeyPrefix, identifier, algorithm, tier.name)
+        args = append(args, tier.limit, tier.period.Milliseconds(), tier.capacity)
+    }
 
-    result, err := rl.client.Eval(ctx, slidingWindowScript, []string{key}, 
-        windowSeconds, config.RequestsPerMinute, currentTime).Result()
-    
+    values, err := rateLimitScript.Run(ctx, rl.client, keys, args...).Int64Slice()
     if err != nil {
         log.Printf("Redis rate limit error: %v", err)
         // Fail open - allow request if Redis is down
         return &RateLimitResult{
             Allowed:   true,
-            Limit:     config.RequestsPerMinute,
-            Remaining: config.RequestsPerMinute - 1,
-            ResetTime: time.Now().Add(config.WindowSize),
+            Tier:      tiers[0].name,
+            Limit:     tiers[0].limit,
+            Remaining: tiers[0].limit - 1,
+            ResetTime: now.Add(tiers[0].period),
         }, nil
     }
 
-    resultSlice := result.([]interface{})
-    allowed := resultSlice[0].(int64) == 1
-    remaining := int(resultSlice[1].(int64))
-    resetTime := time.Unix(resultSlice[2].(int64), 0)
-
-    return &RateLimitResult{
-        Allowed:    allowed,
-        Limit:      config.RequestsPerMinute,
-        Remaining:  remaining,
-        ResetTime:  resetTime,
-        RetryAfter: time.Until(resetTime),
-    }, nil
+    allowed := values[0] == 1
+    var result *RateLimitResult
+    for i, tier := range tiers {
+        remaining, reset, retry := values[1+i*3], values[2+i*3], values[3+i*3]
+        candidate := &RateLimitResult{
+            Allowed:    allowed,
+            Tier:       tier.name,
+            Limit:      tier.limit,
+            Remaining:  int(remaining),
+            ResetTime:  time.UnixMilli(reset),
+            RetryAfter: time.Duration(retry) * time.Millisecond,
+        }
+
+        switch {
+        case result == nil:
+            result = candidate
+        case !allowed && candidate.RetryAfter > result.RetryAfter:
+            result = candidate
+        case allowed && candidate.Remaining < result.Remaining:
+            result = candidate
+        }
+    }
+    return result, nil
 }
 
-func (rl *RateLimiter) tokenBucketCheck(ctx context.Context, identifier string, config RateLimitConfig) (*RateLimitResult, error) {
-    key := fmt.Sprintf("%s:%s:%s", config.KeyPrefix, identifier, "bucket")
-    currentTime := time.Now().Unix()
-    intervalSeconds := int64(config.WindowSize.Seconds()) / int64(config.RequestsPerMinute)
+func randomToken() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
 
-    result, err := rl.client.Eval(ctx, tokenBucketScript, []string{key}, 
-        config.BurstSize, 1, intervalSeconds, currentTime).Result()
-    
-    if err != nil {
-        log.Printf("Redis rate limit error: %v", err)
-        return &RateLimitResult{
-            Allowed:   true,
-            Limit:     config.BurstSize,
-            Remaining: config.BurstSize - 1,
-            ResetTime: time.Now().Add(time.Duration(intervalSeconds) * time.Second),
-        }, nil
+// rateLimitIdentity is who a request is counted against.
+type rateLimitIdentity struct {
+    key  string // e.g. "user:42", "api_key:<hash>" or "ip:203.0.113.7"
+    plan string
+}
+
+// resolveIdentity picks, in order, the signed-in user, a registered API
+// key, then the client IP. The user comes from the context when
+// AuthMiddleware ran first and from the access token otherwise, so the
+// result does not depend on middleware order. The User-Agent is not part
+// of the identity: clients could change it to reset their limits.
+func resolveIdentity(ctx context.Context, r *http.Request) rateLimitIdentity {
+    userID, ok := utils.UserIDFromContext(r.Context())
+    if !ok {
+        userID, ok = userIDFromToken(r)
+    }
+    if ok {
+        identity := rateLimitIdentity{key: fmt.Sprintf("user:%d", userID)}
+        if user, err := models.GetUserByID(userID); err == nil {
+            identity.plan = user.Role
+        }
+        return identity
     }
 
-    resultSlice := result.([]interface{})
-    allowed := resultSlice[0].(int64) == 1
-    remaining := int(resultSlice[1].(int64))
-    resetTime := time.Unix(resultSlice[2].(int64), 0)
-
-    return &RateLimitResult{
-        Allowed:    allowed,
-        Limit:      config.BurstSize,
-        Remaining:  remaining,
-        ResetTime:  resetTime,
-        RetryAfter: time.Until(resetTime),
-    }, nil
+    if apiKey := r.Header.Get(APIKeyHeader); apiKey != "" {
+        if hash, plan, ok := lookupAPIKey(ctx, apiKey); ok {
+            return rateLimitIdentity{key: "api_key:" + hash[:16], plan: plan}
+        }
+    }
+
+    return rateLimitIdentity{key: "ip:" + utils.GetClientIP(r), plan: AnonymousPlan}
 }
 
-func getClientIdentifier(r *http.Request) string {
-    // Priority: User ID > IP + User Agent hash > IP only
-    userID := r.Context().Value("user_id")
-    if userID != nil {
-        return fmt.Sprintf("user:%v", userID)
+// userIDFromToken reads the user from a valid access token, in the
+// Authorization header or the access_token cookie.
+func userIDFromToken(r *http.Request) (int, bool) {
+    token := r.Header.Get("Authorization")
+    if token == "" {
+        if cookie, err := r.Cookie("access_token"); err == nil {
+            token = cookie.Value
+        }
     }
-
-    ip := utils.GetClientIP(r)
-	
-    userAgent := r.Header.Get("User-Agent")
-    
-    if userAgent != "" {
-        hash := sha256.Sum256([]byte(userAgent))
-        return fmt.Sprintf("ip:%s:ua:%s", ip, hex.EncodeToString(hash[:8]))
+    if token == "" {
+        return 0, false
     }
 
-    return fmt.Sprintf("ip:%s", ip)
+    claims, err := utils.ValidateToken(strings.TrimPrefix(token, "Bearer "))
+    if err != nil || claims.TokenType != "access" {
+        return 0, false
+    }
+    return claims.UserID, true
 }
 
 // Middleware functions
@@ -219,8 +411,19 @@ func RateLimitMiddleware(config RateLimitConfig) func(http.HandlerFunc) http.Han
             ctx, cancel := context.WithTimeout(r.Context(), 500*time.Millisecond)
             defer cancel()
 
-            identifier := getClientIdentifier(r)
-            result, err := limiter.CheckRateLimit(ctx, identifier, config)
+            ip := utils.GetClientIP(r)
+            allowed, denied := currentAccessLists(ctx).check(ip)
+            if denied {
+                utils.WriteError(w, http.StatusForbidden, "Access denied")
+                return
+            }
+            if allowed {
+                next.ServeHTTP(w, r)
+                return
+            }
+
+            identity := resolveIdentity(ctx, r)
+            result, err := limiter.CheckRateLimit(ctx, identity.key, config.forPlan(identity.plan))
             
             if err != nil {
                 log.Printf("Rate limiting error: %v", err)
@@ -233,12 +436,14 @@ func RateLimitMiddleware(config RateLimitConfig) func(http.HandlerFunc) http.Han
             w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
             w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
             w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(result.ResetTime.Unix(), 10))
+            w.Header().Set("X-RateLimit-Tier", result.Tier)
 
             if !result.Allowed {
-                w.Header().Set("Retry-After", strconv.Itoa(int(result.RetryAfter.Seconds())))
+                retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+                w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
                 utils.WriteError(w, http.StatusTooManyRequests, fmt.Sprintf(
                     "Rate limit exceeded. Try again in %d seconds", 
-                    int(result.RetryAfter.Seconds())))
+                    retryAfter))
                 return
             }
 
@@ -0,0 +1,49 @@
+-- Product categories, order totals and the coupon/promotion engine.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_products_category ON products(category);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS subtotal     NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS discount     NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS shipping_fee NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS total        NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS coupon_code  VARCHAR(50) NOT NULL DEFAULT '';
+
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS product_name VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS size         VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS color        VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS unit_price   NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS discount     NUMERIC(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS line_total   NUMERIC(12, 2) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS promotions (
+    id               SERIAL PRIMARY KEY,
+    code             VARCHAR(50) NOT NULL UNIQUE,
+    description      TEXT NOT NULL DEFAULT '',
+    type             VARCHAR(20) NOT NULL,
+    value            NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    buy_quantity     INTEGER NOT NULL DEFAULT 0,
+    get_quantity     INTEGER NOT NULL DEFAULT 0,
+    categories       TEXT[] NOT NULL DEFAULT '{}',
+    min_subtotal     NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    first_order_only BOOLEAN NOT NULL DEFAULT false,
+    per_user_limit   INTEGER NOT NULL DEFAULT 0,
+    usage_limit      INTEGER NOT NULL DEFAULT 0,
+    redemption_count INTEGER NOT NULL DEFAULT 0,
+    starts_at        TIMESTAMP,
+    ends_at          TIMESTAMP,
+    is_active        BOOLEAN NOT NULL DEFAULT true,
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (usage_limit = 0 OR redemption_count <= usage_limit)
+);
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    id           SERIAL PRIMARY KEY,
+    promotion_id INTEGER NOT NULL REFERENCES promotions(id),
+    user_id      INTEGER NOT NULL REFERENCES users(id),
+    order_id     INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    amount       NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_promotion_redemptions_user ON promotion_redemptions(promotion_id, user_id);
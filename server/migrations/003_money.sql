@@ -0,0 +1,38 @@
+-- Store every amount as integer minor units plus an ISO 4217 currency.
+-- Existing decimal amounts are assumed to be USD.
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS price_minor BIGINT;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+UPDATE products SET price_minor = ROUND(price * 100) WHERE price_minor IS NULL;
+ALTER TABLE products ALTER COLUMN price_minor SET NOT NULL;
+-- The legacy decimal price column is left in place for rollback; nothing reads it.
+
+-- Per-currency price lists. A product without an entry for the requested
+-- currency is converted from its base price using the exchange-rate source.
+CREATE TABLE IF NOT EXISTS product_prices (
+    product_id   INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    currency     CHAR(3) NOT NULL,
+    amount_minor BIGINT NOT NULL CHECK (amount_minor >= 0),
+    PRIMARY KEY (product_id, currency)
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_prices_currency ON product_prices(currency);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE orders ALTER COLUMN subtotal     TYPE BIGINT USING ROUND(subtotal * 100);
+ALTER TABLE orders ALTER COLUMN discount     TYPE BIGINT USING ROUND(discount * 100);
+ALTER TABLE orders ALTER COLUMN shipping_fee TYPE BIGINT USING ROUND(shipping_fee * 100);
+ALTER TABLE orders ALTER COLUMN total        TYPE BIGINT USING ROUND(total * 100);
+
+ALTER TABLE order_items ALTER COLUMN unit_price TYPE BIGINT USING ROUND(unit_price * 100);
+ALTER TABLE order_items ALTER COLUMN discount   TYPE BIGINT USING ROUND(discount * 100);
+ALTER TABLE order_items ALTER COLUMN line_total TYPE BIGINT USING ROUND(line_total * 100);
+
+-- promotions.value keeps holding percentages; fixed amounts and minimums move to minor units
+ALTER TABLE promotions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE promotions ADD COLUMN IF NOT EXISTS amount_minor BIGINT NOT NULL DEFAULT 0;
+UPDATE promotions SET amount_minor = ROUND(value * 100), value = 0 WHERE type = 'fixed_amount';
+ALTER TABLE promotions ALTER COLUMN min_subtotal TYPE BIGINT USING ROUND(min_subtotal * 100);
+
+ALTER TABLE promotion_redemptions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE promotion_redemptions ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100);
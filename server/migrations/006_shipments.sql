@@ -0,0 +1,37 @@
+-- Fulfillment records. An order can ship in several parcels, each covering
+-- part of its items, with carrier tracking events per shipment.
+
+CREATE TABLE IF NOT EXISTS shipments (
+    id              SERIAL PRIMARY KEY,
+    order_id        INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    carrier         VARCHAR(100) NOT NULL,
+    tracking_number VARCHAR(100) NOT NULL,
+    status          VARCHAR(30) NOT NULL DEFAULT 'shipped',
+    shipped_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at    TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipments_order_id ON shipments(order_id);
+
+CREATE TABLE IF NOT EXISTS shipment_items (
+    id            SERIAL PRIMARY KEY,
+    shipment_id   INTEGER NOT NULL REFERENCES shipments(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity      INTEGER NOT NULL CHECK (quantity > 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipment_items_shipment_id ON shipment_items(shipment_id);
+CREATE INDEX IF NOT EXISTS idx_shipment_items_order_item_id ON shipment_items(order_item_id);
+
+CREATE TABLE IF NOT EXISTS shipment_events (
+    id          SERIAL PRIMARY KEY,
+    shipment_id INTEGER NOT NULL REFERENCES shipments(id) ON DELETE CASCADE,
+    status      VARCHAR(30) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    location    VARCHAR(200) NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_shipment_events_shipment_id ON shipment_events(shipment_id, occurred_at);
@@ -0,0 +1,80 @@
+-- Payments, variant stock, and the returns (RMA) workflow with refunds.
+
+-- Stock per product/size/color. Returns restock into these rows.
+CREATE TABLE IF NOT EXISTS product_variants (
+    id          SERIAL PRIMARY KEY,
+    product_id  INTEGER NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    size        VARCHAR(20) NOT NULL DEFAULT '',
+    color       VARCHAR(30) NOT NULL DEFAULT '',
+    stock       INTEGER NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    updated_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (product_id, size, color)
+);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id              SERIAL PRIMARY KEY,
+    order_id        INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider        VARCHAR(50) NOT NULL,
+    reference       VARCHAR(100) NOT NULL,
+    amount          BIGINT NOT NULL,
+    refunded_amount BIGINT NOT NULL DEFAULT 0 CHECK (refunded_amount <= amount),
+    currency        CHAR(3) NOT NULL,
+    status          VARCHAR(30) NOT NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_order_id ON payments(order_id);
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded_amount BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS refunded_quantity INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS returns (
+    id              SERIAL PRIMARY KEY,
+    order_id        INTEGER NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    user_id         INTEGER NOT NULL REFERENCES users(id),
+    status          VARCHAR(20) NOT NULL DEFAULT 'requested',
+    reason          VARCHAR(30) NOT NULL,
+    comment         TEXT NOT NULL DEFAULT '',
+    refunded_amount BIGINT NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_returns_order_id ON returns(order_id);
+CREATE INDEX IF NOT EXISTS idx_returns_user_id ON returns(user_id);
+CREATE INDEX IF NOT EXISTS idx_returns_status_created ON returns(status, created_at);
+
+CREATE TABLE IF NOT EXISTS return_items (
+    id            SERIAL PRIMARY KEY,
+    return_id     INTEGER NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+    order_item_id INTEGER NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity      INTEGER NOT NULL CHECK (quantity > 0),
+    restocked     BOOLEAN NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS idx_return_items_return_id ON return_items(return_id);
+CREATE INDEX IF NOT EXISTS idx_return_items_order_item_id ON return_items(order_item_id);
+
+-- Audit trail: one row per status change, with who made it
+CREATE TABLE IF NOT EXISTS return_events (
+    id         SERIAL PRIMARY KEY,
+    return_id  INTEGER NOT NULL REFERENCES returns(id) ON DELETE CASCADE,
+    status     VARCHAR(20) NOT NULL,
+    actor_id   INTEGER NOT NULL REFERENCES users(id),
+    note       TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_return_events_return_id ON return_events(return_id);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id         SERIAL PRIMARY KEY,
+    payment_id INTEGER NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    return_id  INTEGER REFERENCES returns(id) ON DELETE SET NULL,
+    amount     BIGINT NOT NULL CHECK (amount > 0),
+    reference  VARCHAR(100) NOT NULL,
+    reason     TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id);
@@ -0,0 +1,18 @@
+-- Transactional outbox. Rows are written in the same transaction as the
+-- change they describe and delivered by the events dispatcher.
+
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      VARCHAR(100) NOT NULL,
+    payload         JSONB NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_error      TEXT NOT NULL DEFAULT '',
+    published_at    TIMESTAMP,
+    failed_at       TIMESTAMP,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Only pending rows are ever scanned by the dispatcher
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(next_attempt_at, id)
+    WHERE published_at IS NULL AND failed_at IS NULL;
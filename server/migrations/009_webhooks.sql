@@ -0,0 +1,44 @@
+-- Merchant webhook endpoints and their delivery log.
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id              SERIAL PRIMARY KEY,
+    url             TEXT NOT NULL,
+    description     VARCHAR(500) NOT NULL DEFAULT '',
+    secret          VARCHAR(255) NOT NULL,
+    event_types     TEXT[] NOT NULL DEFAULT '{}', -- Empty means every event
+    is_active       BOOLEAN NOT NULL DEFAULT TRUE,
+    failure_count   INTEGER NOT NULL DEFAULT 0,   -- Consecutive failed attempts
+    disabled_at     TIMESTAMP,
+    disabled_reason TEXT NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               SERIAL PRIMARY KEY,
+    endpoint_id      INTEGER NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event_id         BIGINT NOT NULL,
+    event_type       VARCHAR(100) NOT NULL,
+    payload          JSONB NOT NULL,
+    occurred_at      TIMESTAMP NOT NULL,
+    status           VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts         INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_error       TEXT NOT NULL DEFAULT '',
+    last_response    TEXT NOT NULL DEFAULT '',
+    duration_ms      INTEGER NOT NULL DEFAULT 0,
+    redelivery_of    INTEGER REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    delivered_at     TIMESTAMP,
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- One original delivery per endpoint and event, however often the outbox
+-- redelivers it; manual redeliveries are extra rows
+CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(endpoint_id, event_id)
+    WHERE redelivery_of IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at, id)
+    WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_log ON webhook_deliveries(endpoint_id, id DESC);
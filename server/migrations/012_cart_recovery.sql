@@ -0,0 +1,31 @@
+-- Saved carts and abandoned cart recovery.
+
+-- One saved cart per user, priced again whenever it is read
+CREATE TABLE IF NOT EXISTS carts (
+    user_id     INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    items       JSONB NOT NULL,
+    currency    CHAR(3) NOT NULL,
+    recovery_id INTEGER, -- Open cart_recoveries row once a reminder was sent
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_carts_updated_at ON carts(updated_at);
+
+-- One row per abandoned cart that got at least one reminder; kept after
+-- the cart is gone so conversion can be reported
+CREATE TABLE IF NOT EXISTS cart_recoveries (
+    id                SERIAL PRIMARY KEY,
+    user_id           INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reminders_sent    INTEGER NOT NULL DEFAULT 0,
+    first_reminded_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_reminded_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    restored_at       TIMESTAMP, -- First time the restore link was opened
+    order_id          INTEGER REFERENCES orders(id) ON DELETE SET NULL,
+    recovered_at      TIMESTAMP  -- Checkout after a reminder
+);
+
+CREATE INDEX IF NOT EXISTS idx_cart_recoveries_first_reminded ON cart_recoveries(first_reminded_at);
+
+-- Cleared by the unsubscribe link in a reminder email
+ALTER TABLE users ADD COLUMN IF NOT EXISTS cart_reminders BOOLEAN NOT NULL DEFAULT TRUE;
@@ -0,0 +1,8 @@
+-- A refund is recorded as pending before the payment provider is called
+-- and settled once the provider answers. Existing refunds went through.
+
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'succeeded';
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '';
+
+-- Pending refunds left behind by a crash need checking against the provider
+CREATE INDEX IF NOT EXISTS idx_refunds_pending ON refunds(created_at) WHERE status = 'pending';
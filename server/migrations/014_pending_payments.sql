@@ -0,0 +1,8 @@
+-- A payment is recorded as pending before the provider is charged and
+-- settled once the provider answers. The token is kept only until then,
+-- so an unsettled charge can be repeated with the same idempotency key.
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS token TEXT NOT NULL DEFAULT '';
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS last_error TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_payments_pending ON payments(created_at) WHERE status = 'pending';
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"server/shipping"
+	"server/tax"
+	"strings"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+type Address struct {
+    Name       string `json:"name"`
+    Line1      string `json:"line1"`
+    Line2      string `json:"line2,omitempty"`
+    City       string `json:"city"`
+    Region     string `json:"region,omitempty"` // State, province or county
+    PostalCode string `json:"postal_code,omitempty"`
+    Country    string `json:"country"` // ISO 3166-1 alpha-2
+}
+
+func (a *Address) Validate() error {
+    a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+    if len(a.Country) != 2 {
+        return fmt.Errorf("%w: country must be a two-letter ISO code", ErrInvalidAddress)
+    }
+    if strings.TrimSpace(a.Line1) == "" || strings.TrimSpace(a.City) == "" {
+        return fmt.Errorf("%w: line1 and city are required", ErrInvalidAddress)
+    }
+    return nil
+}
+
+func (a Address) TaxLocation() tax.Location {
+    return tax.Location{Country: a.Country, Region: a.Region, PostalCode: a.PostalCode}
+}
+
+func (a Address) ShippingDestination() shipping.Destination {
+    return shipping.Destination{Country: a.Country, Region: a.Region, PostalCode: a.PostalCode}
+}
+
+// Value and Scan store addresses as JSONB
+func (a Address) Value() (driver.Value, error) {
+    return json.Marshal(a)
+}
+
+func (a *Address) Scan(src interface{}) error {
+    switch v := src.(type) {
+    case []byte:
+        return json.Unmarshal(v, a)
+    case string:
+        return json.Unmarshal([]byte(v), a)
+    case nil:
+        *a = Address{}
+        return nil
+    }
+    return fmt.Errorf("cannot scan %T into Address", src)
+}
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/money"
+	"server/promotions"
+	"server/shipping"
+	"server/tax"
+	"strings"
+)
+
+const maxLineQuantity = 99
+
+var (
+    ErrEmptyCart       = errors.New("cart is empty")
+    ErrInvalidQuantity = errors.New("invalid quantity")
+    ErrInvalidVariant  = errors.New("invalid product option")
+)
+
+// CartItemInput is a cart line as submitted by the client. Prices are
+// never taken from the client; they are loaded from the products table.
+type CartItemInput struct {
+    ProductID int    `json:"product_id"`
+    Quantity  int    `json:"quantity"`
+    Size      string `json:"size"`
+    Color     string `json:"color"`
+}
+
+type CartLine struct {
+    ProductID   int         `json:"product_id"`
+    ProductName string      `json:"product_name"`
+    Category    string      `json:"category"`
+    Size        string      `json:"size"`
+    Color       string      `json:"color"`
+    Quantity    int         `json:"quantity"`
+    UnitPrice   money.Money `json:"unit_price"`
+    Discount    money.Money `json:"discount"`
+    LineTotal   money.Money `json:"line_total"`
+    Tax         tax.LineTax `json:"tax"`
+
+    weightGrams int
+    dimensions  Dimensions
+}
+
+type Cart struct {
+    UserID          int                  `json:"-"`
+    Currency        string               `json:"currency"`
+    Lines           []CartLine           `json:"lines"`
+    Subtotal        money.Money          `json:"subtotal"`
+    Discount        money.Money          `json:"discount"`
+    ShippingMethod  *shipping.Rate       `json:"shipping_method,omitempty"`
+    ShippingFee     money.Money          `json:"shipping_fee"`
+    ShippingPending bool                 `json:"shipping_pending,omitempty"` // Fee is an estimate until an address is given
+    ShippingTax     tax.LineTax          `json:"shipping_tax"`
+    Tax             money.Money          `json:"tax"`
+    TaxIncluded     money.Money          `json:"tax_included"` // Part of Tax already contained in the prices
+    Total           money.Money          `json:"total"`
+    Coupon          *promotions.Discount `json:"coupon,omitempty"`
+
+    taxCalculator tax.Calculator
+    taxLocation   tax.Location
+
+    shippingCalculator shipping.Calculator
+    shippingDest       shipping.Destination
+    shippingCode       string
+}
+
+// BuildCart validates the submitted items against the catalog and prices
+// them in the given currency. Repeated product/size/color combinations are
+// merged into one line.
+func BuildCart(userID int, currency string, items []CartItemInput) (*Cart, error) {
+    if len(items) == 0 {
+        return nil, ErrEmptyCart
+    }
+
+    ids := make([]int, 0, len(items))
+    for _, item := range items {
+        ids = append(ids, item.ProductID)
+    }
+
+    products, err := GetProductsByIDs(ids)
+    if err != nil {
+        return nil, err
+    }
+
+    priceList, err := loadPriceList(currency)
+    if err != nil {
+        return nil, err
+    }
+
+    cart := &Cart{UserID: userID, Currency: currency}
+    index := make(map[string]int)
+
+    for _, item := range items {
+        product, ok := products[item.ProductID]
+        if !ok {
+            return nil, fmt.Errorf("%w: %d", ErrProductNotFound, item.ProductID)
+        }
+        if item.Quantity <= 0 || item.Quantity > maxLineQuantity {
+            return nil, fmt.Errorf("%w: quantity for %s must be between 1 and %d", ErrInvalidQuantity, product.Name, maxLineQuantity)
+        }
+        if len(product.Sizes) > 0 && !containsString(product.Sizes, item.Size) {
+            return nil, fmt.Errorf("%w: size %q is not available for %s", ErrInvalidVariant, item.Size, product.Name)
+        }
+        if len(product.Colors) > 0 && !containsString(product.Colors, item.Color) {
+            return nil, fmt.Errorf("%w: color %q is not available for %s", ErrInvalidVariant, item.Color, product.Name)
+        }
+
+        key := fmt.Sprintf("%d:%s:%s", item.ProductID, item.Size, item.Color)
+        if i, ok := index[key]; ok {
+            cart.Lines[i].Quantity += item.Quantity
+            if cart.Lines[i].Quantity > maxLineQuantity {
+                return nil, fmt.Errorf("%w: quantity for %s must be between 1 and %d", ErrInvalidQuantity, product.Name, maxLineQuantity)
+            }
+            continue
+        }
+
+        price, err := resolvePrice(product, priceList, currency)
+        if err != nil {
+            return nil, err
+        }
+
+        index[key] = len(cart.Lines)
+        cart.Lines = append(cart.Lines, CartLine{
+            ProductID:   product.ID,
+            ProductName: product.Name,
+            Category:    product.Category,
+            Size:        item.Size,
+            Color:       item.Color,
+            Quantity:    item.Quantity,
+            UnitPrice:   price,
+            Discount:    money.Zero(currency),
+            weightGrams: product.WeightGrams,
+            dimensions:  product.Dimensions,
+        })
+    }
+
+    if err := cart.recalculate(); err != nil {
+        return nil, err
+    }
+    return cart, nil
+}
+
+// ApplyCoupon validates a coupon against the cart without redeeming it.
+func (c *Cart) ApplyCoupon(code string) error {
+    discount, err := promotions.Apply(code, c.promotionCart())
+    if err != nil {
+        return err
+    }
+    return c.applyDiscount(discount)
+}
+
+// RedeemCoupon validates and counts a coupon inside the checkout
+// transaction. See promotions.Redeem for the locking guarantees.
+func (c *Cart) RedeemCoupon(tx *sql.Tx, code string) error {
+    discount, err := promotions.Redeem(tx, code, c.promotionCart())
+    if err != nil {
+        return err
+    }
+    return c.applyDiscount(discount)
+}
+
+// ApplyShipping prices the cart with the given shipping method, or the
+// cheapest one available for the destination when code is empty. The rate
+// is recomputed whenever the cart changes, since free-over-threshold
+// methods depend on the discounted subtotal.
+func (c *Cart) ApplyShipping(calculator shipping.Calculator, dest shipping.Destination, code string) error {
+    c.shippingCalculator, c.shippingDest, c.shippingCode = calculator, dest, code
+    return c.recalculate()
+}
+
+// ShippingRates lists every method available for the destination.
+func (c *Cart) ShippingRates(calculator shipping.Calculator, dest shipping.Destination) ([]shipping.Rate, error) {
+    return calculator.Rates(dest, c.parcel())
+}
+
+func (c *Cart) parcel() shipping.Parcel {
+    items := make([]shipping.Item, len(c.Lines))
+    for i, line := range c.Lines {
+        items[i] = shipping.Item{
+            WeightGrams: line.weightGrams,
+            LengthMM:    line.dimensions.Length,
+            WidthMM:     line.dimensions.Width,
+            HeightMM:    line.dimensions.Height,
+            Quantity:    line.Quantity,
+        }
+    }
+    return shipping.Parcel{Items: items, Subtotal: c.Subtotal.Sub(c.Discount)}
+}
+
+// ApplyTax taxes the cart for the shipping location. Tax is computed on
+// discounted line totals and recomputed if a coupon is applied later.
+func (c *Cart) ApplyTax(calculator tax.Calculator, loc tax.Location) error {
+    c.taxCalculator, c.taxLocation = calculator, loc
+    return c.recalculate()
+}
+
+func (c *Cart) promotionCart() promotions.Cart {
+    lines := make([]promotions.Line, len(c.Lines))
+    for i, line := range c.Lines {
+        lines[i] = promotions.Line{
+            ProductID: line.ProductID,
+            Category:  line.Category,
+            UnitPrice: line.UnitPrice,
+            Quantity:  line.Quantity,
+        }
+    }
+    return promotions.Cart{UserID: c.UserID, Currency: c.Currency, Lines: lines, Subtotal: c.Subtotal}
+}
+
+func (c *Cart) applyDiscount(discount *promotions.Discount) error {
+    c.Coupon = discount
+    for i := range c.Lines {
+        c.Lines[i].Discount = discount.LineDiscounts[i]
+    }
+    return c.recalculate()
+}
+
+func (c *Cart) recalculate() error {
+    c.Subtotal, c.Discount = money.Zero(c.Currency), money.Zero(c.Currency)
+    for i := range c.Lines {
+        line := &c.Lines[i]
+        gross := line.UnitPrice.Mul(line.Quantity)
+        line.LineTotal = gross.Sub(line.Discount)
+        c.Subtotal = c.Subtotal.Add(gross)
+        c.Discount = c.Discount.Add(line.Discount)
+    }
+
+    // Without a destination the quote shows the cheapest rate of the
+    // default zone, the catch-all an empty address falls into, or no fee
+    // when there is none
+    calculator, dest, code := c.shippingCalculator, c.shippingDest, c.shippingCode
+    c.ShippingPending = calculator == nil
+    if c.ShippingPending {
+        calculator, dest, code = shipping.Default(), shipping.Destination{}, ""
+    }
+
+    c.ShippingMethod, c.ShippingFee = nil, money.Zero(c.Currency)
+    rates, err := calculator.Rates(dest, c.parcel())
+    if err != nil {
+        return err
+    }
+    rate, err := shipping.Select(rates, code)
+    switch {
+    case err == nil:
+        c.ShippingMethod, c.ShippingFee = rate, rate.Amount
+    case !c.ShippingPending:
+        return err
+    }
+    if c.Coupon != nil && c.Coupon.FreeShipping {
+        c.ShippingFee = money.Zero(c.Currency)
+    }
+
+    // Without a location the tax is unknown, so the quote shows none
+    taxCalculator := c.taxCalculator
+    if taxCalculator == nil {
+        taxCalculator = tax.NoTax{}
+    }
+
+    taxLines := make([]tax.Line, len(c.Lines))
+    for i, line := range c.Lines {
+        taxLines[i] = tax.Line{Category: line.Category, Amount: line.LineTotal}
+    }
+
+    result, err := taxCalculator.Calculate(c.taxLocation, taxLines, c.ShippingFee)
+    if err != nil {
+        return err
+    }
+
+    for i := range c.Lines {
+        c.Lines[i].Tax = result.Lines[i]
+    }
+    c.ShippingTax = result.Shipping
+    c.Tax = result.Total
+    c.TaxIncluded = result.Total.Sub(result.Added)
+
+    c.Total = c.Subtotal.Sub(c.Discount).Add(c.ShippingFee).Add(result.Added)
+    return nil
+}
+
+func containsString(values []string, target string) bool {
+    for _, v := range values {
+        if strings.EqualFold(v, target) {
+            return true
+        }
+    }
+    return false
+}
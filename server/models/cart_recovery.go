@@ -0,0 +1,426 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"server/config"
+	"server/money"
+	"server/notifications"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+)
+
+// CartLinkTTL is how long the restore and unsubscribe links in a reminder
+// email keep working.
+const CartLinkTTL = 30 * 24 * time.Hour
+
+const (
+    cartRestorePurpose     = "cart_restore"
+    cartUnsubscribePurpose = "cart_unsubscribe"
+)
+
+var (
+    ErrCartNotFound    = errors.New("cart not found")
+    ErrInvalidCartLink = errors.New("cart link is invalid or has expired")
+)
+
+// SavedCart is the cart a signed-in user keeps between visits. Only the
+// items are stored; prices are recalculated whenever it is read.
+type SavedCart struct {
+    UserID    int             `json:"-"`
+    Items     []CartItemInput `json:"items"`
+    Currency  string          `json:"currency"`
+    UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func GetSavedCart(userID int) (*SavedCart, error) {
+    cart := &SavedCart{UserID: userID}
+    var items []byte
+    err := config.DB.QueryRow(
+        "SELECT items, currency, updated_at FROM carts WHERE user_id = $1",
+        userID,
+    ).Scan(&items, &cart.Currency, &cart.UpdatedAt)
+    if err == sql.ErrNoRows {
+        return nil, ErrCartNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if err := json.Unmarshal(items, &cart.Items); err != nil {
+        return nil, err
+    }
+    return cart, nil
+}
+
+// SaveCart replaces the user's saved cart. Saving no items deletes it.
+// Every save restarts the idle clock for abandoned cart reminders.
+func SaveCart(userID int, currency string, items []CartItemInput) error {
+    if len(items) == 0 {
+        return DeleteSavedCart(userID)
+    }
+
+    data, err := json.Marshal(items)
+    if err != nil {
+        return err
+    }
+    _, err = config.DB.Exec(`
+        INSERT INTO carts (user_id, items, currency)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (user_id) DO UPDATE
+        SET items = EXCLUDED.items, currency = EXCLUDED.currency, updated_at = NOW()`,
+        userID, data, currency,
+    )
+    return err
+}
+
+func DeleteSavedCart(userID int) error {
+    _, err := config.DB.Exec("DELETE FROM carts WHERE user_id = $1", userID)
+    return err
+}
+
+// CompleteCart clears the saved cart at checkout. When the cart had been
+// sent reminders, the order is recorded as a recovery.
+func CompleteCart(tx *sql.Tx, userID, orderID int) error {
+    _, err := tx.Exec(`
+        UPDATE cart_recoveries
+        SET order_id = $2, recovered_at = NOW()
+        WHERE id = (SELECT recovery_id FROM carts WHERE user_id = $1) AND recovered_at IS NULL`,
+        userID, orderID,
+    )
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec("DELETE FROM carts WHERE user_id = $1", userID)
+    return err
+}
+
+// SendCartReminders emails the owners of carts that have been idle longer
+// than the next interval in config.CartReminderIntervals. Each cart gets
+// at most one reminder per interval; checking out deletes the cart and
+// unsubscribing stops further reminders.
+func SendCartReminders(ctx context.Context) (int, error) {
+    intervals := make([]int64, 0, len(config.CartReminderIntervals))
+    for _, d := range config.CartReminderIntervals {
+        intervals = append(intervals, d.Milliseconds())
+    }
+    if len(intervals) == 0 {
+        return 0, nil
+    }
+
+    sent := 0
+    for {
+        if err := ctx.Err(); err != nil {
+            return sent, err
+        }
+
+        done, err := sendNextCartReminder(ctx, intervals)
+        if err != nil {
+            return sent, err
+        }
+        if done {
+            return sent, nil
+        }
+        sent++
+    }
+}
+
+func sendNextCartReminder(ctx context.Context, intervals []int64) (bool, error) {
+    tx, err := config.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return false, err
+    }
+    defer tx.Rollback()
+
+    // Saving the cart locks the row too, so a cart being edited is skipped
+    var userID, remindersSent int
+    var recoveryID sql.NullInt64
+    var items []byte
+    var email, name, locale string
+    err = tx.QueryRow(`
+        SELECT c.user_id, c.items, c.recovery_id, COALESCE(r.reminders_sent, 0), u.email, u.name, u.locale
+        FROM carts c
+        JOIN users u ON u.id = c.user_id
+        LEFT JOIN cart_recoveries r ON r.id = c.recovery_id
+        WHERE u.cart_reminders
+          AND COALESCE(r.reminders_sent, 0) < cardinality($1::bigint[])
+          AND c.updated_at <= NOW() - ($1::bigint[])[COALESCE(r.reminders_sent, 0) + 1] * INTERVAL '1 millisecond'
+        ORDER BY c.updated_at
+        LIMIT 1
+        FOR UPDATE OF c SKIP LOCKED`,
+        pq.Array(intervals),
+    ).Scan(&userID, &items, &recoveryID, &remindersSent, &email, &name, &locale)
+    if err == sql.ErrNoRows {
+        return true, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    var cartItems []CartItemInput
+    if err := json.Unmarshal(items, &cartItems); err != nil {
+        return false, err
+    }
+    lines, err := cartReminderLines(cartItems)
+    if err != nil {
+        return false, err
+    }
+    if len(lines) == 0 {
+        // Every product was removed from the catalog; nothing to recover
+        if _, err := tx.Exec("DELETE FROM carts WHERE user_id = $1", userID); err != nil {
+            return false, err
+        }
+        return false, tx.Commit()
+    }
+
+    if recoveryID.Valid {
+        _, err = tx.Exec(
+            "UPDATE cart_recoveries SET reminders_sent = reminders_sent + 1, last_reminded_at = NOW() WHERE id = $1",
+            recoveryID.Int64,
+        )
+    } else {
+        err = tx.QueryRow(
+            "INSERT INTO cart_recoveries (user_id, reminders_sent) VALUES ($1, 1) RETURNING id",
+            userID,
+        ).Scan(&recoveryID.Int64)
+        if err == nil {
+            _, err = tx.Exec("UPDATE carts SET recovery_id = $1 WHERE user_id = $2", recoveryID.Int64, userID)
+        }
+    }
+    if err != nil {
+        return false, err
+    }
+
+    restoreToken, err := signCartLink(userID, cartRestorePurpose)
+    if err != nil {
+        return false, err
+    }
+    unsubscribeToken, err := signCartLink(userID, cartUnsubscribePurpose)
+    if err != nil {
+        return false, err
+    }
+
+    // A bad address must not hold up every other cart, so the reminder
+    // still counts as sent
+    err = notifications.Enqueue(ctx, tx, notifications.Notification{
+        To:       email,
+        Template: notifications.CartReminder,
+        Locale:   locale,
+        Data: notifications.CartReminderData{
+            CustomerName:   name,
+            Items:          lines,
+            Reminder:       remindersSent + 1,
+            RestoreURL:     notifications.URL("/cart/restore?token=" + url.QueryEscape(restoreToken)),
+            UnsubscribeURL: notifications.URL("/cart/unsubscribe?token=" + url.QueryEscape(unsubscribeToken)),
+        },
+        DedupKey: fmt.Sprintf("cart_reminder:%d:%d", recoveryID.Int64, remindersSent+1),
+    })
+    if err != nil {
+        log.Printf("Failed to queue cart reminder for user %d: %v", userID, err)
+    }
+
+    return false, tx.Commit()
+}
+
+// cartReminderLines names the saved items, skipping products that no
+// longer exist.
+func cartReminderLines(items []CartItemInput) ([]notifications.CartReminderLine, error) {
+    ids := make([]int, 0, len(items))
+    for _, item := range items {
+        ids = append(ids, item.ProductID)
+    }
+    products, err := GetProductsByIDs(ids)
+    if err != nil {
+        return nil, err
+    }
+
+    lines := make([]notifications.CartReminderLine, 0, len(items))
+    for _, item := range items {
+        product, ok := products[item.ProductID]
+        if !ok {
+            continue
+        }
+        lines = append(lines, notifications.CartReminderLine{
+            Name:     product.Name,
+            Size:     item.Size,
+            Color:    item.Color,
+            Quantity: item.Quantity,
+        })
+    }
+    return lines, nil
+}
+
+// RestoreCart returns the saved cart behind a reminder's restore link and
+// records that the link was opened.
+func RestoreCart(ctx context.Context, token string) (*SavedCart, error) {
+    userID, err := parseCartLink(token, cartRestorePurpose)
+    if err != nil {
+        return nil, err
+    }
+
+    _, err = config.DB.ExecContext(ctx, `
+        UPDATE cart_recoveries SET restored_at = NOW()
+        WHERE id = (SELECT recovery_id FROM carts WHERE user_id = $1) AND restored_at IS NULL`,
+        userID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return GetSavedCart(userID)
+}
+
+// UnsubscribeCartReminders stops abandoned cart emails for the user named
+// in an unsubscribe link.
+func UnsubscribeCartReminders(ctx context.Context, token string) error {
+    userID, err := parseCartLink(token, cartUnsubscribePurpose)
+    if err != nil {
+        return err
+    }
+
+    _, err = config.DB.ExecContext(ctx, "UPDATE users SET cart_reminders = FALSE WHERE id = $1", userID)
+    return err
+}
+
+type cartLinkClaims struct {
+    Purpose string `json:"purpose"`
+    jwt.RegisteredClaims
+}
+
+// signCartLink issues a token for links in reminder emails. The purpose
+// keeps a restore token from being used to unsubscribe and vice versa.
+func signCartLink(userID int, purpose string) (string, error) {
+    claims := &cartLinkClaims{
+        Purpose: purpose,
+        RegisteredClaims: jwt.RegisteredClaims{
+            Subject:   strconv.Itoa(userID),
+            ExpiresAt: jwt.NewNumericDate(time.Now().Add(CartLinkTTL)),
+            IssuedAt:  jwt.NewNumericDate(time.Now()),
+        },
+    }
+    return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+func parseCartLink(token, purpose string) (int, error) {
+    claims := &cartLinkClaims{}
+    parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+        return []byte(os.Getenv("JWT_SECRET")), nil
+    }, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+    if err != nil || !parsed.Valid || claims.Purpose != purpose {
+        return 0, ErrInvalidCartLink
+    }
+
+    userID, err := strconv.Atoi(claims.Subject)
+    if err != nil {
+        return 0, ErrInvalidCartLink
+    }
+    return userID, nil
+}
+
+// CartRecoveryStats reports how carts that were sent reminders in a
+// period converted. A cart counts as recovered when its owner checked out
+// after at least one reminder.
+type CartRecoveryStats struct {
+    From           time.Time           `json:"from"`
+    To             time.Time           `json:"to"`
+    RemindedCarts  int                 `json:"reminded_carts"`
+    RemindersSent  int                 `json:"reminders_sent"`
+    RestoredCarts  int                 `json:"restored_carts"` // Restore link opened
+    RecoveredCarts int                 `json:"recovered_carts"`
+    ConversionRate float64             `json:"conversion_rate"` // Recovered / reminded
+    Revenue        []money.Money       `json:"revenue"`         // Recovered order totals per currency, excluding cancelled orders
+    ByReminder     []ReminderStepStats `json:"by_reminder"`
+}
+
+// ReminderStepStats groups carts by how many reminders they received.
+type ReminderStepStats struct {
+    Reminders      int     `json:"reminders"`
+    Carts          int     `json:"carts"`
+    RecoveredCarts int     `json:"recovered_carts"`
+    ConversionRate float64 `json:"conversion_rate"`
+}
+
+// GetCartRecoveryStats aggregates carts whose first reminder was sent in
+// [from, to).
+func GetCartRecoveryStats(ctx context.Context, from, to time.Time) (*CartRecoveryStats, error) {
+    stats := &CartRecoveryStats{
+        From:       from,
+        To:         to,
+        Revenue:    []money.Money{},
+        ByReminder: []ReminderStepStats{},
+    }
+
+    err := config.DB.QueryRowContext(ctx, `
+        SELECT COUNT(*), COALESCE(SUM(reminders_sent), 0), COUNT(restored_at), COUNT(recovered_at)
+        FROM cart_recoveries
+        WHERE first_reminded_at >= $1 AND first_reminded_at < $2`,
+        from, to,
+    ).Scan(&stats.RemindedCarts, &stats.RemindersSent, &stats.RestoredCarts, &stats.RecoveredCarts)
+    if err != nil {
+        return nil, err
+    }
+    stats.ConversionRate = conversionRate(stats.RecoveredCarts, stats.RemindedCarts)
+
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT reminders_sent, COUNT(*), COUNT(recovered_at)
+        FROM cart_recoveries
+        WHERE first_reminded_at >= $1 AND first_reminded_at < $2
+        GROUP BY reminders_sent
+        ORDER BY reminders_sent`,
+        from, to,
+    )
+    if err != nil {
+        return nil, err
+    }
+    for rows.Next() {
+        var step ReminderStepStats
+        if err := rows.Scan(&step.Reminders, &step.Carts, &step.RecoveredCarts); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        step.ConversionRate = conversionRate(step.RecoveredCarts, step.Carts)
+        stats.ByReminder = append(stats.ByReminder, step)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    rows, err = config.DB.QueryContext(ctx, `
+        SELECT o.currency, SUM(o.total)
+        FROM cart_recoveries r
+        JOIN orders o ON o.id = r.order_id
+        WHERE r.first_reminded_at >= $1 AND r.first_reminded_at < $2 AND o.status <> $3
+        GROUP BY o.currency
+        ORDER BY o.currency`,
+        from, to, OrderStatusCancelled,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var total money.Money
+        if err := rows.Scan(&total.Currency, &total.Amount); err != nil {
+            return nil, err
+        }
+        stats.Revenue = append(stats.Revenue, total)
+    }
+    return stats, rows.Err()
+}
+
+func conversionRate(converted, total int) float64 {
+    if total == 0 {
+        return 0
+    }
+    return float64(converted) / float64(total)
+}
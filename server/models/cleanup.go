@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"server/config"
+)
+
+// Rows deleted per statement, so cleanup never holds long locks
+const cleanupBatchSize = 1000
+
+// DeleteExpiredSessions removes sessions whose refresh token has expired.
+func DeleteExpiredSessions(ctx context.Context) (int, error) {
+    return deleteExpired(ctx, "user_sessions")
+}
+
+// DeleteExpiredBlacklistedTokens removes revoked tokens that would be
+// rejected as expired anyway.
+func DeleteExpiredBlacklistedTokens(ctx context.Context) (int, error) {
+    return deleteExpired(ctx, "blacklisted_tokens")
+}
+
+// deleteExpired deletes rows of table whose expires_at has passed, in
+// batches, until none are left or ctx is done.
+func deleteExpired(ctx context.Context, table string) (int, error) {
+    query := `
+        DELETE FROM ` + table + `
+        WHERE id IN (
+            SELECT id FROM ` + table + `
+            WHERE expires_at < NOW()
+            LIMIT $1
+        )`
+
+    total := 0
+    for {
+        result, err := config.DB.ExecContext(ctx, query, cleanupBatchSize)
+        if err != nil {
+            return total, err
+        }
+
+        n, err := result.RowsAffected()
+        if err != nil {
+            return total, err
+        }
+        total += int(n)
+        if n < cleanupBatchSize {
+            return total, nil
+        }
+    }
+}
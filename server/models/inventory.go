@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"server/config"
+	"server/events"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// RestockVariant puts returned units back into a variant's stock. Only
+// tracked variants, those with a stock row, are restocked; a variant
+// without one has unlimited stock and stays that way.
+func RestockVariant(tx *sql.Tx, productID int, size, color string, quantity int) error {
+    var stock int
+    err := tx.QueryRow(`
+        UPDATE product_variants
+        SET stock = stock + $4, updated_at = NOW()
+        WHERE product_id = $1 AND LOWER(size) = LOWER($2) AND LOWER(color) = LOWER($3)
+        RETURNING stock`,
+        productID, size, color, quantity,
+    ).Scan(&stock)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    return events.Publish(tx, events.InventoryUpdated, map[string]interface{}{
+        "product_id": productID,
+        "size":       size,
+        "color":      color,
+        "stock":      stock,
+        "change":     quantity,
+    })
+}
+
+// VariantKey identifies a product/size/color combination. Size and color
+// compare case-insensitively, like they do when a cart is built.
+func VariantKey(productID int, size, color string) string {
+    return fmt.Sprintf("%d:%s:%s", productID, strings.ToLower(size), strings.ToLower(color))
+}
+
+// GetVariantStock returns the stock of every tracked variant of the given
+// products, keyed by VariantKey. Variants without a row are not tracked
+// and count as available.
+func GetVariantStock(productIDs []int) (map[string]int, error) {
+    rows, err := config.DB.Query(
+        "SELECT product_id, size, color, stock FROM product_variants WHERE product_id = ANY($1)",
+        pq.Array(productIDs),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    stock := make(map[string]int)
+    for rows.Next() {
+        var productID, quantity int
+        var size, color string
+        if err := rows.Scan(&productID, &size, &color, &quantity); err != nil {
+            return nil, err
+        }
+        stock[VariantKey(productID, size, color)] = quantity
+    }
+
+    return stock, rows.Err()
+}
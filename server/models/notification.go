@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"server/config"
+	"server/events"
+	"server/notifications"
+)
+
+// Event subscribers that email customers. Each notification has a dedup
+// key, so a redelivered event does not send a second email.
+
+// OnOrderPaid sends the order confirmation.
+func OnOrderPaid(ctx context.Context, event events.Event) error {
+    var payload struct {
+        OrderID int `json:"order_id"`
+    }
+    if err := event.Decode(&payload); err != nil {
+        return err
+    }
+
+    order, err := GetOrderByID(payload.OrderID)
+    if err != nil {
+        return err
+    }
+    to, name, locale, err := notificationRecipient(ctx, order.UserID)
+    if err != nil {
+        return err
+    }
+
+    data := notifications.OrderConfirmationData{
+        CustomerName: name,
+        OrderID:      order.ID,
+        Items:        make([]notifications.OrderLine, 0, len(order.Items)),
+        Subtotal:     order.Subtotal,
+        Discount:     order.Discount,
+        Shipping:     order.ShippingFee,
+        Tax:          order.Tax,
+        Total:        order.Total,
+        OrderURL:     notifications.URL(fmt.Sprintf("/orders/%d", order.ID)),
+    }
+    for _, item := range order.Items {
+        data.Items = append(data.Items, notifications.OrderLine{
+            Name:     item.ProductName,
+            Size:     item.Size,
+            Color:    item.Color,
+            Quantity: item.Quantity,
+            Total:    item.UnitPrice.Mul(item.Quantity),
+        })
+    }
+
+    return notifications.Enqueue(ctx, config.DB, notifications.Notification{
+        To:       to,
+        Template: notifications.OrderConfirmation,
+        Locale:   locale,
+        Data:     data,
+        DedupKey: fmt.Sprintf("order_confirmation:%d", order.ID),
+    })
+}
+
+// OnOrderShipped sends the tracking details of a new shipment.
+func OnOrderShipped(ctx context.Context, event events.Event) error {
+    var payload struct {
+        OrderID    int `json:"order_id"`
+        ShipmentID int `json:"shipment_id"`
+    }
+    if err := event.Decode(&payload); err != nil {
+        return err
+    }
+
+    shipment, err := GetShipmentByID(payload.ShipmentID)
+    if err != nil {
+        return err
+    }
+    return enqueueShippingUpdate(ctx, payload.OrderID, notifications.ShippingUpdateData{
+        Status:         "shipped",
+        Carrier:        shipment.Carrier,
+        TrackingNumber: shipment.TrackingNumber,
+    }, fmt.Sprintf("shipping_update:shipment:%d", shipment.ID))
+}
+
+// OnOrderDelivered tells the customer the whole order arrived.
+func OnOrderDelivered(ctx context.Context, event events.Event) error {
+    var payload struct {
+        OrderID int `json:"order_id"`
+    }
+    if err := event.Decode(&payload); err != nil {
+        return err
+    }
+
+    return enqueueShippingUpdate(ctx, payload.OrderID, notifications.ShippingUpdateData{
+        Status: "delivered",
+    }, fmt.Sprintf("shipping_update:delivered:%d", payload.OrderID))
+}
+
+func enqueueShippingUpdate(ctx context.Context, orderID int, data notifications.ShippingUpdateData, dedupKey string) error {
+    order, err := GetOrderByID(orderID)
+    if err != nil {
+        return err
+    }
+    to, name, locale, err := notificationRecipient(ctx, order.UserID)
+    if err != nil {
+        return err
+    }
+
+    data.CustomerName = name
+    data.OrderID = order.ID
+    data.OrderURL = notifications.URL(fmt.Sprintf("/orders/%d", order.ID))
+    return notifications.Enqueue(ctx, config.DB, notifications.Notification{
+        To:       to,
+        Template: notifications.ShippingUpdate,
+        Locale:   locale,
+        Data:     data,
+        DedupKey: dedupKey,
+    })
+}
+
+func notificationRecipient(ctx context.Context, userID int) (email, name, locale string, err error) {
+    err = config.DB.QueryRowContext(ctx,
+        "SELECT email, name, locale FROM users WHERE id = $1",
+        userID,
+    ).Scan(&email, &name, &locale)
+    return email, name, locale, err
+}
@@ -0,0 +1,409 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/config"
+	"server/events"
+	"server/money"
+	"server/tax"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+    OrderStatusPending          = "pending"
+    OrderStatusPaid             = "paid"
+    OrderStatusPartiallyShipped = "partially_shipped"
+    OrderStatusShipped          = "shipped"
+    OrderStatusDelivered        = "delivered"
+    OrderStatusCancelled        = "cancelled"
+    OrderStatusRefunded         = "refunded"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+type Order struct {
+    ID              int         `json:"id"`
+    UserID          int         `json:"user_id"`
+    Status          string      `json:"status"`
+    Currency        string      `json:"currency"`
+    Subtotal        money.Money `json:"subtotal"`
+    Discount        money.Money `json:"discount"`
+    ShippingMethod  string      `json:"shipping_method"`
+    ShippingFee     money.Money `json:"shipping_fee"`
+    ShippingTax     money.Money `json:"shipping_tax"`
+    Tax             money.Money `json:"tax"`
+    TaxIncluded     money.Money `json:"tax_included"`
+    Total           money.Money `json:"total"`
+    Refunded        money.Money `json:"refunded"`
+    CouponCode      string      `json:"coupon_code,omitempty"`
+    ShippingAddress Address     `json:"shipping_address"`
+    Items           []OrderItem `json:"items"`
+    CreatedAt       time.Time   `json:"created_at"`
+    UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+type OrderItem struct {
+    ID          int         `json:"id"`
+    OrderID     int         `json:"order_id"`
+    ProductID   int         `json:"product_id"`
+    ProductName string      `json:"product_name"`
+    Size        string      `json:"size"`
+    Color       string      `json:"color"`
+    Quantity    int         `json:"quantity"`
+    UnitPrice   money.Money `json:"unit_price"`
+    Discount    money.Money `json:"discount"`
+    LineTotal   money.Money `json:"line_total"`
+    Tax         tax.LineTax `json:"tax"`
+
+    RefundedQuantity int `json:"refunded_quantity"`
+}
+
+// CreateOrder writes a pending order and its items from a priced and
+// taxed cart.
+func CreateOrder(tx *sql.Tx, cart *Cart, address Address) (*Order, error) {
+    order := Order{
+        UserID:          cart.UserID,
+        Status:          OrderStatusPending,
+        Currency:        cart.Currency,
+        Subtotal:        cart.Subtotal,
+        Discount:        cart.Discount,
+        ShippingFee:     cart.ShippingFee,
+        ShippingTax:     cart.ShippingTax.Amount,
+        Tax:             cart.Tax,
+        TaxIncluded:     cart.TaxIncluded,
+        Total:           cart.Total,
+        Refunded:        money.Zero(cart.Currency),
+        ShippingAddress: address,
+    }
+    if cart.Coupon != nil {
+        order.CouponCode = cart.Coupon.Code
+    }
+    if cart.ShippingMethod != nil {
+        order.ShippingMethod = cart.ShippingMethod.Method
+    }
+
+    err := tx.QueryRow(`
+        INSERT INTO orders (user_id, status, currency, subtotal, discount, shipping_fee, shipping_tax,
+            tax, tax_included, total, coupon_code, shipping_address, shipping_method)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+        RETURNING id, created_at, updated_at`,
+        order.UserID, order.Status, order.Currency, order.Subtotal.Amount, order.Discount.Amount,
+        order.ShippingFee.Amount, order.ShippingTax.Amount, order.Tax.Amount, order.TaxIncluded.Amount,
+        order.Total.Amount, order.CouponCode, order.ShippingAddress, order.ShippingMethod,
+    ).Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, line := range cart.Lines {
+        item := OrderItem{
+            OrderID:     order.ID,
+            ProductID:   line.ProductID,
+            ProductName: line.ProductName,
+            Size:        line.Size,
+            Color:       line.Color,
+            Quantity:    line.Quantity,
+            UnitPrice:   line.UnitPrice,
+            Discount:    line.Discount,
+            LineTotal:   line.LineTotal,
+            Tax:         line.Tax,
+        }
+
+        err := tx.QueryRow(`
+            INSERT INTO order_items (order_id, product_id, product_name, size, color, quantity, unit_price,
+                discount, line_total, tax, tax_rate, tax_name, tax_inclusive)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+            RETURNING id`,
+            item.OrderID, item.ProductID, item.ProductName, item.Size, item.Color,
+            item.Quantity, item.UnitPrice.Amount, item.Discount.Amount, item.LineTotal.Amount,
+            item.Tax.Amount.Amount, item.Tax.Rate, item.Tax.Name, item.Tax.Inclusive,
+        ).Scan(&item.ID)
+        if err != nil {
+            return nil, err
+        }
+
+        order.Items = append(order.Items, item)
+    }
+
+    err = events.Publish(tx, events.OrderCreated, map[string]interface{}{
+        "order_id": order.ID,
+        "user_id":  order.UserID,
+        "total":    order.Total,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    return &order, nil
+}
+
+const orderColumns = `id, user_id, status, currency, subtotal, discount, shipping_fee, shipping_tax,
+    tax, tax_included, total, refunded_amount, coupon_code, shipping_address, shipping_method,
+    created_at, updated_at`
+
+const orderItemColumns = `id, order_id, product_id, product_name, size, color, quantity,
+    unit_price, discount, line_total, tax, tax_rate, tax_name, tax_inclusive, refunded_quantity`
+
+func scanOrder(row interface{ Scan(...interface{}) error }) (*Order, error) {
+    var order Order
+    err := row.Scan(&order.ID, &order.UserID, &order.Status, &order.Currency,
+        &order.Subtotal.Amount, &order.Discount.Amount, &order.ShippingFee.Amount,
+        &order.ShippingTax.Amount, &order.Tax.Amount, &order.TaxIncluded.Amount,
+        &order.Total.Amount, &order.Refunded.Amount, &order.CouponCode, &order.ShippingAddress,
+        &order.ShippingMethod, &order.CreatedAt, &order.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, m := range []*money.Money{&order.Subtotal, &order.Discount, &order.ShippingFee,
+        &order.ShippingTax, &order.Tax, &order.TaxIncluded, &order.Total, &order.Refunded} {
+        m.Currency = order.Currency
+    }
+    return &order, nil
+}
+
+// GetOrderByID loads an order with its items.
+func GetOrderByID(orderID int) (*Order, error) {
+    order, err := scanOrder(config.DB.QueryRow(
+        "SELECT "+orderColumns+" FROM orders WHERE id = $1",
+        orderID,
+    ))
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrOrderNotFound
+        }
+        return nil, err
+    }
+
+    if order.Items, err = getOrderItems(config.DB, order.ID, order.Currency); err != nil {
+        return nil, err
+    }
+    return order, nil
+}
+
+type queryer interface {
+    Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func getOrderItems(q queryer, orderID int, currency string) ([]OrderItem, error) {
+    rows, err := q.Query(
+        "SELECT "+orderItemColumns+" FROM order_items WHERE order_id = $1 ORDER BY id",
+        orderID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    items := []OrderItem{}
+    for rows.Next() {
+        item, err := scanOrderItem(rows, currency)
+        if err != nil {
+            return nil, err
+        }
+        items = append(items, item)
+    }
+
+    return items, rows.Err()
+}
+
+func scanOrderItem(rows *sql.Rows, currency string) (OrderItem, error) {
+    var item OrderItem
+    err := rows.Scan(&item.ID, &item.OrderID, &item.ProductID, &item.ProductName, &item.Size,
+        &item.Color, &item.Quantity, &item.UnitPrice.Amount, &item.Discount.Amount,
+        &item.LineTotal.Amount, &item.Tax.Amount.Amount, &item.Tax.Rate,
+        &item.Tax.Name, &item.Tax.Inclusive, &item.RefundedQuantity)
+    if err != nil {
+        return item, err
+    }
+
+    item.UnitPrice.Currency = currency
+    item.Discount.Currency = currency
+    item.LineTotal.Currency = currency
+    item.Tax.Amount.Currency = currency
+    return item, nil
+}
+
+func IsValidOrderStatus(status string) bool {
+    switch status {
+    case OrderStatusPending, OrderStatusPaid, OrderStatusPartiallyShipped, OrderStatusShipped,
+        OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+        return true
+    }
+    return false
+}
+
+// ListUserOrders returns one page of a user's orders with their items,
+// newest first. An empty status lists orders in every status.
+func ListUserOrders(userID int, status string, limit, offset int) ([]Order, int, error) {
+    where := "WHERE user_id = $1"
+    args := []interface{}{userID}
+    if status != "" {
+        where += " AND status = $2"
+        args = append(args, status)
+    }
+
+    var total int
+    if err := config.DB.QueryRow("SELECT COUNT(*) FROM orders "+where, args...).Scan(&total); err != nil {
+        return nil, 0, err
+    }
+
+    rows, err := config.DB.Query(fmt.Sprintf(
+        "SELECT %s FROM orders %s ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d",
+        orderColumns, where, len(args)+1, len(args)+2),
+        append(args, limit, offset)...,
+    )
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    orders := []Order{}
+    index := make(map[int]int)
+    ids := make([]int, 0)
+    for rows.Next() {
+        order, err := scanOrder(rows)
+        if err != nil {
+            return nil, 0, err
+        }
+        order.Items = []OrderItem{}
+
+        index[order.ID] = len(orders)
+        ids = append(ids, order.ID)
+        orders = append(orders, *order)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, 0, err
+    }
+    if len(orders) == 0 {
+        return orders, total, nil
+    }
+
+    itemRows, err := config.DB.Query(
+        "SELECT "+orderItemColumns+" FROM order_items WHERE order_id = ANY($1) ORDER BY id",
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, 0, err
+    }
+    defer itemRows.Close()
+
+    for itemRows.Next() {
+        item, err := scanOrderItem(itemRows, "")
+        if err != nil {
+            return nil, 0, err
+        }
+
+        order := &orders[index[item.OrderID]]
+        item.UnitPrice.Currency = order.Currency
+        item.Discount.Currency = order.Currency
+        item.LineTotal.Currency = order.Currency
+        item.Tax.Amount.Currency = order.Currency
+        order.Items = append(order.Items, item)
+    }
+
+    return orders, total, itemRows.Err()
+}
+
+// HasPurchasedProduct reports whether the user has a paid (or later) order
+// containing the product. Used to flag reviews as verified purchases.
+func HasPurchasedProduct(userID, productID int) (bool, error) {
+    var exists bool
+    err := config.DB.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM orders o
+            JOIN order_items oi ON oi.order_id = o.id
+            WHERE o.user_id = $1 AND oi.product_id = $2
+              AND o.status IN ($3, $4, $5, $6)
+        )`,
+        userID, productID, OrderStatusPaid, OrderStatusPartiallyShipped, OrderStatusShipped, OrderStatusDelivered,
+    ).Scan(&exists)
+
+    return exists, err
+}
+
+const (
+    ReorderProductUnavailable = "product_unavailable"
+    ReorderVariantUnavailable = "variant_unavailable"
+    ReorderOutOfStock         = "out_of_stock"
+)
+
+// SkippedItem is an order line that could not be put back into the cart.
+type SkippedItem struct {
+    OrderItemID int    `json:"order_item_id"`
+    ProductID   int    `json:"product_id"`
+    ProductName string `json:"product_name"`
+    Size        string `json:"size"`
+    Color       string `json:"color"`
+    Reason      string `json:"reason"`
+}
+
+// ReorderItems turns a past order back into cart input. Lines whose product
+// was removed, whose size or color is no longer offered, or whose variant
+// is out of stock are skipped; quantities are capped at the stock left.
+func ReorderItems(order *Order) ([]CartItemInput, []SkippedItem, error) {
+    ids := make([]int, 0, len(order.Items))
+    for _, item := range order.Items {
+        ids = append(ids, item.ProductID)
+    }
+
+    products, err := GetProductsByIDs(ids)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    stock, err := GetVariantStock(ids)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    items := []CartItemInput{}
+    skipped := []SkippedItem{}
+    for _, item := range order.Items {
+        skip := SkippedItem{
+            OrderItemID: item.ID,
+            ProductID:   item.ProductID,
+            ProductName: item.ProductName,
+            Size:        item.Size,
+            Color:       item.Color,
+        }
+
+        product, ok := products[item.ProductID]
+        if !ok {
+            skip.Reason = ReorderProductUnavailable
+            skipped = append(skipped, skip)
+            continue
+        }
+        if (len(product.Sizes) > 0 && !containsString(product.Sizes, item.Size)) ||
+            (len(product.Colors) > 0 && !containsString(product.Colors, item.Color)) {
+            skip.Reason = ReorderVariantUnavailable
+            skipped = append(skipped, skip)
+            continue
+        }
+
+        quantity := item.Quantity
+        if left, tracked := stock[VariantKey(item.ProductID, item.Size, item.Color)]; tracked {
+            if left <= 0 {
+                skip.Reason = ReorderOutOfStock
+                skipped = append(skipped, skip)
+                continue
+            }
+            if quantity > left {
+                quantity = left
+            }
+        }
+
+        items = append(items, CartItemInput{
+            ProductID: item.ProductID,
+            Quantity:  quantity,
+            Size:      item.Size,
+            Color:     item.Color,
+        })
+    }
+
+    return items, skipped, nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"server/cache"
+	"server/config"
+	"server/notifications"
+	"time"
+)
+
+const PasswordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("reset link is invalid or has expired")
+
+// RequestPasswordReset emails a single-use reset link to the account with
+// this address. Unknown addresses are ignored without an error so callers
+// cannot probe which emails are registered.
+func RequestPasswordReset(ctx context.Context, email string) error {
+    var userID int
+    var name, locale string
+    err := config.DB.QueryRowContext(ctx,
+        "SELECT id, name, locale FROM users WHERE email = $1",
+        email,
+    ).Scan(&userID, &name, &locale)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    buf := make([]byte, 32)
+    if _, err := rand.Read(buf); err != nil {
+        return err
+    }
+    token := hex.EncodeToString(buf)
+
+    tx, err := config.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    _, err = tx.Exec(
+        "INSERT INTO password_resets (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+        userID, hashResetToken(token), time.Now().Add(PasswordResetTTL),
+    )
+    if err != nil {
+        return err
+    }
+
+    err = notifications.Enqueue(ctx, tx, notifications.Notification{
+        To:       email,
+        Template: notifications.PasswordReset,
+        Locale:   locale,
+        Data: notifications.PasswordResetData{
+            CustomerName:     name,
+            ResetURL:         notifications.URL("/reset-password?token=" + url.QueryEscape(token)),
+            ExpiresInMinutes: int(PasswordResetTTL / time.Minute),
+        },
+    })
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// ResetPassword sets a new password hash using an emailed token. Every
+// outstanding reset link of the user stops working and all sessions are
+// signed out.
+func ResetPassword(ctx context.Context, token string, passwordHash []byte) error {
+    tx, err := config.DB.BeginTx(ctx, nil)
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var userID int
+    err = tx.QueryRow(`
+        SELECT user_id FROM password_resets
+        WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+        FOR UPDATE`,
+        hashResetToken(token),
+    ).Scan(&userID)
+    if err == sql.ErrNoRows {
+        return ErrInvalidResetToken
+    }
+    if err != nil {
+        return err
+    }
+
+    if _, err = tx.Exec("UPDATE users SET password = $1 WHERE id = $2", passwordHash, userID); err != nil {
+        return err
+    }
+    if _, err = tx.Exec("UPDATE password_resets SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+        return err
+    }
+    if _, err = tx.Exec("UPDATE user_sessions SET is_active = false WHERE user_id = $1", userID); err != nil {
+        return err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return err
+    }
+
+    if err := cache.InvalidateUser(ctx, userID); err != nil {
+        log.Printf("Failed to invalidate cached user %d: %v", userID, err)
+    }
+    return nil
+}
+
+// DeleteExpiredPasswordResets removes reset tokens past their expiry.
+func DeleteExpiredPasswordResets(ctx context.Context) (int, error) {
+    return deleteExpired(ctx, "password_resets")
+}
+
+func hashResetToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,526 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"server/config"
+	"server/events"
+	"server/money"
+	"server/payments"
+	"time"
+)
+
+const (
+    PaymentStatusPending           = "pending"
+    PaymentStatusFailed            = "failed"
+    PaymentStatusCaptured          = "captured"
+    PaymentStatusPartiallyRefunded = "partially_refunded"
+    PaymentStatusRefunded          = "refunded"
+)
+
+const (
+    RefundStatusPending   = "pending"
+    RefundStatusSucceeded = "succeeded"
+    RefundStatusFailed    = "failed"
+)
+
+var (
+    ErrOrderNotPayable   = errors.New("order is not awaiting payment")
+    ErrPaymentInProgress = errors.New("a payment for this order is in progress")
+    ErrPaymentUnsettled  = errors.New("payment is not settled yet")
+    ErrRefundTooLarge    = errors.New("refund exceeds the amount left to refund")
+    ErrRefundUnsettled   = errors.New("refund is not settled yet")
+)
+
+type Payment struct {
+    ID        int         `json:"id"`
+    OrderID   int         `json:"order_id"`
+    Provider  string      `json:"provider"`
+    Reference string      `json:"reference"`
+    Amount    money.Money `json:"amount"`
+    Refunded  money.Money `json:"refunded"`
+    Status    string      `json:"status"`
+    LastError string      `json:"last_error,omitempty"`
+    Refunds   []Refund    `json:"refunds"`
+    CreatedAt time.Time   `json:"created_at"`
+}
+
+type Refund struct {
+    ID        int         `json:"id"`
+    PaymentID int         `json:"payment_id"`
+    ReturnID  *int        `json:"return_id,omitempty"`
+    Amount    money.Money `json:"amount"`
+    Reference string      `json:"reference"`
+    Reason    string      `json:"reason"`
+    Status    string      `json:"status"`
+    LastError string      `json:"last_error,omitempty"`
+    CreatedAt time.Time   `json:"created_at"`
+}
+
+// PayOrder charges the full total of a pending order through the payment
+// provider and marks it paid. The payment is recorded as pending before
+// the provider is called, so no transaction stays open during the charge
+// and a second attempt meanwhile fails with ErrPaymentInProgress. A charge
+// whose outcome is unknown or cannot be recorded stays pending for
+// ReconcilePayments and fails with ErrPaymentUnsettled.
+func PayOrder(ctx context.Context, orderID, userID int, token string) (*Payment, error) {
+    payment, err := startPayment(orderID, userID, token)
+    if err != nil {
+        return nil, err
+    }
+
+    reference, err := payments.Default().Charge(ctx, payments.ChargeRequest{
+        OrderID:        orderID,
+        Amount:         payment.Amount,
+        Token:          token,
+        IdempotencyKey: paymentKey(payment.ID),
+    })
+    if errors.Is(err, payments.ErrDeclined) {
+        if err := failPayment(payment.ID, err); err != nil {
+            return nil, fmt.Errorf("%w: %v", ErrPaymentUnsettled, err)
+        }
+        return nil, err
+    }
+    if err != nil {
+        // A timeout may still have captured; the idempotency key makes
+        // charging again safe
+        return nil, fmt.Errorf("%w: %v", ErrPaymentUnsettled, err)
+    }
+
+    if err := settlePayment(payment.ID, reference); err != nil {
+        log.Printf("Payment %d was captured as %s but could not be recorded: %v", payment.ID, reference, err)
+        config.DB.Exec("UPDATE payments SET reference = $1 WHERE id = $2 AND status = $3", reference, payment.ID, PaymentStatusPending)
+        return nil, fmt.Errorf("%w: %v", ErrPaymentUnsettled, err)
+    }
+
+    payment.Reference, payment.Status = reference, PaymentStatusCaptured
+    return payment, nil
+}
+
+// paymentKey is the provider idempotency key of a payment, so charging
+// again for the same row cannot capture twice.
+func paymentKey(paymentID int) string {
+    return fmt.Sprintf("payment-%d", paymentID)
+}
+
+// startPayment checks the order can be paid and records a pending payment
+// of its total.
+func startPayment(orderID, userID int, token string) (*Payment, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var owner int
+    var status, currency string
+    var total int64
+    err = tx.QueryRow(
+        "SELECT user_id, status, currency, total FROM orders WHERE id = $1 FOR UPDATE",
+        orderID,
+    ).Scan(&owner, &status, &currency, &total)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrOrderNotFound
+        }
+        return nil, err
+    }
+    if owner != userID {
+        return nil, ErrOrderNotFound
+    }
+    if status != OrderStatusPending {
+        return nil, ErrOrderNotPayable
+    }
+
+    var inProgress bool
+    err = tx.QueryRow(
+        "SELECT EXISTS (SELECT 1 FROM payments WHERE order_id = $1 AND status = $2)",
+        orderID, PaymentStatusPending,
+    ).Scan(&inProgress)
+    if err != nil {
+        return nil, err
+    }
+    if inProgress {
+        return nil, ErrPaymentInProgress
+    }
+
+    payment := Payment{
+        OrderID:  orderID,
+        Provider: payments.Default().Name(),
+        Amount:   money.New(total, currency),
+        Refunded: money.Zero(currency),
+        Status:   PaymentStatusPending,
+        Refunds:  []Refund{},
+    }
+    err = tx.QueryRow(`
+        INSERT INTO payments (order_id, provider, reference, amount, currency, status, token)
+        VALUES ($1, $2, '', $3, $4, $5, $6)
+        RETURNING id, created_at`,
+        orderID, payment.Provider, total, currency, payment.Status, token,
+    ).Scan(&payment.ID, &payment.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+    return &payment, nil
+}
+
+// settlePayment records a capture the provider made and marks the order
+// paid. A payment that is no longer pending is left alone.
+func settlePayment(paymentID int, reference string) error {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var orderID int
+    var amount money.Money
+    err = tx.QueryRow(`
+        UPDATE payments
+        SET status = $1, reference = $2, token = ''
+        WHERE id = $3 AND status = $4
+        RETURNING order_id, amount, currency`,
+        PaymentStatusCaptured, reference, paymentID, PaymentStatusPending,
+    ).Scan(&orderID, &amount.Amount, &amount.Currency)
+    if err == sql.ErrNoRows {
+        return nil
+    }
+    if err != nil {
+        return err
+    }
+
+    // An order cancelled during the charge keeps the capture on record
+    // for staff to refund
+    var owner int
+    err = tx.QueryRow(`
+        UPDATE orders SET status = $1, updated_at = NOW()
+        WHERE id = $2 AND status = $3
+        RETURNING user_id`,
+        OrderStatusPaid, orderID, OrderStatusPending,
+    ).Scan(&owner)
+    if err == sql.ErrNoRows {
+        log.Printf("Payment %d was captured for order %d, which is no longer pending", paymentID, orderID)
+        return tx.Commit()
+    }
+    if err != nil {
+        return err
+    }
+
+    err = events.Publish(tx, events.OrderPaid, map[string]interface{}{
+        "order_id":   orderID,
+        "user_id":    owner,
+        "payment_id": paymentID,
+        "amount":     amount,
+    })
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// failPayment marks a declined payment failed, leaving the order pending so
+// it can be paid again.
+func failPayment(paymentID int, cause error) error {
+    _, err := config.DB.Exec(
+        "UPDATE payments SET status = $1, last_error = $2, token = '' WHERE id = $3 AND status = $4",
+        PaymentStatusFailed, cause.Error(), paymentID, PaymentStatusPending,
+    )
+    return err
+}
+
+// GetPaymentsByOrder returns the payments of an order with their refunds.
+func GetPaymentsByOrder(orderID int) ([]Payment, error) {
+    rows, err := config.DB.Query(`
+        SELECT id, order_id, provider, reference, amount, refunded_amount, currency, status, last_error, created_at
+        FROM payments
+        WHERE order_id = $1
+        ORDER BY id`,
+        orderID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    result := []Payment{}
+    index := make(map[int]int)
+    for rows.Next() {
+        var p Payment
+        var currency string
+        err := rows.Scan(&p.ID, &p.OrderID, &p.Provider, &p.Reference, &p.Amount.Amount,
+                         &p.Refunded.Amount, &currency, &p.Status, &p.LastError, &p.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+        p.Amount.Currency, p.Refunded.Currency = currency, currency
+        p.Refunds = []Refund{}
+
+        index[p.ID] = len(result)
+        result = append(result, p)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    refundRows, err := config.DB.Query(`
+        SELECT r.id, r.payment_id, r.return_id, r.amount, r.reference, r.reason, r.status, r.last_error, r.created_at
+        FROM refunds r
+        JOIN payments p ON p.id = r.payment_id
+        WHERE p.order_id = $1
+        ORDER BY r.id`,
+        orderID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer refundRows.Close()
+
+    for refundRows.Next() {
+        var r Refund
+        var returnID sql.NullInt64
+        err := refundRows.Scan(&r.ID, &r.PaymentID, &returnID, &r.Amount.Amount, &r.Reference, &r.Reason,
+                                &r.Status, &r.LastError, &r.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+        if returnID.Valid {
+            id := int(returnID.Int64)
+            r.ReturnID = &id
+        }
+
+        p := &result[index[r.PaymentID]]
+        r.Amount.Currency = p.Amount.Currency
+        p.Refunds = append(p.Refunds, r)
+    }
+
+    return result, refundRows.Err()
+}
+
+// pendingRefund is a refund recorded before the provider is called.
+type pendingRefund struct {
+    Refund
+    orderID          int
+    paymentReference string
+}
+
+// reserveRefund records pending refunds for amount across the order's
+// captured payments, oldest first. The amount is held on each payment
+// right away so concurrent refunds cannot exceed what was paid. The order
+// must already be locked by the caller, who commits and then calls
+// issueRefunds.
+func reserveRefund(tx *sql.Tx, orderID int, amount money.Money, reason string, returnID *int) ([]pendingRefund, error) {
+    rows, err := tx.Query(`
+        SELECT id, reference, amount - refunded_amount
+        FROM payments
+        WHERE order_id = $1 AND status IN ($2, $3) AND amount > refunded_amount
+        ORDER BY id
+        FOR UPDATE`,
+        orderID, PaymentStatusCaptured, PaymentStatusPartiallyRefunded,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    type refundable struct {
+        id        int
+        reference string
+        left      int64
+    }
+    var sources []refundable
+    var available int64
+    for rows.Next() {
+        var src refundable
+        if err := rows.Scan(&src.id, &src.reference, &src.left); err != nil {
+            rows.Close()
+            return nil, err
+        }
+        sources = append(sources, src)
+        available += src.left
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    if amount.Amount > available {
+        return nil, ErrRefundTooLarge
+    }
+
+    remaining := amount.Amount
+    var pending []pendingRefund
+    for _, src := range sources {
+        if remaining == 0 {
+            break
+        }
+
+        part := src.left
+        if remaining < part {
+            part = remaining
+        }
+
+        refund := pendingRefund{
+            Refund: Refund{
+                PaymentID: src.id,
+                ReturnID:  returnID,
+                Amount:    money.New(part, amount.Currency),
+                Reason:    reason,
+                Status:    RefundStatusPending,
+            },
+            orderID:          orderID,
+            paymentReference: src.reference,
+        }
+        err = tx.QueryRow(`
+            INSERT INTO refunds (payment_id, return_id, amount, reference, reason, status)
+            VALUES ($1, $2, $3, '', $4, $5)
+            RETURNING id, created_at`,
+            src.id, returnID, part, reason, RefundStatusPending,
+        ).Scan(&refund.ID, &refund.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+
+        _, err = tx.Exec("UPDATE payments SET refunded_amount = refunded_amount + $1 WHERE id = $2", part, src.id)
+        if err != nil {
+            return nil, err
+        }
+
+        pending = append(pending, refund)
+        remaining -= part
+    }
+
+    return pending, nil
+}
+
+// issueRefunds calls the payment provider for each pending refund, outside
+// any transaction, and settles each one in its own transaction. It stops
+// at the first refusal and releases the refunds after it without calling
+// the provider. It returns the refusal, or ErrRefundUnsettled when the outcome of some refunds is
+// unknown or could not be recorded; those stay pending for
+// ReconcilePayments.
+func issueRefunds(ctx context.Context, pending []pendingRefund) error {
+    provider := payments.Default()
+    var failure error
+    for _, p := range pending {
+        if failure != nil {
+            if err := failRefund(p, failure); err != nil {
+                return fmt.Errorf("%w: %v", ErrRefundUnsettled, err)
+            }
+            continue
+        }
+
+        reference, err := provider.Refund(ctx, payments.RefundRequest{
+            Reference:      p.paymentReference,
+            Amount:         p.Amount,
+            IdempotencyKey: refundKey(p.ID),
+        })
+        if err != nil && !errors.Is(err, payments.ErrRefundFailed) {
+            // A timeout may still have paid out; the idempotency key makes
+            // asking again safe
+            return fmt.Errorf("%w: %v", ErrRefundUnsettled, err)
+        }
+        if err != nil {
+            failure = err
+            if err := failRefund(p, failure); err != nil {
+                return fmt.Errorf("%w: %v", ErrRefundUnsettled, err)
+            }
+            continue
+        }
+
+        if err := settleRefund(p, reference); err != nil {
+            log.Printf("Refund %d went through as %s but could not be recorded: %v", p.ID, reference, err)
+            // Keep the reference so reconciling does not depend on the provider
+            config.DB.Exec("UPDATE refunds SET reference = $1 WHERE id = $2 AND status = $3", reference, p.ID, RefundStatusPending)
+            return fmt.Errorf("%w: %v", ErrRefundUnsettled, err)
+        }
+    }
+
+    return failure
+}
+
+// refundKey is the provider idempotency key of a refund, so calling the
+// provider again for the same row cannot pay out twice.
+func refundKey(refundID int) string {
+    return fmt.Sprintf("refund-%d", refundID)
+}
+
+// settleRefund records a refund the provider made and adds it to the
+// order's refunded total. An order refunded in full moves to the refunded
+// status. A refund that is no longer pending is left alone.
+func settleRefund(p pendingRefund, reference string) error {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    result, err := tx.Exec(
+        "UPDATE refunds SET status = $1, reference = $2 WHERE id = $3 AND status = $4",
+        RefundStatusSucceeded, reference, p.ID, RefundStatusPending,
+    )
+    if err != nil {
+        return err
+    }
+    if n, err := result.RowsAffected(); err != nil || n == 0 {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE payments
+        SET status = CASE WHEN refunded_amount >= amount THEN $1 ELSE $2 END
+        WHERE id = $3`,
+        PaymentStatusRefunded, PaymentStatusPartiallyRefunded, p.PaymentID,
+    )
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE orders
+        SET refunded_amount = refunded_amount + $1,
+            status = CASE WHEN refunded_amount + $1 >= total THEN $2 ELSE status END,
+            updated_at = NOW()
+        WHERE id = $3`,
+        p.Amount.Amount, OrderStatusRefunded, p.orderID,
+    )
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// failRefund marks a refund failed and gives its amount back to the
+// payment. A refund that is no longer pending is left alone.
+func failRefund(p pendingRefund, cause error) error {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    result, err := tx.Exec(
+        "UPDATE refunds SET status = $1, last_error = $2 WHERE id = $3 AND status = $4",
+        RefundStatusFailed, cause.Error(), p.ID, RefundStatusPending,
+    )
+    if err != nil {
+        return err
+    }
+    if n, err := result.RowsAffected(); err != nil || n == 0 {
+        return err
+    }
+
+    _, err = tx.Exec("UPDATE payments SET refunded_amount = refunded_amount - $1 WHERE id = $2", p.Amount.Amount, p.PaymentID)
+    if err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
@@ -3,9 +3,10 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"server/cache"
 	"server/config"
-	"time"
+	"server/money"
 
 	"github.com/lib/pq"
 )
@@ -15,20 +16,42 @@ type Product struct{
 	Name string `json:"name"`
 	ShortDescription string `json:"short_description"`
 	Description string `json:"description"`
-	Price float64 `json:"price"`
+	Price money.Money `json:"price"`
+	Category string `json:"category"`
 	Sizes []string `json:"sizes"`
 	Colors []string `json:"colors"`
 	Images map[string]string `json:"images"` // Key-value pairs for color/image path
+	RatingAverage float64 `json:"rating_average"`
+	RatingCount int `json:"rating_count"`
+	WeightGrams int `json:"weight_grams"`
+	Dimensions Dimensions `json:"dimensions"`
 }
 
+// Package dimensions in millimetres
+type Dimensions struct {
+	Length int `json:"length_mm"`
+	Width int `json:"width_mm"`
+	Height int `json:"height_mm"`
+}
+
+var ErrProductNotFound = errors.New("product not found")
+
+// GetAllProducts returns the catalog from the cache. On a miss one caller
+// queries the database while concurrent callers wait for its result.
 func GetAllProducts() ([]Product, error) {
-     ctx := context.Background()
-      var cachedProducts []Product
-    if found, err := cache.GetCachedProducts(ctx, &cachedProducts); err == nil && found {
-        return cachedProducts, nil
-    }
+    return cache.GetOrLoad(context.Background(), cache.ProductListKey, cache.ProductCacheConfig, func(ctx context.Context) ([]Product, error) {
+        products, err := queryAllProducts()
+        if err != nil {
+            return nil, err
+        }
+        cache.TagResponse(ctx, ProductCacheTags(products)...)
+        return products, nil
+    })
+}
+
+func queryAllProducts() ([]Product, error) {
     var products []Product
-    rows, err := config.DB.Query("SELECT id, name, short_description, description, price, sizes, colors, images FROM products")
+    rows, err := config.DB.Query("SELECT id, name, short_description, description, price_minor, currency, category, sizes, colors, images, rating_sum, rating_count, weight_grams, length_mm, width_mm, height_mm FROM products")
     if err != nil {
         return nil, err
     }
@@ -37,18 +60,115 @@ func GetAllProducts() ([]Product, error) {
     for rows.Next() {
         var p Product
         var imagesRaw []byte
-        if err := rows.Scan(&p.ID, &p.Name, &p.ShortDescription, &p.Description, &p.Price, pq.Array(&p.Sizes), pq.Array(&p.Colors), &imagesRaw); err != nil {
+        var ratingSum int
+        if err := rows.Scan(&p.ID, &p.Name, &p.ShortDescription, &p.Description, &p.Price.Amount, &p.Price.Currency, &p.Category, pq.Array(&p.Sizes), pq.Array(&p.Colors), &imagesRaw, &ratingSum, &p.RatingCount, &p.WeightGrams, &p.Dimensions.Length, &p.Dimensions.Width, &p.Dimensions.Height); err != nil {
             return nil, err
         }
+        if p.RatingCount > 0 {
+            p.RatingAverage = float64(ratingSum) / float64(p.RatingCount)
+        }
         if err := json.Unmarshal(imagesRaw, &p.Images); err != nil {
             return nil, err
         }
         products = append(products, p)
     }
-go func() {
-        cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-        defer cancel()
-        cache.CacheProducts(cacheCtx, products)
-    }()
-    return products, nil
-}
\ No newline at end of file
+    return products, rows.Err()
+}
+
+// ProductCacheTags are the cache tags for data containing the products, so
+// a product update purges exactly the entries that show it.
+func ProductCacheTags(products []Product) []string {
+    tags := []string{cache.ProductListTag}
+    seen := make(map[string]bool)
+    for _, p := range products {
+        tags = append(tags, cache.ProductTag(p.ID))
+        if category := cache.CategoryTag(p.Category); !seen[category] {
+            seen[category] = true
+            tags = append(tags, category)
+        }
+    }
+    return tags
+}
+
+// GetProductsByIDs loads the given products straight from the database,
+// keyed by ID. Pricing paths use it so they never act on a stale cache.
+func GetProductsByIDs(ids []int) (map[int]Product, error) {
+    rows, err := config.DB.Query(
+        `SELECT id, name, price_minor, currency, category, sizes, colors, weight_grams, length_mm, width_mm, height_mm
+         FROM products WHERE id = ANY($1)`,
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    products := make(map[int]Product, len(ids))
+    for rows.Next() {
+        var p Product
+        if err := rows.Scan(&p.ID, &p.Name, &p.Price.Amount, &p.Price.Currency, &p.Category, pq.Array(&p.Sizes), pq.Array(&p.Colors),
+                             &p.WeightGrams, &p.Dimensions.Length, &p.Dimensions.Width, &p.Dimensions.Height); err != nil {
+            return nil, err
+        }
+        products[p.ID] = p
+    }
+
+    return products, rows.Err()
+}
+
+// GetPriceList returns the explicit per-currency prices keyed by product ID.
+func GetPriceList(currency string) (map[int]money.Money, error) {
+    rows, err := config.DB.Query(
+        "SELECT product_id, amount_minor FROM product_prices WHERE currency = $1",
+        currency,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    prices := make(map[int]money.Money)
+    for rows.Next() {
+        var productID int
+        var amount int64
+        if err := rows.Scan(&productID, &amount); err != nil {
+            return nil, err
+        }
+        prices[productID] = money.New(amount, currency)
+    }
+
+    return prices, rows.Err()
+}
+
+// LocalizeProducts returns a copy of products priced in the given currency,
+// preferring the price list and converting the base price otherwise.
+func LocalizeProducts(products []Product, currency string) ([]Product, error) {
+    priceList, err := loadPriceList(currency)
+    if err != nil {
+        return nil, err
+    }
+
+    localized := make([]Product, len(products))
+    for i, p := range products {
+        if p.Price, err = resolvePrice(p, priceList, currency); err != nil {
+            return nil, err
+        }
+        localized[i] = p
+    }
+
+    return localized, nil
+}
+
+func loadPriceList(currency string) (map[int]money.Money, error) {
+    if currency == money.BaseCurrency() {
+        return nil, nil
+    }
+    return GetPriceList(currency)
+}
+
+func resolvePrice(p Product, priceList map[int]money.Money, currency string) (money.Money, error) {
+    if price, ok := priceList[p.ID]; ok {
+        return price, nil
+    }
+    return money.Convert(p.Price, currency)
+}
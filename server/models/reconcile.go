@@ -0,0 +1,269 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"server/config"
+	"server/payments"
+	"time"
+)
+
+// SettleGrace is how long a pending payment or refund is left to the
+// request that created it before ReconcilePayments takes it over.
+var SettleGrace = 10 * time.Minute
+
+// Rows resolved per run, so a run stays short
+const reconcileBatchSize = 100
+
+// ReconcilePayments settles what a crash, timeout or database error left
+// unfinished: pending payments and refunds are sent again with the same
+// idempotency key, so the provider captures or pays out at most once, and
+// refunding returns whose refunds are all settled are finished. It returns
+// the number of rows resolved.
+func ReconcilePayments(ctx context.Context) (int, error) {
+    charges, err := reconcileCharges(ctx)
+    if err != nil {
+        return charges, err
+    }
+
+    refunds, err := reconcileRefunds(ctx)
+    if err != nil {
+        return charges + refunds, err
+    }
+
+    returns, err := reconcileReturns(ctx)
+    return charges + refunds + returns, err
+}
+
+func reconcileCharges(ctx context.Context) (int, error) {
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT id, order_id, reference, token, amount, currency
+        FROM payments
+        WHERE status = $1 AND created_at < NOW() - $2 * INTERVAL '1 millisecond'
+        ORDER BY id
+        LIMIT $3`,
+        PaymentStatusPending, SettleGrace.Milliseconds(), reconcileBatchSize,
+    )
+    if err != nil {
+        return 0, err
+    }
+
+    type pendingCharge struct {
+        id        int
+        reference string
+        request   payments.ChargeRequest
+    }
+    var pending []pendingCharge
+    for rows.Next() {
+        var c pendingCharge
+        if err := rows.Scan(&c.id, &c.request.OrderID, &c.reference, &c.request.Token,
+                            &c.request.Amount.Amount, &c.request.Amount.Currency); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        c.request.IdempotencyKey = paymentKey(c.id)
+        pending = append(pending, c)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    provider := payments.Default()
+    resolved := 0
+    for _, c := range pending {
+        if err := ctx.Err(); err != nil {
+            return resolved, err
+        }
+
+        // Captured but not recorded
+        if c.reference != "" {
+            if err := settlePayment(c.id, c.reference); err != nil {
+                return resolved, err
+            }
+            resolved++
+            continue
+        }
+
+        reference, err := provider.Charge(ctx, c.request)
+        switch {
+        case errors.Is(err, payments.ErrDeclined):
+            err = failPayment(c.id, err)
+        case err != nil:
+            log.Printf("Payment %d is still unsettled: %v", c.id, err)
+            continue
+        default:
+            err = settlePayment(c.id, reference)
+        }
+        if err != nil {
+            return resolved, err
+        }
+        resolved++
+    }
+
+    return resolved, nil
+}
+
+func reconcileRefunds(ctx context.Context) (int, error) {
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT f.id, f.payment_id, f.amount, f.reference, p.reference, p.order_id, p.currency
+        FROM refunds f
+        JOIN payments p ON p.id = f.payment_id
+        WHERE f.status = $1 AND f.created_at < NOW() - $2 * INTERVAL '1 millisecond'
+        ORDER BY f.id
+        LIMIT $3`,
+        RefundStatusPending, SettleGrace.Milliseconds(), reconcileBatchSize,
+    )
+    if err != nil {
+        return 0, err
+    }
+
+    var pending []pendingRefund
+    for rows.Next() {
+        var p pendingRefund
+        var currency string
+        if err := rows.Scan(&p.ID, &p.PaymentID, &p.Amount.Amount, &p.Reference, &p.paymentReference,
+                            &p.orderID, &currency); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        p.Amount.Currency = currency
+        pending = append(pending, p)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    provider := payments.Default()
+    resolved := 0
+    for _, p := range pending {
+        if err := ctx.Err(); err != nil {
+            return resolved, err
+        }
+
+        // Paid out but not recorded
+        if p.Reference != "" {
+            if err := settleRefund(p, p.Reference); err != nil {
+                return resolved, err
+            }
+            resolved++
+            continue
+        }
+
+        reference, err := provider.Refund(ctx, payments.RefundRequest{
+            Reference:      p.paymentReference,
+            Amount:         p.Amount,
+            IdempotencyKey: refundKey(p.ID),
+        })
+        switch {
+        case errors.Is(err, payments.ErrRefundFailed):
+            err = failRefund(p, err)
+        case err != nil:
+            log.Printf("Refund %d is still unsettled: %v", p.ID, err)
+            continue
+        default:
+            err = settleRefund(p, reference)
+        }
+        if err != nil {
+            return resolved, err
+        }
+        resolved++
+    }
+
+    return resolved, nil
+}
+
+// reconcileReturns finishes refunding returns none of whose refunds is
+// pending any more. The refunds made since the return started refunding
+// decide the outcome: any failed one sends it back to its previous status.
+func reconcileReturns(ctx context.Context) (int, error) {
+    rows, err := config.DB.QueryContext(ctx, `
+        SELECT r.id
+        FROM returns r
+        WHERE r.status = $1 AND r.updated_at < NOW() - $2 * INTERVAL '1 millisecond'
+          AND NOT EXISTS (SELECT 1 FROM refunds f WHERE f.return_id = r.id AND f.status = $3)
+        ORDER BY r.id
+        LIMIT $4`,
+        ReturnStatusRefunding, SettleGrace.Milliseconds(), RefundStatusPending, reconcileBatchSize,
+    )
+    if err != nil {
+        return 0, err
+    }
+
+    var ids []int
+    for rows.Next() {
+        var id int
+        if err := rows.Scan(&id); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        ids = append(ids, id)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    resolved := 0
+    for _, id := range ids {
+        if err := ctx.Err(); err != nil {
+            return resolved, err
+        }
+
+        // Already finished by someone else
+        err := reconcileReturn(id)
+        if errors.Is(err, ErrInvalidReturnTransition) {
+            continue
+        }
+        if err != nil {
+            return resolved, err
+        }
+        resolved++
+    }
+    return resolved, nil
+}
+
+func reconcileReturn(returnID int) error {
+    // The refunding entry of the audit trail has who started the refund;
+    // the entry before it has the status to go back to
+    var eventID, actorID int
+    var startedAt time.Time
+    err := config.DB.QueryRow(`
+        SELECT id, actor_id, created_at FROM return_events
+        WHERE return_id = $1 AND status = $2
+        ORDER BY id DESC LIMIT 1`,
+        returnID, ReturnStatusRefunding,
+    ).Scan(&eventID, &actorID, &startedAt)
+    if err != nil {
+        return err
+    }
+
+    var previous string
+    err = config.DB.QueryRow(
+        "SELECT status FROM return_events WHERE return_id = $1 AND id < $2 ORDER BY id DESC LIMIT 1",
+        returnID, eventID,
+    ).Scan(&previous)
+    if err != nil {
+        return err
+    }
+
+    var refundErr error
+    var lastError string
+    err = config.DB.QueryRow(`
+        SELECT last_error FROM refunds
+        WHERE return_id = $1 AND status = $2 AND created_at >= $3
+        ORDER BY id LIMIT 1`,
+        returnID, RefundStatusFailed, startedAt,
+    ).Scan(&lastError)
+    switch {
+    case err == nil:
+        refundErr = errors.New(lastError)
+    case err != sql.ErrNoRows:
+        return err
+    }
+
+    return finishReturnRefund(returnID, actorID, previous, refundErr, "settled by reconciliation")
+}
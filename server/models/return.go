@@ -0,0 +1,763 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/config"
+	"server/events"
+	"server/money"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+    ReturnStatusRequested = "requested"
+    ReturnStatusApproved  = "approved"
+    ReturnStatusRejected  = "rejected"
+    ReturnStatusReceived  = "received"
+    ReturnStatusRefunding = "refunding" // Waiting on the payment provider
+    ReturnStatusRefunded  = "refunded"
+)
+
+const (
+    ReturnReasonDamaged        = "damaged"
+    ReturnReasonWrongItem      = "wrong_item"
+    ReturnReasonNotAsDescribed = "not_as_described"
+    ReturnReasonSizeFit        = "size_fit"
+    ReturnReasonNoLongerNeeded = "no_longer_needed"
+    ReturnReasonOther          = "other"
+)
+
+var (
+    ErrReturnNotFound          = errors.New("return not found")
+    ErrOrderNotReturnable      = errors.New("order has not shipped yet")
+    ErrInvalidReturnItems      = errors.New("invalid return items")
+    ErrInvalidReturnTransition = errors.New("return cannot move to that status")
+)
+
+func IsValidReturnReason(reason string) bool {
+    switch reason {
+    case ReturnReasonDamaged, ReturnReasonWrongItem, ReturnReasonNotAsDescribed,
+         ReturnReasonSizeFit, ReturnReasonNoLongerNeeded, ReturnReasonOther:
+        return true
+    }
+    return false
+}
+
+func IsValidReturnStatus(status string) bool {
+    switch status {
+    case ReturnStatusRequested, ReturnStatusApproved, ReturnStatusRejected,
+         ReturnStatusReceived, ReturnStatusRefunding, ReturnStatusRefunded:
+        return true
+    }
+    return false
+}
+
+type Return struct {
+    ID        int           `json:"id"`
+    OrderID   int           `json:"order_id"`
+    UserID    int           `json:"user_id"`
+    Status    string        `json:"status"`
+    Reason    string        `json:"reason"`
+    Comment   string        `json:"comment"`
+    Refunded  money.Money   `json:"refunded"`
+    Items     []ReturnItem  `json:"items"`
+    Events    []ReturnEvent `json:"events"`
+    CreatedAt time.Time     `json:"created_at"`
+    UpdatedAt time.Time     `json:"updated_at"`
+}
+
+type ReturnItem struct {
+    OrderItemID int  `json:"order_item_id"`
+    Quantity    int  `json:"quantity"`
+    Restocked   bool `json:"restocked"`
+}
+
+// ReturnEvent is one entry of a return's audit trail.
+type ReturnEvent struct {
+    Status    string    `json:"status"`
+    ActorID   int       `json:"actor_id"`
+    Note      string    `json:"note"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateReturn opens a return request for shipped items of the user's
+// order. Each item can be returned up to the quantity shipped, less what
+// other open or completed returns already claim.
+func CreateReturn(orderID, userID int, reason, comment string, items []ReturnItem) (*Return, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var owner int
+    var status string
+    err = tx.QueryRow(
+        "SELECT user_id, status FROM orders WHERE id = $1 FOR UPDATE",
+        orderID,
+    ).Scan(&owner, &status)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrOrderNotFound
+        }
+        return nil, err
+    }
+    if owner != userID {
+        return nil, ErrOrderNotFound
+    }
+    if status != OrderStatusPartiallyShipped && status != OrderStatusShipped && status != OrderStatusDelivered {
+        return nil, ErrOrderNotReturnable
+    }
+
+    returnable, err := returnableQuantities(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    items, err = resolveReturnItems(items, returnable)
+    if err != nil {
+        return nil, err
+    }
+
+    ret := Return{OrderID: orderID, UserID: userID, Status: ReturnStatusRequested, Reason: reason, Comment: comment}
+    err = tx.QueryRow(`
+        INSERT INTO returns (order_id, user_id, status, reason, comment)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING id`,
+        orderID, userID, ret.Status, reason, comment,
+    ).Scan(&ret.ID)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, item := range items {
+        _, err = tx.Exec(
+            "INSERT INTO return_items (return_id, order_item_id, quantity) VALUES ($1, $2, $3)",
+            ret.ID, item.OrderItemID, item.Quantity,
+        )
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if err = addReturnEvent(tx, ret.ID, ReturnStatusRequested, userID, comment); err != nil {
+        return nil, err
+    }
+
+    err = events.Publish(tx, events.ReturnRequested, map[string]interface{}{
+        "return_id": ret.ID,
+        "order_id":  orderID,
+        "user_id":   userID,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return GetReturnByID(ret.ID)
+}
+
+func returnableQuantities(tx *sql.Tx, orderID int) (map[int]int, error) {
+    rows, err := tx.Query(`
+        SELECT oi.id, COALESCE(s.quantity, 0) - COALESCE(r.quantity, 0)
+        FROM order_items oi
+        LEFT JOIN (
+            SELECT order_item_id, SUM(quantity) AS quantity
+            FROM shipment_items
+            GROUP BY order_item_id
+        ) s ON s.order_item_id = oi.id
+        LEFT JOIN (
+            SELECT ri.order_item_id, SUM(ri.quantity) AS quantity
+            FROM return_items ri
+            JOIN returns rt ON rt.id = ri.return_id
+            WHERE rt.status <> $2
+            GROUP BY ri.order_item_id
+        ) r ON r.order_item_id = oi.id
+        WHERE oi.order_id = $1`,
+        orderID, ReturnStatusRejected,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    returnable := make(map[int]int)
+    for rows.Next() {
+        var id, qty int
+        if err := rows.Scan(&id, &qty); err != nil {
+            return nil, err
+        }
+        returnable[id] = qty
+    }
+
+    return returnable, rows.Err()
+}
+
+func resolveReturnItems(items []ReturnItem, returnable map[int]int) ([]ReturnItem, error) {
+    if len(items) == 0 {
+        return nil, fmt.Errorf("%w: at least one item is required", ErrInvalidReturnItems)
+    }
+
+    merged := make(map[int]int)
+    resolved := make([]ReturnItem, 0, len(items))
+    for _, item := range items {
+        left, ok := returnable[item.OrderItemID]
+        if !ok {
+            return nil, fmt.Errorf("%w: item %d does not belong to this order", ErrInvalidReturnItems, item.OrderItemID)
+        }
+        if item.Quantity <= 0 {
+            return nil, fmt.Errorf("%w: quantity for item %d must be positive", ErrInvalidReturnItems, item.OrderItemID)
+        }
+
+        if _, seen := merged[item.OrderItemID]; !seen {
+            resolved = append(resolved, ReturnItem{OrderItemID: item.OrderItemID})
+        }
+        merged[item.OrderItemID] += item.Quantity
+        if merged[item.OrderItemID] > left {
+            return nil, fmt.Errorf("%w: only %d of item %d can be returned", ErrInvalidReturnItems, left, item.OrderItemID)
+        }
+    }
+
+    for i := range resolved {
+        resolved[i].Quantity = merged[resolved[i].OrderItemID]
+    }
+    return resolved, nil
+}
+
+func ApproveReturn(returnID, actorID int, note string) (*Return, error) {
+    return transitionReturn(returnID, actorID, ReturnStatusRequested, ReturnStatusApproved, note)
+}
+
+func RejectReturn(returnID, actorID int, note string) (*Return, error) {
+    return transitionReturn(returnID, actorID, ReturnStatusRequested, ReturnStatusRejected, note)
+}
+
+func transitionReturn(returnID, actorID int, from, to, note string) (*Return, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err = lockReturn(tx, returnID, from); err != nil {
+        return nil, err
+    }
+    if err = setReturnStatus(tx, returnID, to, actorID, note); err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+    return GetReturnByID(returnID)
+}
+
+// ReceiveReturn records that the returned parcel arrived. With restock set
+// the units go back into the inventory of the ordered size and color;
+// damaged goods are received without restocking.
+func ReceiveReturn(returnID, actorID int, note string, restock bool) (*Return, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    if _, err = lockReturn(tx, returnID, ReturnStatusApproved); err != nil {
+        return nil, err
+    }
+
+    if restock {
+        rows, err := tx.Query(`
+            SELECT oi.product_id, oi.size, oi.color, ri.quantity
+            FROM return_items ri
+            JOIN order_items oi ON oi.id = ri.order_item_id
+            WHERE ri.return_id = $1`,
+            returnID,
+        )
+        if err != nil {
+            return nil, err
+        }
+
+        type unit struct {
+            productID   int
+            size, color string
+            quantity    int
+        }
+        var units []unit
+        for rows.Next() {
+            var u unit
+            if err := rows.Scan(&u.productID, &u.size, &u.color, &u.quantity); err != nil {
+                rows.Close()
+                return nil, err
+            }
+            units = append(units, u)
+        }
+        rows.Close()
+        if err := rows.Err(); err != nil {
+            return nil, err
+        }
+
+        for _, u := range units {
+            if err := RestockVariant(tx, u.productID, u.size, u.color, u.quantity); err != nil {
+                return nil, err
+            }
+        }
+
+        if _, err = tx.Exec("UPDATE return_items SET restocked = true WHERE return_id = $1", returnID); err != nil {
+            return nil, err
+        }
+    }
+
+    if err = setReturnStatus(tx, returnID, ReturnStatusReceived, actorID, note); err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+    return GetReturnByID(returnID)
+}
+
+// RefundReturn refunds an approved or received return through the payment
+// provider. The amount due is the returned share of each line, tax
+// included; the return that completes an order also refunds its shipping.
+// A smaller amount, in minor units of the order currency, may be given for
+// a partial refund, e.g. to withhold a restocking fee; it is final and
+// closes the return like a full one.
+//
+// The refund is recorded as pending and the return marked refunding
+// before the provider is called, so no transaction stays open during the
+// call. If the provider refuses the return goes back to its previous
+// status and can be refunded again; whatever went through is kept on the
+// return. If the outcome is unknown or cannot be recorded the return stays
+// refunding, so a retry cannot pay twice.
+func RefundReturn(ctx context.Context, returnID, actorID int, amount *int64, note string) (*Return, error) {
+    pending, previous, err := startReturnRefund(returnID, actorID, amount, note)
+    if err != nil {
+        return nil, err
+    }
+
+    refundErr := issueRefunds(ctx, pending)
+    if errors.Is(refundErr, ErrRefundUnsettled) {
+        // The return stays refunding until ReconcilePayments settles it
+        return nil, refundErr
+    }
+    if err := finishReturnRefund(returnID, actorID, previous, refundErr, note); err != nil {
+        return nil, err
+    }
+    if refundErr != nil {
+        return nil, refundErr
+    }
+    return GetReturnByID(returnID)
+}
+
+// startReturnRefund works out what is due for a return, records it as
+// pending refunds and moves the return to refunding. It returns the
+// pending refunds and the status to go back to if the provider fails.
+func startReturnRefund(returnID, actorID int, amount *int64, note string) ([]pendingRefund, string, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, "", err
+    }
+    defer tx.Rollback()
+
+    // Lock the order before the return, like every other order update
+    var orderID int
+    err = tx.QueryRow("SELECT order_id FROM returns WHERE id = $1", returnID).Scan(&orderID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, "", ErrReturnNotFound
+        }
+        return nil, "", err
+    }
+
+    order, err := scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", orderID))
+    if err != nil {
+        return nil, "", err
+    }
+    if order.Items, err = getOrderItems(tx, orderID, order.Currency); err != nil {
+        return nil, "", err
+    }
+
+    previous, err := lockReturn(tx, returnID, ReturnStatusApproved, ReturnStatusReceived)
+    if err != nil {
+        return nil, "", err
+    }
+
+    quantities, err := getReturnQuantities(tx, returnID)
+    if err != nil {
+        return nil, "", err
+    }
+
+    // An earlier attempt may have paid back part of it already
+    var alreadyPaid int64
+    if err = tx.QueryRow("SELECT refunded_amount FROM returns WHERE id = $1", returnID).Scan(&alreadyPaid); err != nil {
+        return nil, "", err
+    }
+
+    due := returnDue(order, quantities).Sub(money.New(alreadyPaid, order.Currency))
+    if due.Amount < 0 {
+        due = money.Zero(order.Currency)
+    }
+    if amount != nil {
+        if *amount > due.Amount {
+            return nil, "", ErrRefundTooLarge
+        }
+        due = money.New(*amount, order.Currency)
+    }
+
+    var pending []pendingRefund
+    if due.Amount > 0 {
+        if pending, err = reserveRefund(tx, orderID, due, note, &returnID); err != nil {
+            return nil, "", err
+        }
+    }
+
+    if err = setReturnStatus(tx, returnID, ReturnStatusRefunding, actorID, "Refunding "+due.Display()); err != nil {
+        return nil, "", err
+    }
+
+    return pending, previous, tx.Commit()
+}
+
+// finishReturnRefund records the outcome of the provider calls on a
+// refunding return. What the return got back is the sum of its succeeded
+// refunds. On success the units that sum covers count as refunded and the
+// return moves to refunded; otherwise it goes back to previous. It fails
+// with ErrRefundUnsettled while any of its refunds is still pending.
+func finishReturnRefund(returnID, actorID int, previous string, refundErr error, note string) error {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+
+    var orderID int
+    err = tx.QueryRow("SELECT order_id FROM returns WHERE id = $1", returnID).Scan(&orderID)
+    if err != nil {
+        return err
+    }
+
+    order, err := scanOrder(tx.QueryRow("SELECT "+orderColumns+" FROM orders WHERE id = $1 FOR UPDATE", orderID))
+    if err != nil {
+        return err
+    }
+
+    if _, err = lockReturn(tx, returnID, ReturnStatusRefunding); err != nil {
+        return err
+    }
+
+    var recorded, total int64
+    var unsettled int
+    err = tx.QueryRow(`
+        SELECT r.refunded_amount,
+               COALESCE(SUM(f.amount) FILTER (WHERE f.status = $2), 0),
+               COUNT(f.id) FILTER (WHERE f.status = $3)
+        FROM returns r
+        LEFT JOIN refunds f ON f.return_id = r.id
+        WHERE r.id = $1
+        GROUP BY r.id`,
+        returnID, RefundStatusSucceeded, RefundStatusPending,
+    ).Scan(&recorded, &total, &unsettled)
+    if err != nil {
+        return err
+    }
+    if unsettled > 0 {
+        return ErrRefundUnsettled
+    }
+
+    if _, err = tx.Exec("UPDATE returns SET refunded_amount = $1 WHERE id = $2", total, returnID); err != nil {
+        return err
+    }
+
+    paid := money.New(total-recorded, order.Currency)
+    if paid.Amount > 0 {
+        err = events.Publish(tx, events.RefundIssued, map[string]interface{}{
+            "order_id":  orderID,
+            "return_id": returnID,
+            "user_id":   order.UserID,
+            "amount":    paid,
+        })
+        if err != nil {
+            return err
+        }
+    }
+
+    if refundErr != nil {
+        eventNote := "Refund failed: " + refundErr.Error()
+        if paid.Amount > 0 {
+            eventNote += " (" + paid.Display() + " went through)"
+        }
+        if err = setReturnStatus(tx, returnID, previous, actorID, eventNote); err != nil {
+            return err
+        }
+        return tx.Commit()
+    }
+
+    if order.Items, err = getOrderItems(tx, orderID, order.Currency); err != nil {
+        return err
+    }
+    quantities, err := getReturnQuantities(tx, returnID)
+    if err != nil {
+        return err
+    }
+    for itemID, qty := range paidQuantities(order, quantities, money.New(total, order.Currency)) {
+        _, err = tx.Exec("UPDATE order_items SET refunded_quantity = refunded_quantity + $1 WHERE id = $2", qty, itemID)
+        if err != nil {
+            return err
+        }
+    }
+
+    eventNote := "Refunded " + money.New(total, order.Currency).Display()
+    if note != "" {
+        eventNote += ": " + note
+    }
+    if err = setReturnStatus(tx, returnID, ReturnStatusRefunded, actorID, eventNote); err != nil {
+        return err
+    }
+
+    return tx.Commit()
+}
+
+// getReturnQuantities returns the returned quantity per order item.
+func getReturnQuantities(tx *sql.Tx, returnID int) (map[int]int, error) {
+    rows, err := tx.Query("SELECT order_item_id, quantity FROM return_items WHERE return_id = $1", returnID)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    quantities := make(map[int]int)
+    for rows.Next() {
+        var id, qty int
+        if err := rows.Scan(&id, &qty); err != nil {
+            return nil, err
+        }
+        quantities[id] += qty
+    }
+    return quantities, rows.Err()
+}
+
+// returnDue is the full refund for the returned quantities: each line's
+// share, plus shipping and its tax when the return completes the order.
+func returnDue(order *Order, quantities map[int]int) money.Money {
+    due := money.Zero(order.Currency)
+    itemsGross := money.Zero(order.Currency)
+    complete := true
+    for _, item := range order.Items {
+        itemsGross = itemsGross.Add(item.refundableTotal())
+
+        qty := quantities[item.ID]
+        if qty > 0 {
+            due = due.Add(item.refundShare(item.RefundedQuantity, qty))
+        }
+        if item.RefundedQuantity+qty < item.Quantity {
+            complete = false
+        }
+    }
+
+    // What the order total holds beyond its lines is shipping and its tax
+    if complete {
+        due = due.Add(order.Total.Sub(itemsGross))
+    }
+    return due
+}
+
+// paidQuantities is how many of the returned units paid pays back in
+// full, line by line. A partial refund closes the return, so the units it
+// does not cover are withheld for good: they stay unrefunded, and since
+// they cannot be returned again no later return completes the order and
+// refunds its shipping.
+func paidQuantities(order *Order, quantities map[int]int, paid money.Money) map[int]int {
+    counted := make(map[int]int)
+    remaining := paid.Amount
+    for _, item := range order.Items {
+        for n := 0; n < quantities[item.ID]; n++ {
+            share := item.refundShare(item.RefundedQuantity+n, 1)
+            if share.Amount > remaining {
+                break
+            }
+            remaining -= share.Amount
+            counted[item.ID]++
+        }
+    }
+    return counted
+}
+
+// refundableTotal is what the customer paid for the line: the discounted
+// total plus any tax charged on top of it.
+func (item OrderItem) refundableTotal() money.Money {
+    if item.Tax.Inclusive {
+        return item.LineTotal
+    }
+    return item.LineTotal.Add(item.Tax.Amount)
+}
+
+// refundShare is the refund for quantity more units when already units
+// were refunded before. Shares are cut from the running total so that
+// refunding every unit, in any split, adds up to the exact line total.
+func (item OrderItem) refundShare(already, quantity int) money.Money {
+    total := item.refundableTotal()
+    upTo := func(n int) int64 { return total.Amount * int64(n) / int64(item.Quantity) }
+    return money.New(upTo(already+quantity)-upTo(already), total.Currency)
+}
+
+// lockReturn locks the return row and checks it is in one of the allowed
+// statuses.
+func lockReturn(tx *sql.Tx, returnID int, allowed ...string) (string, error) {
+    var status string
+    err := tx.QueryRow("SELECT status FROM returns WHERE id = $1 FOR UPDATE", returnID).Scan(&status)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return "", ErrReturnNotFound
+        }
+        return "", err
+    }
+
+    for _, s := range allowed {
+        if status == s {
+            return status, nil
+        }
+    }
+    return "", fmt.Errorf("%w: return is %s", ErrInvalidReturnTransition, status)
+}
+
+func setReturnStatus(tx *sql.Tx, returnID int, status string, actorID int, note string) error {
+    _, err := tx.Exec("UPDATE returns SET status = $1, updated_at = NOW() WHERE id = $2", status, returnID)
+    if err != nil {
+        return err
+    }
+    return addReturnEvent(tx, returnID, status, actorID, note)
+}
+
+func addReturnEvent(tx *sql.Tx, returnID int, status string, actorID int, note string) error {
+    _, err := tx.Exec(
+        "INSERT INTO return_events (return_id, status, actor_id, note) VALUES ($1, $2, $3, $4)",
+        returnID, status, actorID, note,
+    )
+    return err
+}
+
+const returnColumns = `r.id, r.order_id, r.user_id, r.status, r.reason, r.comment, r.refunded_amount,
+    o.currency, r.created_at, r.updated_at`
+
+func GetReturnByID(returnID int) (*Return, error) {
+    returns, err := queryReturns("WHERE r.id = $1", "", returnID)
+    if err != nil {
+        return nil, err
+    }
+    if len(returns) == 0 {
+        return nil, ErrReturnNotFound
+    }
+    return &returns[0], nil
+}
+
+// ListReturnsByStatus backs the staff returns queue, oldest first.
+func ListReturnsByStatus(status string, limit, offset int) ([]Return, int, error) {
+    var total int
+    err := config.DB.QueryRow("SELECT COUNT(*) FROM returns WHERE status = $1", status).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    returns, err := queryReturns("WHERE r.status = $1", "ORDER BY r.created_at ASC, r.id ASC LIMIT $2 OFFSET $3",
+                                 status, limit, offset)
+    return returns, total, err
+}
+
+// ListUserReturns lists a customer's returns, newest first.
+func ListUserReturns(userID, limit, offset int) ([]Return, int, error) {
+    var total int
+    err := config.DB.QueryRow("SELECT COUNT(*) FROM returns WHERE user_id = $1", userID).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    returns, err := queryReturns("WHERE r.user_id = $1", "ORDER BY r.created_at DESC, r.id DESC LIMIT $2 OFFSET $3",
+                                 userID, limit, offset)
+    return returns, total, err
+}
+
+func queryReturns(where, tail string, args ...interface{}) ([]Return, error) {
+    rows, err := config.DB.Query(
+        "SELECT "+returnColumns+" FROM returns r JOIN orders o ON o.id = r.order_id "+where+" "+tail,
+        args...,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    returns := []Return{}
+    index := make(map[int]int)
+    ids := make([]int, 0)
+    for rows.Next() {
+        var ret Return
+        err := rows.Scan(&ret.ID, &ret.OrderID, &ret.UserID, &ret.Status, &ret.Reason, &ret.Comment,
+                         &ret.Refunded.Amount, &ret.Refunded.Currency, &ret.CreatedAt, &ret.UpdatedAt)
+        if err != nil {
+            return nil, err
+        }
+        ret.Items, ret.Events = []ReturnItem{}, []ReturnEvent{}
+
+        index[ret.ID] = len(returns)
+        ids = append(ids, ret.ID)
+        returns = append(returns, ret)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    if len(returns) == 0 {
+        return returns, nil
+    }
+
+    itemRows, err := config.DB.Query(
+        "SELECT return_id, order_item_id, quantity, restocked FROM return_items WHERE return_id = ANY($1) ORDER BY id",
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer itemRows.Close()
+
+    for itemRows.Next() {
+        var returnID int
+        var item ReturnItem
+        if err := itemRows.Scan(&returnID, &item.OrderItemID, &item.Quantity, &item.Restocked); err != nil {
+            return nil, err
+        }
+        ret := &returns[index[returnID]]
+        ret.Items = append(ret.Items, item)
+    }
+    if err := itemRows.Err(); err != nil {
+        return nil, err
+    }
+
+    eventRows, err := config.DB.Query(
+        "SELECT return_id, status, actor_id, note, created_at FROM return_events WHERE return_id = ANY($1) ORDER BY id",
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer eventRows.Close()
+
+    for eventRows.Next() {
+        var returnID int
+        var event ReturnEvent
+        if err := eventRows.Scan(&returnID, &event.Status, &event.ActorID, &event.Note, &event.CreatedAt); err != nil {
+            return nil, err
+        }
+        ret := &returns[index[returnID]]
+        ret.Events = append(ret.Events, event)
+    }
+
+    return returns, eventRows.Err()
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/config"
+	"server/events"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+    ReviewStatusPending  = "pending"
+    ReviewStatusApproved = "approved"
+    ReviewStatusRejected = "rejected"
+)
+
+var (
+    ErrReviewExists   = errors.New("review already exists for this product")
+    ErrReviewNotFound = errors.New("review not found")
+)
+
+type Review struct {
+    ID               int        `json:"id"`
+    ProductID        int        `json:"product_id"`
+    UserID           int        `json:"user_id"`
+    UserName         string     `json:"user_name"`
+    Rating           int        `json:"rating"`
+    Title            string     `json:"title"`
+    Body             string     `json:"body"`
+    VerifiedPurchase bool       `json:"verified_purchase"`
+    Status           string     `json:"status"`
+    ModerationNote   string     `json:"moderation_note,omitempty"`
+    ModeratedAt      *time.Time `json:"moderated_at,omitempty"`
+    CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Sort orders accepted by ListProductReviews, keyed by the ?sort= value.
+var reviewSortOrders = map[string]string{
+    "newest":  "r.created_at DESC, r.id DESC",
+    "oldest":  "r.created_at ASC, r.id ASC",
+    "highest": "r.rating DESC, r.created_at DESC",
+    "lowest":  "r.rating ASC, r.created_at DESC",
+}
+
+func IsValidReviewSort(sort string) bool {
+    _, ok := reviewSortOrders[sort]
+    return ok
+}
+
+const reviewColumns = `r.id, r.product_id, r.user_id, u.name, r.rating, r.title, r.body,
+    r.verified_purchase, r.status, r.moderation_note, r.moderated_at, r.created_at`
+
+// CreateReview stores a new review in the moderation queue. The verified
+// purchase flag is derived from the user's orders, never from the client.
+func CreateReview(productID, userID, rating int, title, body string) (*Review, error) {
+    verified, err := HasPurchasedProduct(userID, productID)
+    if err != nil {
+        return nil, err
+    }
+
+    var review Review
+    err = config.DB.QueryRow(`
+        INSERT INTO reviews (product_id, user_id, rating, title, body, verified_purchase, status)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING id, product_id, user_id, rating, title, body, verified_purchase, status, created_at`,
+        productID, userID, rating, title, body, verified, ReviewStatusPending,
+    ).Scan(&review.ID, &review.ProductID, &review.UserID, &review.Rating, &review.Title,
+           &review.Body, &review.VerifiedPurchase, &review.Status, &review.CreatedAt)
+
+    if err != nil {
+        var pqErr *pq.Error
+        if errors.As(err, &pqErr) {
+            switch pqErr.Code {
+            case "23505":
+                return nil, ErrReviewExists
+            case "23503":
+                return nil, ErrProductNotFound
+            }
+        }
+        return nil, err
+    }
+
+    return &review, nil
+}
+
+// ListProductReviews returns one page of approved reviews for a product
+// together with the total number of approved reviews.
+func ListProductReviews(productID int, sort string, limit, offset int) ([]Review, int, error) {
+    order, ok := reviewSortOrders[sort]
+    if !ok {
+        order = reviewSortOrders["newest"]
+    }
+
+    var total int
+    err := config.DB.QueryRow(
+        "SELECT COUNT(*) FROM reviews WHERE product_id = $1 AND status = $2",
+        productID, ReviewStatusApproved,
+    ).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    rows, err := config.DB.Query(fmt.Sprintf(`
+        SELECT %s
+        FROM reviews r
+        JOIN users u ON u.id = r.user_id
+        WHERE r.product_id = $1 AND r.status = $2
+        ORDER BY %s
+        LIMIT $3 OFFSET $4`, reviewColumns, order),
+        productID, ReviewStatusApproved, limit, offset,
+    )
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    reviews, err := scanReviews(rows)
+    return reviews, total, err
+}
+
+// ListReviewsByStatus backs the staff moderation queue, oldest first so
+// reviews are handled in the order they were submitted.
+func ListReviewsByStatus(status string, limit, offset int) ([]Review, int, error) {
+    var total int
+    err := config.DB.QueryRow(
+        "SELECT COUNT(*) FROM reviews WHERE status = $1",
+        status,
+    ).Scan(&total)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    rows, err := config.DB.Query(fmt.Sprintf(`
+        SELECT %s
+        FROM reviews r
+        JOIN users u ON u.id = r.user_id
+        WHERE r.status = $1
+        ORDER BY r.created_at ASC, r.id ASC
+        LIMIT $2 OFFSET $3`, reviewColumns),
+        status, limit, offset,
+    )
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    reviews, err := scanReviews(rows)
+    return reviews, total, err
+}
+
+// ModerateReview moves a review to approved or rejected and adjusts the
+// product's rating aggregates in the same transaction. Only transitions
+// into or out of the approved state touch the aggregates.
+func ModerateReview(reviewID, moderatorID int, status, note string) (*Review, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var productID, rating int
+    var previous string
+    err = tx.QueryRow(
+        "SELECT product_id, rating, status FROM reviews WHERE id = $1 FOR UPDATE",
+        reviewID,
+    ).Scan(&productID, &rating, &previous)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrReviewNotFound
+        }
+        return nil, err
+    }
+
+    _, err = tx.Exec(`
+        UPDATE reviews
+        SET status = $1, moderated_by = $2, moderation_note = $3, moderated_at = NOW(), updated_at = NOW()
+        WHERE id = $4`,
+        status, moderatorID, note, reviewID,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    delta := 0
+    if previous != ReviewStatusApproved && status == ReviewStatusApproved {
+        delta = 1
+    } else if previous == ReviewStatusApproved && status != ReviewStatusApproved {
+        delta = -1
+    }
+
+    if delta != 0 {
+        _, err = tx.Exec(`
+            UPDATE products
+            SET rating_sum = rating_sum + $1, rating_count = rating_count + $2
+            WHERE id = $3`,
+            delta*rating, delta, productID,
+        )
+        if err != nil {
+            return nil, err
+        }
+
+        // Product responses embed the aggregates; subscribers drop cached copies
+        if err = events.Publish(tx, events.ProductUpdated, map[string]interface{}{"product_id": productID}); err != nil {
+            return nil, err
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return GetReviewByID(reviewID)
+}
+
+func GetReviewByID(reviewID int) (*Review, error) {
+    rows, err := config.DB.Query(fmt.Sprintf(`
+        SELECT %s
+        FROM reviews r
+        JOIN users u ON u.id = r.user_id
+        WHERE r.id = $1`, reviewColumns),
+        reviewID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    reviews, err := scanReviews(rows)
+    if err != nil {
+        return nil, err
+    }
+    if len(reviews) == 0 {
+        return nil, ErrReviewNotFound
+    }
+
+    return &reviews[0], nil
+}
+
+func scanReviews(rows *sql.Rows) ([]Review, error) {
+    reviews := []Review{}
+    for rows.Next() {
+        var review Review
+        var moderatedAt sql.NullTime
+
+        err := rows.Scan(&review.ID, &review.ProductID, &review.UserID, &review.UserName,
+                         &review.Rating, &review.Title, &review.Body, &review.VerifiedPurchase,
+                         &review.Status, &review.ModerationNote, &moderatedAt, &review.CreatedAt)
+        if err != nil {
+            return nil, err
+        }
+
+        if moderatedAt.Valid {
+            review.ModeratedAt = &moderatedAt.Time
+        }
+
+        reviews = append(reviews, review)
+    }
+
+    return reviews, rows.Err()
+}
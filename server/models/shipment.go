@@ -0,0 +1,441 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"server/config"
+	"server/events"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+    ShipmentStatusShipped        = "shipped"
+    ShipmentStatusInTransit      = "in_transit"
+    ShipmentStatusOutForDelivery = "out_for_delivery"
+    ShipmentStatusDelivered      = "delivered"
+    ShipmentStatusException      = "exception"
+)
+
+var (
+    ErrShipmentNotFound      = errors.New("shipment not found")
+    ErrOrderNotShippable     = errors.New("order cannot be shipped in its current status")
+    ErrInvalidShipmentItems  = errors.New("invalid shipment items")
+    ErrInvalidShipmentStatus = errors.New("invalid shipment status")
+)
+
+func IsValidShipmentStatus(status string) bool {
+    switch status {
+    case ShipmentStatusShipped, ShipmentStatusInTransit, ShipmentStatusOutForDelivery,
+         ShipmentStatusDelivered, ShipmentStatusException:
+        return true
+    }
+    return false
+}
+
+type Shipment struct {
+    ID             int             `json:"id"`
+    OrderID        int             `json:"order_id"`
+    Carrier        string          `json:"carrier"`
+    TrackingNumber string          `json:"tracking_number"`
+    Status         string          `json:"status"`
+    Items          []ShipmentItem  `json:"items"`
+    Events         []ShipmentEvent `json:"events"`
+    ShippedAt      time.Time       `json:"shipped_at"`
+    DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+    CreatedAt      time.Time       `json:"created_at"`
+    UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type ShipmentItem struct {
+    OrderItemID int `json:"order_item_id"`
+    Quantity    int `json:"quantity"`
+}
+
+type ShipmentEvent struct {
+    Status      string    `json:"status"`
+    Description string    `json:"description"`
+    Location    string    `json:"location"`
+    OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// CreateShipment records a (possibly partial) shipment for a paid order.
+// An empty item list ships everything that has not shipped yet. The order
+// moves to shipped once every item is covered, partially_shipped before.
+func CreateShipment(orderID int, carrier, trackingNumber string, items []ShipmentItem) (*Shipment, error) {
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    // Lock the order so concurrent shipments cannot both claim the same items
+    var status string
+    err = tx.QueryRow("SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&status)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrOrderNotFound
+        }
+        return nil, err
+    }
+    if status != OrderStatusPaid && status != OrderStatusPartiallyShipped {
+        return nil, ErrOrderNotShippable
+    }
+
+    remaining, err := unshippedQuantities(tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    items, err = resolveShipmentItems(items, remaining)
+    if err != nil {
+        return nil, err
+    }
+
+    var shipment Shipment
+    err = tx.QueryRow(`
+        INSERT INTO shipments (order_id, carrier, tracking_number, status)
+        VALUES ($1, $2, $3, $4)
+        RETURNING id, shipped_at`,
+        orderID, carrier, trackingNumber, ShipmentStatusShipped,
+    ).Scan(&shipment.ID, &shipment.ShippedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, item := range items {
+        _, err = tx.Exec(
+            "INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES ($1, $2, $3)",
+            shipment.ID, item.OrderItemID, item.Quantity,
+        )
+        if err != nil {
+            return nil, err
+        }
+        remaining[item.OrderItemID] -= item.Quantity
+    }
+
+    _, err = tx.Exec(
+        "INSERT INTO shipment_events (shipment_id, status, description, occurred_at) VALUES ($1, $2, $3, $4)",
+        shipment.ID, ShipmentStatusShipped, "Shipment handed to carrier", shipment.ShippedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    next := OrderStatusShipped
+    for _, qty := range remaining {
+        if qty > 0 {
+            next = OrderStatusPartiallyShipped
+            break
+        }
+    }
+
+    if _, err = tx.Exec("UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2", next, orderID); err != nil {
+        return nil, err
+    }
+
+    err = events.Publish(tx, events.OrderShipped, map[string]interface{}{
+        "order_id":     orderID,
+        "shipment_id":  shipment.ID,
+        "order_status": next,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return GetShipmentByID(shipment.ID)
+}
+
+// unshippedQuantities maps each order item to the quantity not yet covered
+// by a shipment.
+func unshippedQuantities(tx *sql.Tx, orderID int) (map[int]int, error) {
+    rows, err := tx.Query(`
+        SELECT oi.id, oi.quantity - COALESCE(SUM(si.quantity), 0)
+        FROM order_items oi
+        LEFT JOIN shipment_items si ON si.order_item_id = oi.id
+        WHERE oi.order_id = $1
+        GROUP BY oi.id, oi.quantity`,
+        orderID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    remaining := make(map[int]int)
+    for rows.Next() {
+        var id, qty int
+        if err := rows.Scan(&id, &qty); err != nil {
+            return nil, err
+        }
+        remaining[id] = qty
+    }
+
+    return remaining, rows.Err()
+}
+
+func resolveShipmentItems(items []ShipmentItem, remaining map[int]int) ([]ShipmentItem, error) {
+    if len(items) == 0 {
+        for id, qty := range remaining {
+            if qty > 0 {
+                items = append(items, ShipmentItem{OrderItemID: id, Quantity: qty})
+            }
+        }
+        if len(items) == 0 {
+            return nil, fmt.Errorf("%w: every item has already shipped", ErrInvalidShipmentItems)
+        }
+        return items, nil
+    }
+
+    // Merge repeated items before checking them against what is left
+    merged := make(map[int]int)
+    resolved := make([]ShipmentItem, 0, len(items))
+    for _, item := range items {
+        left, ok := remaining[item.OrderItemID]
+        if !ok {
+            return nil, fmt.Errorf("%w: item %d does not belong to this order", ErrInvalidShipmentItems, item.OrderItemID)
+        }
+        if item.Quantity <= 0 {
+            return nil, fmt.Errorf("%w: quantity for item %d must be positive", ErrInvalidShipmentItems, item.OrderItemID)
+        }
+
+        if _, seen := merged[item.OrderItemID]; !seen {
+            resolved = append(resolved, ShipmentItem{OrderItemID: item.OrderItemID})
+        }
+        merged[item.OrderItemID] += item.Quantity
+        if merged[item.OrderItemID] > left {
+            return nil, fmt.Errorf("%w: only %d of item %d left to ship", ErrInvalidShipmentItems, left, item.OrderItemID)
+        }
+    }
+
+    for i := range resolved {
+        resolved[i].Quantity = merged[resolved[i].OrderItemID]
+    }
+    return resolved, nil
+}
+
+// UpdateShipment corrects the carrier or tracking number. Empty values
+// leave the current ones untouched.
+func UpdateShipment(shipmentID int, carrier, trackingNumber string) (*Shipment, error) {
+    result, err := config.DB.Exec(`
+        UPDATE shipments
+        SET carrier = COALESCE(NULLIF($1, ''), carrier),
+            tracking_number = COALESCE(NULLIF($2, ''), tracking_number),
+            updated_at = NOW()
+        WHERE id = $3`,
+        carrier, trackingNumber, shipmentID,
+    )
+    if err != nil {
+        return nil, err
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return nil, ErrShipmentNotFound
+    }
+
+    return GetShipmentByID(shipmentID)
+}
+
+// AddShipmentEvent appends a tracking event and, unless an event that
+// occurred later is already recorded, moves the shipment to its status. When the last shipment of a fully shipped order is delivered the
+// order becomes delivered too.
+func AddShipmentEvent(shipmentID int, event ShipmentEvent) (*Shipment, error) {
+    if !IsValidShipmentStatus(event.Status) {
+        return nil, ErrInvalidShipmentStatus
+    }
+    if event.OccurredAt.IsZero() {
+        event.OccurredAt = time.Now()
+    }
+
+    tx, err := config.DB.Begin()
+    if err != nil {
+        return nil, err
+    }
+    defer tx.Rollback()
+
+    var orderID int
+    err = tx.QueryRow("SELECT order_id FROM shipments WHERE id = $1", shipmentID).Scan(&orderID)
+    if err != nil {
+        if err == sql.ErrNoRows {
+            return nil, ErrShipmentNotFound
+        }
+        return nil, err
+    }
+
+    // Same lock order as CreateShipment: order first, then its shipments
+    var orderStatus string
+    err = tx.QueryRow("SELECT status FROM orders WHERE id = $1 FOR UPDATE", orderID).Scan(&orderStatus)
+    if err != nil {
+        return nil, err
+    }
+
+    // Carriers can report out of order; an event older than the latest one
+    // is kept in the history but does not change the shipment's status
+    var latestAt sql.NullTime
+    err = tx.QueryRow("SELECT MAX(occurred_at) FROM shipment_events WHERE shipment_id = $1", shipmentID).Scan(&latestAt)
+    if err != nil {
+        return nil, err
+    }
+    latest := !latestAt.Valid || !event.OccurredAt.Before(latestAt.Time)
+
+    _, err = tx.Exec(`
+        INSERT INTO shipment_events (shipment_id, status, description, location, occurred_at)
+        VALUES ($1, $2, $3, $4, $5)`,
+        shipmentID, event.Status, event.Description, event.Location, event.OccurredAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    if !latest {
+        if err = tx.Commit(); err != nil {
+            return nil, err
+        }
+        return GetShipmentByID(shipmentID)
+    }
+
+    _, err = tx.Exec(`
+        UPDATE shipments
+        SET status = $1,
+            delivered_at = CASE WHEN $1 = 'delivered' THEN $2::timestamp ELSE delivered_at END,
+            updated_at = NOW()
+        WHERE id = $3`,
+        event.Status, event.OccurredAt, shipmentID,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    if orderStatus == OrderStatusShipped && event.Status == ShipmentStatusDelivered {
+        var undelivered int
+        err = tx.QueryRow(
+            "SELECT COUNT(*) FROM shipments WHERE order_id = $1 AND status <> $2",
+            orderID, ShipmentStatusDelivered,
+        ).Scan(&undelivered)
+        if err != nil {
+            return nil, err
+        }
+
+        if undelivered == 0 {
+            _, err = tx.Exec("UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2", OrderStatusDelivered, orderID)
+            if err != nil {
+                return nil, err
+            }
+
+            if err = events.Publish(tx, events.OrderDelivered, map[string]interface{}{"order_id": orderID}); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    if err = tx.Commit(); err != nil {
+        return nil, err
+    }
+
+    return GetShipmentByID(shipmentID)
+}
+
+const shipmentColumns = `id, order_id, carrier, tracking_number, status, shipped_at, delivered_at, created_at, updated_at`
+
+func GetShipmentByID(shipmentID int) (*Shipment, error) {
+    shipments, err := loadShipments("WHERE id = $1", shipmentID)
+    if err != nil {
+        return nil, err
+    }
+    if len(shipments) == 0 {
+        return nil, ErrShipmentNotFound
+    }
+    return &shipments[0], nil
+}
+
+// GetShipmentsByOrder returns every shipment of an order, oldest first,
+// with items and tracking history.
+func GetShipmentsByOrder(orderID int) ([]Shipment, error) {
+    return loadShipments("WHERE order_id = $1", orderID)
+}
+
+func loadShipments(where string, arg interface{}) ([]Shipment, error) {
+    rows, err := config.DB.Query("SELECT "+shipmentColumns+" FROM shipments "+where+" ORDER BY id", arg)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    shipments := []Shipment{}
+    index := make(map[int]int)
+    ids := make([]int, 0)
+    for rows.Next() {
+        var s Shipment
+        var deliveredAt sql.NullTime
+        err := rows.Scan(&s.ID, &s.OrderID, &s.Carrier, &s.TrackingNumber, &s.Status,
+                         &s.ShippedAt, &deliveredAt, &s.CreatedAt, &s.UpdatedAt)
+        if err != nil {
+            return nil, err
+        }
+        if deliveredAt.Valid {
+            s.DeliveredAt = &deliveredAt.Time
+        }
+        s.Items, s.Events = []ShipmentItem{}, []ShipmentEvent{}
+
+        index[s.ID] = len(shipments)
+        ids = append(ids, s.ID)
+        shipments = append(shipments, s)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+    if len(shipments) == 0 {
+        return shipments, nil
+    }
+
+    itemRows, err := config.DB.Query(
+        "SELECT shipment_id, order_item_id, quantity FROM shipment_items WHERE shipment_id = ANY($1) ORDER BY id",
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer itemRows.Close()
+
+    for itemRows.Next() {
+        var shipmentID int
+        var item ShipmentItem
+        if err := itemRows.Scan(&shipmentID, &item.OrderItemID, &item.Quantity); err != nil {
+            return nil, err
+        }
+        s := &shipments[index[shipmentID]]
+        s.Items = append(s.Items, item)
+    }
+    if err := itemRows.Err(); err != nil {
+        return nil, err
+    }
+
+    eventRows, err := config.DB.Query(`
+        SELECT shipment_id, status, description, location, occurred_at
+        FROM shipment_events
+        WHERE shipment_id = ANY($1)
+        ORDER BY occurred_at, id`,
+        pq.Array(ids),
+    )
+    if err != nil {
+        return nil, err
+    }
+    defer eventRows.Close()
+
+    for eventRows.Next() {
+        var shipmentID int
+        var event ShipmentEvent
+        if err := eventRows.Scan(&shipmentID, &event.Status, &event.Description, &event.Location, &event.OccurredAt); err != nil {
+            return nil, err
+        }
+        s := &shipments[index[shipmentID]]
+        s.Events = append(s.Events, event)
+    }
+
+    return shipments, eventRows.Err()
+}
@@ -4,8 +4,10 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"server/cache"
 	"server/config"
+	"server/events"
 	"time"
 )
 
@@ -14,9 +16,26 @@ type User struct {
     Name      string    `json:"name"`
     Email     string    `json:"email"`
     Password  string    `json:"password,omitempty"`
+    Role      string    `json:"role"`
     CreatedAt time.Time `json:"created_at"`
 }
 
+const (
+    RoleCustomer = "customer"
+    RoleStaff    = "staff"
+    RoleAdmin    = "admin"
+)
+
+// IsStaff reports whether the user may access staff-only tools such as
+// the review moderation queue.
+func (u *User) IsStaff() bool {
+    return u.Role == RoleStaff || u.Role == RoleAdmin
+}
+
+func (u *User) IsAdmin() bool {
+    return u.Role == RoleAdmin
+}
+
 type UserSession struct {
     ID           int       `json:"id"`
     UserID       int       `json:"user_id"`
@@ -36,8 +55,9 @@ type BlacklistedToken struct {
     CreatedAt time.Time `json:"created_at"`
 }
 
-// Create user with device session
-func CreateUser(name, email string, password []byte, ipAddress, device, deviceID string) (*User, *UserSession, error) {
+// Create user with device session. locale selects the language of the
+// user's emails.
+func CreateUser(name, email string, password []byte, locale, ipAddress, device, deviceID string) (*User, *UserSession, error) {
     tx, err := config.DB.Begin()
     if err != nil {
         return nil, nil, err
@@ -46,9 +66,9 @@ func CreateUser(name, email string, password []byte, ipAddress, device, deviceID
 
     var user User
     err = tx.QueryRow(
-        "INSERT INTO users (name, email, password) VALUES ($1, $2, $3) RETURNING id, name, email, created_at",
-        name, email, password,
-    ).Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
+        "INSERT INTO users (name, email, password, locale) VALUES ($1, $2, $3, $4) RETURNING id, name, email, role, created_at",
+        name, email, password, locale,
+    ).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt)
     
     if err != nil {
         return nil, nil, err
@@ -60,10 +80,22 @@ func CreateUser(name, email string, password []byte, ipAddress, device, deviceID
         return nil, nil, err
     }
 
+    err = events.Publish(tx, events.UserCreated, map[string]interface{}{
+        "user_id": user.ID,
+        "email":   user.Email,
+        "name":    user.Name,
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+
     if err = tx.Commit(); err != nil {
         return nil, nil, err
     }
 
+    // Drops a negative entry left by a lookup of the ID before it existed
+    cache.InvalidateUser(context.Background(), user.ID)
+
     return &user, session, nil
 }
 
@@ -80,9 +112,9 @@ func GetUserByEmail(email string) (*User, error) {
     // Cache miss - query database
     var user User
     err := config.DB.QueryRow(
-        "SELECT id, name, email, password, created_at FROM users WHERE email = $1",
+        "SELECT id, name, email, password, role, created_at FROM users WHERE email = $1",
         email,
-    ).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.CreatedAt)
+    ).Scan(&user.ID, &user.Name, &user.Email, &user.Password, &user.Role, &user.CreatedAt)
     
     if err != nil {
         return nil, err
@@ -101,35 +133,35 @@ func GetUserByEmail(email string) (*User, error) {
 } 
 
 func GetUserByID(userID int) (*User, error) {
-    ctx := context.Background()
-    
-    // Try cache first
-    var cachedUser User
-    if found, err := cache.GetCachedUser(ctx, userID, &cachedUser); err == nil && found {
-        return &cachedUser, nil
+    // Unknown IDs are cached too, so repeated lookups skip the database
+    user, err := cache.GetOrLoad(context.Background(), cache.UserKey(userID), cache.UserCacheConfig, func(ctx context.Context) (User, error) {
+        var user User
+        err := config.DB.QueryRowContext(ctx,
+            "SELECT id, name, email, role, created_at FROM users WHERE id = $1",
+            userID,
+        ).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.CreatedAt)
+        if err == sql.ErrNoRows {
+            return user, cache.ErrNotFound
+        }
+        return user, err
+    })
+    if errors.Is(err, cache.ErrNotFound) {
+        return nil, sql.ErrNoRows
     }
-
-    // Cache miss - query database
-    var user User
-    err := config.DB.QueryRow(
-        "SELECT id, name, email, created_at FROM users WHERE id = $1",
-        userID,
-    ).Scan(&user.ID, &user.Name, &user.Email, &user.CreatedAt)
-    
     if err != nil {
         return nil, err
     }
-    
-    // Cache the user (async)
-    go func() {
-        cacheCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-        defer cancel()
-        cache.CacheUser(cacheCtx, user.ID, user)
-    }()
-    
     return &user, nil
 }
 
+// GetUserRole reads a user's role from the database, bypassing the cache,
+// so a role change takes effect on the next privileged request.
+func GetUserRole(userID int) (string, error) {
+    var role string
+    err := config.DB.QueryRow("SELECT role FROM users WHERE id = $1", userID).Scan(&role)
+    return role, err
+}
+
 func CreateUserSession(tx *sql.Tx, userID int, ipAddress, device, deviceID string) (*UserSession, error) {
     var session UserSession
     err := tx.QueryRow(`
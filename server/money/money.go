@@ -0,0 +1,206 @@
+// Package money represents monetary amounts as integer minor units plus an
+// ISO 4217 currency code, so totals and refunds never suffer float drift.
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type Money struct {
+    Amount   int64  // Minor units, e.g. cents
+    Currency string // ISO 4217 code
+}
+
+// Minor unit exponents for currencies that do not use two decimals
+var exponents = map[string]int{
+    "JPY": 0,
+    "KRW": 0,
+    "VND": 0,
+    "BHD": 3,
+    "KWD": 3,
+    "OMR": 3,
+}
+
+// Exponent returns the number of minor-unit digits for the currency.
+func Exponent(currency string) int {
+    if exp, ok := exponents[currency]; ok {
+        return exp
+    }
+    return 2
+}
+
+func New(amount int64, currency string) Money {
+    return Money{Amount: amount, Currency: currency}
+}
+
+func Zero(currency string) Money {
+    return Money{Currency: currency}
+}
+
+// FromMajor converts a decimal amount such as 19.99 to minor units,
+// rounding half away from zero.
+func FromMajor(value float64, currency string) Money {
+    scale := math.Pow10(Exponent(currency))
+    return Money{Amount: int64(math.Round(value * scale)), Currency: currency}
+}
+
+// NormalizeCurrency upper-cases and validates a three-letter code.
+func NormalizeCurrency(code string) (string, bool) {
+    code = strings.ToUpper(strings.TrimSpace(code))
+    if len(code) != 3 {
+        return "", false
+    }
+    for _, c := range code {
+        if c < 'A' || c > 'Z' {
+            return "", false
+        }
+    }
+    return code, true
+}
+
+func (m Money) mustMatch(other Money) {
+    if m.Currency != other.Currency {
+        panic(fmt.Sprintf("money: currency mismatch %s vs %s", m.Currency, other.Currency))
+    }
+}
+
+func (m Money) Add(other Money) Money {
+    m.mustMatch(other)
+    return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}
+}
+
+func (m Money) Sub(other Money) Money {
+    m.mustMatch(other)
+    return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}
+}
+
+func (m Money) Mul(quantity int) Money {
+    return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// Percent returns percent% of m, rounded half away from zero.
+func (m Money) Percent(percent float64) Money {
+    return Money{Amount: int64(math.Round(float64(m.Amount) * percent / 100)), Currency: m.Currency}
+}
+
+func (m Money) Min(other Money) Money {
+    m.mustMatch(other)
+    if other.Amount < m.Amount {
+        return other
+    }
+    return m
+}
+
+func (m Money) Cmp(other Money) int {
+    m.mustMatch(other)
+    switch {
+    case m.Amount < other.Amount:
+        return -1
+    case m.Amount > other.Amount:
+        return 1
+    }
+    return 0
+}
+
+func (m Money) IsZero() bool {
+    return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+    return m.Amount < 0
+}
+
+// Allocate splits m across the given weights without losing minor units.
+// Remainders go to the parts with the largest fractional share.
+func (m Money) Allocate(weights []int64) []Money {
+    parts := make([]Money, len(weights))
+    var total int64
+    for i, w := range weights {
+        parts[i] = Zero(m.Currency)
+        total += w
+    }
+    if total == 0 {
+        return parts
+    }
+
+    type remainder struct {
+        index int
+        frac  int64
+    }
+    var allocated int64
+    rems := make([]remainder, len(weights))
+    for i, w := range weights {
+        share := m.Amount * w / total
+        parts[i].Amount = share
+        allocated += share
+        rems[i] = remainder{index: i, frac: m.Amount * w % total}
+    }
+
+    left := m.Amount - allocated
+    for left > 0 {
+        best := -1
+        for i, r := range rems {
+            if weights[r.index] > 0 && (best == -1 || r.frac > rems[best].frac) {
+                best = i
+            }
+        }
+        parts[rems[best].index].Amount++
+        rems[best].frac = -1
+        left--
+    }
+
+    return parts
+}
+
+// Display formats the amount in major units without a symbol, e.g. "19.99".
+func (m Money) Display() string {
+    exp := Exponent(m.Currency)
+    sign := ""
+    amount := m.Amount
+    if amount < 0 {
+        sign = "-"
+        amount = -amount
+    }
+    if exp == 0 {
+        return sign + strconv.FormatInt(amount, 10)
+    }
+
+    scale := int64(math.Pow10(exp))
+    return fmt.Sprintf("%s%d.%0*d", sign, amount/scale, exp, amount%scale)
+}
+
+func (m Money) String() string {
+    return m.Display() + " " + m.Currency
+}
+
+type moneyJSON struct {
+    Amount   int64  `json:"amount"`
+    Currency string `json:"currency"`
+    Display  string `json:"display,omitempty"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+    return json.Marshal(moneyJSON{Amount: m.Amount, Currency: m.Currency, Display: m.Display()})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+    var v moneyJSON
+    if err := json.Unmarshal(data, &v); err != nil {
+        return err
+    }
+
+    if v.Currency != "" {
+        currency, ok := NormalizeCurrency(v.Currency)
+        if !ok {
+            return fmt.Errorf("money: invalid currency %q", v.Currency)
+        }
+        v.Currency = currency
+    }
+
+    m.Amount, m.Currency = v.Amount, v.Currency
+    return nil
+}
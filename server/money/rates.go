@@ -0,0 +1,133 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+)
+
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// RateSource provides exchange rates between currencies.
+type RateSource interface {
+    // Rate returns how many units of `to` one unit of `from` buys.
+    Rate(from, to string) (float64, error)
+    Currencies() []string
+}
+
+// StaticRates is a RateSource backed by a fixed table relative to Base,
+// typically loaded from a JSON file such as exchange_rates.json.
+type StaticRates struct {
+    Base  string             `json:"base"`
+    Rates map[string]float64 `json:"rates"`
+}
+
+func (s *StaticRates) rate(currency string) (float64, bool) {
+    if currency == s.Base {
+        return 1, true
+    }
+    r, ok := s.Rates[currency]
+    return r, ok && r > 0
+}
+
+func (s *StaticRates) Rate(from, to string) (float64, error) {
+    fromRate, ok := s.rate(from)
+    if !ok {
+        return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+    }
+    toRate, ok := s.rate(to)
+    if !ok {
+        return 0, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, to)
+    }
+    return toRate / fromRate, nil
+}
+
+func (s *StaticRates) Currencies() []string {
+    currencies := []string{s.Base}
+    for c := range s.Rates {
+        if c != s.Base {
+            currencies = append(currencies, c)
+        }
+    }
+    sort.Strings(currencies[1:])
+    return currencies
+}
+
+// LoadStaticRates reads a {"base": "USD", "rates": {"EUR": 0.92}} file.
+func LoadStaticRates(path string) (*StaticRates, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var rates StaticRates
+    if err := json.Unmarshal(data, &rates); err != nil {
+        return nil, fmt.Errorf("failed to parse exchange rates: %w", err)
+    }
+
+    base, ok := NormalizeCurrency(rates.Base)
+    if !ok {
+        return nil, fmt.Errorf("invalid base currency %q", rates.Base)
+    }
+    rates.Base = base
+    return &rates, nil
+}
+
+var (
+    ratesMu      sync.RWMutex
+    baseCurrency            = "USD"
+    rateSource   RateSource = &StaticRates{Base: "USD"}
+)
+
+// SetRateSource installs the exchange-rate source used by Convert. The
+// base currency is the one catalog prices are stored in.
+func SetRateSource(base string, source RateSource) {
+    ratesMu.Lock()
+    defer ratesMu.Unlock()
+    baseCurrency = base
+    rateSource = source
+}
+
+func BaseCurrency() string {
+    ratesMu.RLock()
+    defer ratesMu.RUnlock()
+    return baseCurrency
+}
+
+// IsSupported reports whether prices can be shown in the currency.
+func IsSupported(currency string) bool {
+    ratesMu.RLock()
+    source := rateSource
+    ratesMu.RUnlock()
+
+    for _, c := range source.Currencies() {
+        if c == currency {
+            return true
+        }
+    }
+    return false
+}
+
+// Convert changes m into the target currency using the configured source,
+// rounding half away from zero in the target's minor units.
+func Convert(m Money, to string) (Money, error) {
+    if m.Currency == to {
+        return m, nil
+    }
+
+    ratesMu.RLock()
+    source := rateSource
+    ratesMu.RUnlock()
+
+    rate, err := source.Rate(m.Currency, to)
+    if err != nil {
+        return Money{}, err
+    }
+
+    scale := math.Pow10(Exponent(to) - Exponent(m.Currency))
+    return Money{Amount: int64(math.Round(float64(m.Amount) * rate * scale)), Currency: to}, nil
+}
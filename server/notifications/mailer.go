@@ -0,0 +1,181 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends through an SMTP relay, upgrading to TLS with STARTTLS
+// when the server offers it. Port 465 uses implicit TLS.
+type SMTPMailer struct {
+    Host     string
+    Port     int
+    Username string // Authentication is skipped when empty
+    Password string
+    Timeout  time.Duration
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+    from, err := mail.ParseAddress(msg.From)
+    if err != nil {
+        return fmt.Errorf("invalid sender: %w", err)
+    }
+    body, err := buildMIME(msg)
+    if err != nil {
+        return err
+    }
+
+    timeout := m.Timeout
+    if timeout <= 0 {
+        timeout = 30 * time.Second
+    }
+    dialer := net.Dialer{Timeout: timeout}
+    conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.Host, strconv.Itoa(m.Port)))
+    if err != nil {
+        return err
+    }
+    conn.SetDeadline(time.Now().Add(timeout))
+
+    tlsConfig := &tls.Config{ServerName: m.Host}
+    if m.Port == 465 {
+        conn = tls.Client(conn, tlsConfig)
+    }
+
+    client, err := smtp.NewClient(conn, m.Host)
+    if err != nil {
+        conn.Close()
+        return err
+    }
+    defer client.Close()
+
+    if m.Port != 465 {
+        if ok, _ := client.Extension("STARTTLS"); ok {
+            if err := client.StartTLS(tlsConfig); err != nil {
+                return err
+            }
+        }
+    }
+    if m.Username != "" {
+        if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+            return err
+        }
+    }
+
+    if err := client.Mail(from.Address); err != nil {
+        return err
+    }
+    if err := client.Rcpt(msg.To); err != nil {
+        return err
+    }
+    w, err := client.Data()
+    if err != nil {
+        return err
+    }
+    if _, err := w.Write(body); err != nil {
+        return err
+    }
+    if err := w.Close(); err != nil {
+        return err
+    }
+    return client.Quit()
+}
+
+// FileMailer is the development inbox: every message is written to Dir as
+// an .eml file that any mail client can open.
+type FileMailer struct {
+    Dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+    body, err := buildMIME(msg)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+        return err
+    }
+
+    name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+    path := filepath.Join(m.Dir, name)
+    if err := os.WriteFile(path, body, 0o644); err != nil {
+        return err
+    }
+
+    log.Printf("Email %q to %s written to %s", msg.Subject, msg.To, path)
+    return nil
+}
+
+// buildMIME encodes msg as a multipart/alternative message with a plain
+// text and, when present, an HTML part.
+func buildMIME(msg Message) ([]byte, error) {
+    if strings.ContainsAny(msg.From+msg.To, "\r\n") {
+        return nil, fmt.Errorf("invalid address header")
+    }
+
+    var buf bytes.Buffer
+    parts := multipart.NewWriter(&buf)
+
+    header := func(key, value string) {
+        fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+    }
+    header("From", msg.From)
+    header("To", msg.To)
+    header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+    header("Date", time.Now().Format(time.RFC1123Z))
+    if msg.ID != "" {
+        domain := "localhost"
+        if from, err := mail.ParseAddress(msg.From); err == nil {
+            if _, d, ok := strings.Cut(from.Address, "@"); ok {
+                domain = d
+            }
+        }
+        header("Message-ID", fmt.Sprintf("<%s@%s>", msg.ID, domain))
+    }
+    header("MIME-Version", "1.0")
+    header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+    buf.WriteString("\r\n")
+
+    bodies := []struct{ contentType, content string }{{"text/plain", msg.Text}}
+    if msg.HTML != "" {
+        bodies = append(bodies, struct{ contentType, content string }{"text/html", msg.HTML})
+    }
+    for _, body := range bodies {
+        part, err := parts.CreatePart(textproto.MIMEHeader{
+            "Content-Type":              {body.contentType + "; charset=utf-8"},
+            "Content-Transfer-Encoding": {"quoted-printable"},
+        })
+        if err != nil {
+            return nil, err
+        }
+        qp := quotedprintable.NewWriter(part)
+        if _, err := qp.Write([]byte(body.content)); err != nil {
+            return nil, err
+        }
+        if err := qp.Close(); err != nil {
+            return nil, err
+        }
+    }
+
+    if err := parts.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+// Package notifications renders transactional emails from per-locale
+// templates and sends them through a queue that retries failed sends.
+package notifications
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Message is a rendered email ready for a Mailer.
+type Message struct {
+    ID      string // Used for the Message-ID header
+    From    string
+    To      string
+    Subject string
+    Text    string
+    HTML    string
+}
+
+// Mailer delivers one message. An error leaves the message queued for
+// another attempt.
+type Mailer interface {
+    Send(ctx context.Context, msg Message) error
+}
+
+type Config struct {
+    From    string // e.g. "Shop <no-reply@example.com>"
+    BaseURL string // Storefront URL that links in emails point to
+}
+
+var (
+    mu       sync.RWMutex
+    mailer   Mailer = &FileMailer{Dir: "mail"}
+    settings        = Config{From: "Shop <no-reply@localhost>", BaseURL: "http://localhost:3000"}
+)
+
+func SetMailer(m Mailer) {
+    mu.Lock()
+    defer mu.Unlock()
+    mailer = m
+}
+
+// Default returns the mailer configured at startup.
+func Default() Mailer {
+    mu.RLock()
+    defer mu.RUnlock()
+    return mailer
+}
+
+func Configure(cfg Config) {
+    mu.Lock()
+    defer mu.Unlock()
+    cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+    settings = cfg
+}
+
+func currentConfig() Config {
+    mu.RLock()
+    defer mu.RUnlock()
+    return settings
+}
+
+// URL builds an absolute storefront link for use in email data.
+func URL(path string) string {
+    return currentConfig().BaseURL + "/" + strings.TrimLeft(path, "/")
+}
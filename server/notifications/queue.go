@@ -0,0 +1,211 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"time"
+)
+
+const (
+    StatusPending = "pending"
+    StatusSent    = "sent"
+    StatusFailed  = "failed"
+)
+
+// Notification is an email to render and queue.
+type Notification struct {
+    To       string
+    Template string
+    Locale   string
+    Data     interface{}
+    DedupKey string // Optional; a second notification with the same key is dropped
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so a notification can be
+// queued in the same transaction as the change it reports.
+type Execer interface {
+    ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue renders a notification and stores it for the worker to send.
+// Rendering happens now, so template errors surface to the caller.
+func Enqueue(ctx context.Context, db Execer, n Notification) error {
+    if _, err := mail.ParseAddress(n.To); err != nil {
+        return fmt.Errorf("invalid recipient %q: %w", n.To, err)
+    }
+
+    rendered, err := Render(n.Template, n.Locale, n.Data)
+    if err != nil {
+        return err
+    }
+
+    var dedupKey interface{}
+    if n.DedupKey != "" {
+        dedupKey = n.DedupKey
+    }
+
+    _, err = db.ExecContext(ctx, `
+        INSERT INTO notifications (recipient, template, locale, subject, text_body, html_body, dedup_key)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        ON CONFLICT (dedup_key) DO NOTHING`,
+        n.To, n.Template, rendered.Locale, rendered.Subject, rendered.Text, rendered.HTML, dedupKey,
+    )
+    return err
+}
+
+type WorkerConfig struct {
+    PollInterval time.Duration
+    BatchSize    int
+    Timeout      time.Duration // Per message
+    MaxAttempts  int           // After this many failures a message is marked failed
+    BaseBackoff  time.Duration // Doubled on every failed attempt
+    MaxBackoff   time.Duration
+}
+
+var DefaultWorkerConfig = WorkerConfig{
+    PollInterval: 2 * time.Second,
+    BatchSize:    20,
+    Timeout:      30 * time.Second,
+    MaxAttempts:  8,
+    BaseBackoff:  time.Minute,
+    MaxBackoff:   2 * time.Hour,
+}
+
+// Worker sends queued notifications through the default Mailer. Several
+// server instances can run one each: messages are leased with SKIP LOCKED.
+type Worker struct {
+    db     *sql.DB
+    config WorkerConfig
+}
+
+func NewWorker(db *sql.DB, config WorkerConfig) *Worker {
+    return &Worker{db: db, config: config}
+}
+
+// Start runs the send loop in a goroutine until ctx is cancelled.
+func (w *Worker) Start(ctx context.Context) {
+    go func() {
+        ticker := time.NewTicker(w.config.PollInterval)
+        defer ticker.Stop()
+
+        for {
+            for {
+                n, err := w.sendBatch(ctx)
+                if err != nil {
+                    log.Printf("Notification send error: %v", err)
+                    break
+                }
+                if n < w.config.BatchSize {
+                    break
+                }
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+}
+
+type queuedMessage struct {
+    id       int64
+    attempts int
+    message  Message
+}
+
+// sendBatch leases due messages by pushing their next attempt past the
+// send timeout, then sends them without holding row locks.
+func (w *Worker) sendBatch(ctx context.Context) (int, error) {
+    lease := 2 * w.config.Timeout * time.Duration(w.config.BatchSize)
+    rows, err := w.db.QueryContext(ctx, `
+        UPDATE notifications
+        SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+        WHERE id IN (
+            SELECT id FROM notifications
+            WHERE status = $3 AND next_attempt_at <= NOW()
+            ORDER BY id
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING id, attempts, recipient, subject, text_body, html_body`,
+        w.config.BatchSize, lease.Milliseconds(), StatusPending,
+    )
+    if err != nil {
+        return 0, err
+    }
+
+    var batch []queuedMessage
+    for rows.Next() {
+        var q queuedMessage
+        if err := rows.Scan(&q.id, &q.attempts, &q.message.To, &q.message.Subject, &q.message.Text, &q.message.HTML); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        batch = append(batch, q)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    from := currentConfig().From
+    mailer := Default()
+    for _, q := range batch {
+        q.message.ID = fmt.Sprintf("notification-%d", q.id)
+        q.message.From = from
+
+        sendCtx, cancel := context.WithTimeout(ctx, w.config.Timeout)
+        sendErr := mailer.Send(sendCtx, q.message)
+        cancel()
+
+        if sendErr != nil {
+            if err := w.markFailed(ctx, q, sendErr); err != nil {
+                return 0, err
+            }
+            continue
+        }
+
+        _, err := w.db.ExecContext(ctx,
+            "UPDATE notifications SET status = $1, attempts = attempts + 1, last_error = '', sent_at = NOW() WHERE id = $2",
+            StatusSent, q.id,
+        )
+        if err != nil {
+            return 0, err
+        }
+    }
+
+    return len(batch), nil
+}
+
+func (w *Worker) markFailed(ctx context.Context, q queuedMessage, cause error) error {
+    attempts := q.attempts + 1
+    status := StatusPending
+    if attempts >= w.config.MaxAttempts {
+        status = StatusFailed
+        log.Printf("Notification %d to %s failed %d times, giving up: %v", q.id, q.message.To, attempts, cause)
+    }
+
+    _, err := w.db.ExecContext(ctx, `
+        UPDATE notifications
+        SET status = $1, attempts = $2, last_error = $3, next_attempt_at = NOW() + $4 * INTERVAL '1 millisecond'
+        WHERE id = $5`,
+        status, attempts, cause.Error(), w.backoff(attempts).Milliseconds(), q.id,
+    )
+    return err
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+    delay := w.config.BaseBackoff
+    for i := 1; i < attempts && delay < w.config.MaxBackoff; i++ {
+        delay *= 2
+    }
+    if delay > w.config.MaxBackoff {
+        delay = w.config.MaxBackoff
+    }
+    return delay
+}
@@ -0,0 +1,324 @@
+package notifications
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"server/money"
+)
+
+// Template names
+const (
+    OrderConfirmation = "order_confirmation"
+    ShippingUpdate    = "shipping_update"
+    PasswordReset     = "password_reset"
+    CartReminder      = "cart_reminder"
+)
+
+const DefaultLocale = "en"
+
+var ErrTemplateNotFound = errors.New("email template not found")
+
+// OrderConfirmationData is the data for OrderConfirmation.
+type OrderConfirmationData struct {
+    CustomerName string
+    OrderID      int
+    Items        []OrderLine
+    Subtotal     money.Money
+    Discount     money.Money
+    Shipping     money.Money
+    Tax          money.Money
+    Total        money.Money
+    OrderURL     string
+}
+
+type OrderLine struct {
+    Name     string
+    Size     string
+    Color    string
+    Quantity int
+    Total    money.Money
+}
+
+// ShippingUpdateData is the data for ShippingUpdate. Status is "shipped"
+// or "delivered".
+type ShippingUpdateData struct {
+    CustomerName   string
+    OrderID        int
+    Status         string
+    Carrier        string
+    TrackingNumber string
+    OrderURL       string
+}
+
+// PasswordResetData is the data for PasswordReset.
+type PasswordResetData struct {
+    CustomerName     string
+    ResetURL         string
+    ExpiresInMinutes int
+}
+
+// CartReminderData is the data for CartReminder. Reminder counts from 1.
+type CartReminderData struct {
+    CustomerName   string
+    Items          []CartReminderLine
+    Reminder       int
+    RestoreURL     string
+    UnsubscribeURL string
+}
+
+type CartReminderLine struct {
+    Name     string
+    Size     string
+    Color    string
+    Quantity int
+}
+
+// samples feed the staff preview endpoint.
+var samples = map[string]func() interface{}{
+    OrderConfirmation: func() interface{} {
+        return OrderConfirmationData{
+            CustomerName: "Alex Doe",
+            OrderID:      1042,
+            Items: []OrderLine{
+                {Name: "Classic Tee", Size: "M", Color: "Black", Quantity: 2, Total: money.New(3998, "USD")},
+                {Name: "Canvas Sneakers", Size: "42", Color: "White", Quantity: 1, Total: money.New(6500, "USD")},
+            },
+            Subtotal: money.New(10498, "USD"),
+            Discount: money.New(1000, "USD"),
+            Shipping: money.New(599, "USD"),
+            Tax:      money.New(808, "USD"),
+            Total:    money.New(10905, "USD"),
+            OrderURL: URL("/orders/1042"),
+        }
+    },
+    ShippingUpdate: func() interface{} {
+        return ShippingUpdateData{
+            CustomerName:   "Alex Doe",
+            OrderID:        1042,
+            Status:         "shipped",
+            Carrier:        "UPS",
+            TrackingNumber: "1Z999AA10123456784",
+            OrderURL:       URL("/orders/1042"),
+        }
+    },
+    PasswordReset: func() interface{} {
+        return PasswordResetData{
+            CustomerName:     "Alex Doe",
+            ResetURL:         URL("/reset-password?token=sample"),
+            ExpiresInMinutes: 60,
+        }
+    },
+    CartReminder: func() interface{} {
+        return CartReminderData{
+            CustomerName: "Alex Doe",
+            Items: []CartReminderLine{
+                {Name: "Classic Tee", Size: "M", Color: "Black", Quantity: 2},
+                {Name: "Canvas Sneakers", Size: "42", Color: "White", Quantity: 1},
+            },
+            Reminder:       1,
+            RestoreURL:     URL("/cart/restore?token=sample"),
+            UnsubscribeURL: URL("/cart/unsubscribe?token=sample"),
+        }
+    },
+}
+
+//go:embed templates
+var templateFiles embed.FS
+
+type emailTemplate struct {
+    text *texttemplate.Template // Defines "subject" and "text"
+    html *htmltemplate.Template // Optional; executes "layout"
+}
+
+// Loaded once at startup; a malformed embedded template is a build error
+var templates, locales = mustLoadTemplates()
+
+func mustLoadTemplates() (map[string]*emailTemplate, []string) {
+    funcs := map[string]interface{}{
+        "year": func() int { return time.Now().Year() },
+    }
+
+    layout, err := fs.ReadFile(templateFiles, "templates/layout.html")
+    if err != nil {
+        panic(err)
+    }
+
+    loaded := make(map[string]*emailTemplate)
+    var found []string
+    dirs, err := fs.ReadDir(templateFiles, "templates")
+    if err != nil {
+        panic(err)
+    }
+    for _, dir := range dirs {
+        if !dir.IsDir() {
+            continue
+        }
+        locale := dir.Name()
+        found = append(found, locale)
+
+        for name := range samples {
+            base := path.Join("templates", locale, name)
+            textSource, err := fs.ReadFile(templateFiles, base+".txt")
+            if err != nil {
+                continue // Falls back to the default locale
+            }
+
+            t := &emailTemplate{
+                text: texttemplate.Must(texttemplate.New(name).Funcs(funcs).Parse(string(textSource))),
+            }
+            if htmlSource, err := fs.ReadFile(templateFiles, base+".html"); err == nil {
+                h := htmltemplate.Must(htmltemplate.New("layout").Funcs(funcs).Parse(string(layout)))
+                t.html = htmltemplate.Must(h.Parse(string(htmlSource)))
+            }
+            loaded[locale+"/"+name] = t
+        }
+    }
+
+    for name := range samples {
+        if loaded[DefaultLocale+"/"+name] == nil {
+            panic(fmt.Sprintf("email template %s has no %s version", name, DefaultLocale))
+        }
+    }
+
+    sort.Strings(found)
+    return loaded, found
+}
+
+// Rendered is an email's content before addressing.
+type Rendered struct {
+    Locale  string `json:"locale"` // The locale actually used
+    Subject string `json:"subject"`
+    Text    string `json:"text"`
+    HTML    string `json:"html,omitempty"`
+}
+
+// Render executes a template in the closest available locale: an exact
+// match, then the base language ("pt-BR" uses "pt"), then DefaultLocale.
+func Render(name, locale string, data interface{}) (*Rendered, error) {
+    t, used := lookupTemplate(name, locale)
+    if t == nil {
+        return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+    }
+
+    var subject, text bytes.Buffer
+    if err := t.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+        return nil, err
+    }
+    if err := t.text.ExecuteTemplate(&text, "text", data); err != nil {
+        return nil, err
+    }
+
+    rendered := &Rendered{
+        Locale:  used,
+        Subject: strings.Join(strings.Fields(subject.String()), " "),
+        Text:    strings.TrimSpace(text.String()) + "\n",
+    }
+    if t.html != nil {
+        var html bytes.Buffer
+        if err := t.html.ExecuteTemplate(&html, "layout", data); err != nil {
+            return nil, err
+        }
+        rendered.HTML = html.String()
+    }
+    return rendered, nil
+}
+
+// Preview renders a template with built-in sample data.
+func Preview(name, locale string) (*Rendered, error) {
+    sample, ok := samples[name]
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+    }
+    return Render(name, locale, sample())
+}
+
+func lookupTemplate(name, locale string) (*emailTemplate, string) {
+    locale = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+    candidates := []string{locale}
+    if base, _, ok := strings.Cut(locale, "-"); ok {
+        candidates = append(candidates, base)
+    }
+    candidates = append(candidates, DefaultLocale)
+
+    for _, candidate := range candidates {
+        if t := templates[candidate+"/"+name]; t != nil {
+            return t, candidate
+        }
+    }
+    return nil, ""
+}
+
+// TemplateInfo describes a template for the staff preview listing.
+type TemplateInfo struct {
+    Name    string   `json:"name"`
+    Locales []string `json:"locales"`
+}
+
+func ListTemplates() []TemplateInfo {
+    names := make([]string, 0, len(samples))
+    for name := range samples {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    infos := make([]TemplateInfo, 0, len(names))
+    for _, name := range names {
+        info := TemplateInfo{Name: name, Locales: []string{}}
+        for _, locale := range locales {
+            if templates[locale+"/"+name] != nil {
+                info.Locales = append(info.Locales, locale)
+            }
+        }
+        infos = append(infos, info)
+    }
+    return infos
+}
+
+// MatchLocale picks the best supported locale for an Accept-Language
+// header, falling back to DefaultLocale.
+func MatchLocale(acceptLanguage string) string {
+    type tag struct {
+        name string
+        q    float64
+    }
+    var tags []tag
+    for _, part := range strings.Split(acceptLanguage, ",") {
+        name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+        name = strings.ToLower(strings.TrimSpace(name))
+        if name == "" || name == "*" {
+            continue
+        }
+        q := 1.0
+        if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+                q = parsed
+            }
+        }
+        tags = append(tags, tag{name, q})
+    }
+    sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+    for _, t := range tags {
+        if t.q <= 0 {
+            continue
+        }
+        base, _, _ := strings.Cut(t.name, "-")
+        for _, locale := range locales {
+            if locale == t.name || locale == base {
+                return locale
+            }
+        }
+    }
+    return DefaultLocale
+}
@@ -0,0 +1,277 @@
+// Package promotions evaluates coupon codes against a cart and records
+// redemptions. Rule evaluation is pure; persistence lives in store.go.
+package promotions
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"server/money"
+)
+
+const (
+    TypePercentage   = "percentage"
+    TypeFixedAmount  = "fixed_amount"
+    TypeFreeShipping = "free_shipping"
+    TypeBuyXGetY     = "buy_x_get_y"
+)
+
+var (
+    ErrCouponNotFound      = errors.New("coupon not found")
+    ErrCouponInactive      = errors.New("coupon is not active")
+    ErrCouponExpired       = errors.New("coupon has expired")
+    ErrUsageLimitReached   = errors.New("coupon usage limit reached")
+    ErrPerUserLimitReached = errors.New("coupon already used the maximum number of times")
+    ErrMinSubtotalNotMet   = errors.New("cart subtotal is below the coupon minimum")
+    ErrFirstOrderOnly      = errors.New("coupon is only valid on a first order")
+    ErrLoginRequired       = errors.New("coupon requires a signed-in user")
+    ErrNotApplicable       = errors.New("coupon does not apply to any items in the cart")
+)
+
+// IsValidationError reports whether err means the coupon cannot be used
+// on this cart, as opposed to an infrastructure failure.
+func IsValidationError(err error) bool {
+    for _, target := range []error{
+        ErrCouponNotFound, ErrCouponInactive, ErrCouponExpired, ErrUsageLimitReached,
+        ErrPerUserLimitReached, ErrMinSubtotalNotMet, ErrFirstOrderOnly, ErrLoginRequired, ErrNotApplicable,
+    } {
+        if errors.Is(err, target) {
+            return true
+        }
+    }
+    return false
+}
+
+type Promotion struct {
+    ID          int     `json:"id"`
+    Code        string  `json:"code"`
+    Description string  `json:"description"`
+    Type        string  `json:"type"`
+    Value       float64     `json:"value,omitempty"` // Percent for percentage and buy_x_get_y
+    Amount      money.Money `json:"amount"`          // Discount for fixed_amount
+    BuyQuantity int         `json:"buy_quantity,omitempty"`
+    GetQuantity int         `json:"get_quantity,omitempty"`
+
+    // Conditions. Amounts are converted to the cart's currency when evaluated.
+    Categories     []string    `json:"categories,omitempty"`
+    MinSubtotal    money.Money `json:"min_subtotal"`
+    FirstOrderOnly bool        `json:"first_order_only"`
+    PerUserLimit   int         `json:"per_user_limit"` // 0 means unlimited
+    UsageLimit     int         `json:"usage_limit"`    // 0 means unlimited
+
+    RedemptionCount int        `json:"redemption_count"`
+    StartsAt        *time.Time `json:"starts_at,omitempty"`
+    EndsAt          *time.Time `json:"ends_at,omitempty"`
+    IsActive        bool       `json:"is_active"`
+    CreatedAt       time.Time  `json:"created_at"`
+}
+
+// Line is the view of a cart line that rules are evaluated against.
+type Line struct {
+    ProductID int
+    Category  string
+    UnitPrice money.Money
+    Quantity  int
+}
+
+func (l Line) Total() money.Money {
+    return l.UnitPrice.Mul(l.Quantity)
+}
+
+type Cart struct {
+    UserID   int // 0 for anonymous carts
+    Currency string
+    Lines    []Line
+    Subtotal money.Money
+}
+
+// Usage is the per-user history needed to check user-scoped conditions.
+type Usage struct {
+    UserRedemptions int
+    PriorOrders     int
+}
+
+type Discount struct {
+    PromotionID   int           `json:"-"`
+    Code          string        `json:"code"`
+    Description   string        `json:"description"`
+    Amount        money.Money   `json:"amount"`
+    FreeShipping  bool          `json:"free_shipping"`
+    LineDiscounts []money.Money `json:"-"` // Aligned with Cart.Lines
+}
+
+// Validate checks the promotion's own state: active flag, schedule and
+// the global usage limit.
+func (p *Promotion) Validate(now time.Time) error {
+    if !p.IsActive {
+        return ErrCouponInactive
+    }
+    if p.StartsAt != nil && now.Before(*p.StartsAt) {
+        return ErrCouponInactive
+    }
+    if p.EndsAt != nil && now.After(*p.EndsAt) {
+        return ErrCouponExpired
+    }
+    if p.UsageLimit > 0 && p.RedemptionCount >= p.UsageLimit {
+        return ErrUsageLimitReached
+    }
+    return nil
+}
+
+// RequiresUser reports whether the promotion has conditions that can only
+// be checked for a signed-in user.
+func (p *Promotion) RequiresUser() bool {
+    return p.FirstOrderOnly || p.PerUserLimit > 0
+}
+
+// Evaluate applies the promotion's conditions and rule to the cart and
+// returns the resulting discount, allocated per line.
+func (p *Promotion) Evaluate(cart Cart, usage Usage) (*Discount, error) {
+    if p.RequiresUser() && cart.UserID == 0 {
+        return nil, ErrLoginRequired
+    }
+    if p.FirstOrderOnly && usage.PriorOrders > 0 {
+        return nil, ErrFirstOrderOnly
+    }
+    if p.PerUserLimit > 0 && usage.UserRedemptions >= p.PerUserLimit {
+        return nil, ErrPerUserLimitReached
+    }
+    if p.MinSubtotal.Amount > 0 {
+        minSubtotal, err := money.Convert(p.MinSubtotal, cart.Currency)
+        if err != nil {
+            return nil, err
+        }
+        if cart.Subtotal.Cmp(minSubtotal) < 0 {
+            return nil, ErrMinSubtotalNotMet
+        }
+    }
+
+    eligible := p.eligibleLines(cart.Lines)
+    if len(eligible) == 0 {
+        return nil, ErrNotApplicable
+    }
+
+    discount := &Discount{
+        PromotionID:   p.ID,
+        Code:          p.Code,
+        Description:   p.Description,
+        Amount:        money.Zero(cart.Currency),
+        LineDiscounts: make([]money.Money, len(cart.Lines)),
+    }
+    for i := range discount.LineDiscounts {
+        discount.LineDiscounts[i] = money.Zero(cart.Currency)
+    }
+
+    switch p.Type {
+    case TypePercentage:
+        for _, i := range eligible {
+            discount.LineDiscounts[i] = cart.Lines[i].Total().Percent(p.Value)
+        }
+    case TypeFixedAmount:
+        amount, err := money.Convert(p.Amount, cart.Currency)
+        if err != nil {
+            return nil, err
+        }
+        allocateFixed(discount.LineDiscounts, cart.Lines, eligible, amount)
+    case TypeFreeShipping:
+        discount.FreeShipping = true
+    case TypeBuyXGetY:
+        if err := p.applyBuyXGetY(discount.LineDiscounts, cart.Lines, eligible); err != nil {
+            return nil, err
+        }
+    default:
+        return nil, ErrNotApplicable
+    }
+
+    for _, amount := range discount.LineDiscounts {
+        discount.Amount = discount.Amount.Add(amount)
+    }
+
+    if discount.Amount.IsZero() && !discount.FreeShipping {
+        return nil, ErrNotApplicable
+    }
+
+    return discount, nil
+}
+
+func (p *Promotion) eligibleLines(lines []Line) []int {
+    var eligible []int
+    for i, line := range lines {
+        if len(p.Categories) == 0 || containsFold(p.Categories, line.Category) {
+            eligible = append(eligible, i)
+        }
+    }
+    return eligible
+}
+
+// allocateFixed spreads a fixed amount across the eligible lines in
+// proportion to their totals without losing or inventing minor units.
+func allocateFixed(out []money.Money, lines []Line, eligible []int, amount money.Money) {
+    weights := make([]int64, len(eligible))
+    var eligibleTotal int64
+    for n, i := range eligible {
+        weights[n] = lines[i].Total().Amount
+        eligibleTotal += weights[n]
+    }
+    if eligibleTotal == 0 {
+        return
+    }
+
+    amount = amount.Min(money.New(eligibleTotal, amount.Currency))
+    for n, share := range amount.Allocate(weights) {
+        out[eligible[n]] = share
+    }
+}
+
+// applyBuyXGetY discounts the cheapest GetQuantity units out of every
+// BuyQuantity+GetQuantity eligible units by Value percent.
+func (p *Promotion) applyBuyXGetY(out []money.Money, lines []Line, eligible []int) error {
+    groupSize := p.BuyQuantity + p.GetQuantity
+    if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+        return ErrNotApplicable
+    }
+
+    type unit struct {
+        line  int
+        price money.Money
+    }
+    var units []unit
+    for _, i := range eligible {
+        for q := 0; q < lines[i].Quantity; q++ {
+            units = append(units, unit{line: i, price: lines[i].UnitPrice})
+        }
+    }
+
+    free := (len(units) / groupSize) * p.GetQuantity
+    if free == 0 {
+        return ErrNotApplicable
+    }
+
+    sort.SliceStable(units, func(a, b int) bool {
+        return units[a].price.Amount < units[b].price.Amount
+    })
+
+    percent := p.Value
+    if percent <= 0 || percent > 100 {
+        percent = 100
+    }
+    for _, u := range units[:free] {
+        out[u.line] = out[u.line].Add(u.price.Percent(percent))
+    }
+    return nil
+}
+
+func NormalizeCode(code string) string {
+    return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func containsFold(values []string, target string) bool {
+    for _, v := range values {
+        if strings.EqualFold(v, target) {
+            return true
+        }
+    }
+    return false
+}
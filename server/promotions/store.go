@@ -0,0 +1,189 @@
+package promotions
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"server/config"
+
+	"github.com/lib/pq"
+)
+
+var ErrCodeExists = errors.New("coupon code already exists")
+
+const promotionColumns = `id, code, description, type, value, amount_minor, currency, buy_quantity, get_quantity,
+    categories, min_subtotal, first_order_only, per_user_limit, usage_limit,
+    redemption_count, starts_at, ends_at, is_active, created_at`
+
+func scanPromotion(row interface{ Scan(...interface{}) error }) (*Promotion, error) {
+    var p Promotion
+    var startsAt, endsAt sql.NullTime
+    var currency string
+
+    err := row.Scan(&p.ID, &p.Code, &p.Description, &p.Type, &p.Value, &p.Amount.Amount, &currency, &p.BuyQuantity, &p.GetQuantity,
+        pq.Array(&p.Categories), &p.MinSubtotal.Amount, &p.FirstOrderOnly, &p.PerUserLimit, &p.UsageLimit,
+        &p.RedemptionCount, &startsAt, &endsAt, &p.IsActive, &p.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    p.Amount.Currency, p.MinSubtotal.Currency = currency, currency
+    if startsAt.Valid {
+        p.StartsAt = &startsAt.Time
+    }
+    if endsAt.Valid {
+        p.EndsAt = &endsAt.Time
+    }
+    return &p, nil
+}
+
+func GetByCode(code string) (*Promotion, error) {
+    p, err := scanPromotion(config.DB.QueryRow(
+        "SELECT "+promotionColumns+" FROM promotions WHERE code = $1",
+        NormalizeCode(code),
+    ))
+    if err == sql.ErrNoRows {
+        return nil, ErrCouponNotFound
+    }
+    return p, err
+}
+
+func List() ([]Promotion, error) {
+    rows, err := config.DB.Query("SELECT " + promotionColumns + " FROM promotions ORDER BY created_at DESC")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    promotions := []Promotion{}
+    for rows.Next() {
+        p, err := scanPromotion(rows)
+        if err != nil {
+            return nil, err
+        }
+        promotions = append(promotions, *p)
+    }
+    return promotions, rows.Err()
+}
+
+// Create stores a new promotion. Amount and MinSubtotal must already share
+// one currency, which becomes the promotion's currency.
+func Create(p *Promotion) (*Promotion, error) {
+    created, err := scanPromotion(config.DB.QueryRow(`
+        INSERT INTO promotions (code, description, type, value, amount_minor, currency, buy_quantity, get_quantity,
+            categories, min_subtotal, first_order_only, per_user_limit, usage_limit,
+            starts_at, ends_at, is_active)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+        RETURNING `+promotionColumns,
+        NormalizeCode(p.Code), p.Description, p.Type, p.Value, p.Amount.Amount, p.Amount.Currency, p.BuyQuantity, p.GetQuantity,
+        pq.Array(p.Categories), p.MinSubtotal.Amount, p.FirstOrderOnly, p.PerUserLimit, p.UsageLimit,
+        p.StartsAt, p.EndsAt, p.IsActive,
+    ))
+    if err != nil {
+        var pqErr *pq.Error
+        if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+            return nil, ErrCodeExists
+        }
+        return nil, err
+    }
+    return created, nil
+}
+
+// GetUsage loads the user-scoped history needed by Evaluate. Cancelled
+// orders do not count against first-order promotions.
+func GetUsage(q querier, promotionID, userID int) (Usage, error) {
+    var usage Usage
+    if userID == 0 {
+        return usage, nil
+    }
+
+    err := q.QueryRow(
+        "SELECT COUNT(*) FROM promotion_redemptions WHERE promotion_id = $1 AND user_id = $2",
+        promotionID, userID,
+    ).Scan(&usage.UserRedemptions)
+    if err != nil {
+        return usage, err
+    }
+
+    err = q.QueryRow(
+        "SELECT COUNT(*) FROM orders WHERE user_id = $1 AND status <> 'cancelled'",
+        userID,
+    ).Scan(&usage.PriorOrders)
+    return usage, err
+}
+
+type querier interface {
+    QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Apply looks up a coupon code and evaluates it against the cart. It is
+// used at cart time; checkout must additionally call Redeem.
+func Apply(code string, cart Cart) (*Discount, error) {
+    p, err := GetByCode(code)
+    if err != nil {
+        return nil, err
+    }
+    if err := p.Validate(time.Now()); err != nil {
+        return nil, err
+    }
+
+    usage, err := GetUsage(config.DB, p.ID, cart.UserID)
+    if err != nil {
+        return nil, err
+    }
+
+    return p.Evaluate(cart, usage)
+}
+
+// Redeem re-validates the coupon inside the checkout transaction and
+// counts the redemption. The promotion row is locked with FOR UPDATE until
+// the transaction ends, so concurrent checkouts using the same code are
+// serialized and neither the global nor the per-user limit can be
+// exceeded. Call it before the order row is written so the first-order
+// check does not see the new order, then call RecordRedemption.
+func Redeem(tx *sql.Tx, code string, cart Cart) (*Discount, error) {
+    p, err := scanPromotion(tx.QueryRow(
+        "SELECT "+promotionColumns+" FROM promotions WHERE code = $1 FOR UPDATE",
+        NormalizeCode(code),
+    ))
+    if err == sql.ErrNoRows {
+        return nil, ErrCouponNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := p.Validate(time.Now()); err != nil {
+        return nil, err
+    }
+
+    usage, err := GetUsage(tx, p.ID, cart.UserID)
+    if err != nil {
+        return nil, err
+    }
+
+    discount, err := p.Evaluate(cart, usage)
+    if err != nil {
+        return nil, err
+    }
+
+    _, err = tx.Exec(
+        "UPDATE promotions SET redemption_count = redemption_count + 1 WHERE id = $1",
+        p.ID,
+    )
+    if err != nil {
+        return nil, err
+    }
+
+    return discount, nil
+}
+
+// RecordRedemption links a redeemed discount to the order it was used on.
+func RecordRedemption(tx *sql.Tx, discount *Discount, userID, orderID int) error {
+    _, err := tx.Exec(
+        "INSERT INTO promotion_redemptions (promotion_id, user_id, order_id, amount, currency) VALUES ($1, $2, $3, $4, $5)",
+        discount.PromotionID, userID, orderID, discount.Amount.Amount, discount.Amount.Currency,
+    )
+    return err
+}
+
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupCacheRoutes(mux *http.ServeMux) {
+    // Cache stats and flushing, admin only
+    mux.HandleFunc("/admin/cache/stats", methodGuard("GET",
+        applyMiddleware(handlers.GetCacheStats,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/cache/flush", methodGuard("POST",
+        applyMiddleware(handlers.FlushCache,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
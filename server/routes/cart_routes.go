@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupCartRoutes(mux *http.ServeMux) {
+    mux.HandleFunc("/me/cart", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.GetMyCart,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "PUT": applyMiddleware(handlers.SaveMyCart,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "DELETE": applyMiddleware(handlers.DeleteMyCart,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    }))
+
+    // Signed links from abandoned cart emails - no authentication
+    mux.HandleFunc("/cart/restore", methodGuard("POST",
+        applyMiddleware(handlers.RestoreCart,
+            middleware.AuthRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/cart/unsubscribe", methodGuard("POST",
+        applyMiddleware(handlers.UnsubscribeCartReminders,
+            middleware.AuthRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/carts/recovery-stats", methodGuard("GET",
+        applyMiddleware(handlers.GetCartRecoveryStats,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
@@ -0,0 +1,45 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupCheckoutRoutes(mux *http.ServeMux) {
+    // Cart pricing works for guests; signed-in users get user-scoped coupon checks
+    mux.HandleFunc("/cart/quote", methodGuard("POST",
+        applyMiddleware(handlers.QuoteCart,
+            middleware.OptionalAuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/shipping/rates", methodGuard("POST",
+        applyMiddleware(handlers.GetShippingRates,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/checkout", methodGuard("POST",
+        applyMiddleware(handlers.Checkout,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+            middleware.IdempotencyMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/promotions", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.ListPromotions,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "POST": applyMiddleware(handlers.CreatePromotion,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    }))
+}
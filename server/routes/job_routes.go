@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupJobRoutes(mux *http.ServeMux) {
+    // Scheduled maintenance jobs, admin only
+    mux.HandleFunc("/admin/jobs", methodGuard("GET",
+        applyMiddleware(handlers.GetJobs,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/jobs/{name}/run", methodGuard("POST",
+        applyMiddleware(handlers.RunJob,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupNotificationRoutes(mux *http.ServeMux) {
+    // Password reset by email - no authentication, auth rate limits
+    mux.HandleFunc("/password/forgot", methodGuard("POST",
+        applyMiddleware(handlers.ForgotPassword,
+            middleware.AuthRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/password/reset", methodGuard("POST",
+        applyMiddleware(handlers.ResetPassword,
+            middleware.AuthRateLimitMiddleware(),
+        ),
+    ))
+
+    // Email template previews for staff
+    mux.HandleFunc("/admin/email-templates", methodGuard("GET",
+        applyMiddleware(handlers.GetEmailTemplates,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/email-templates/{name}/preview", methodGuard("GET",
+        applyMiddleware(handlers.PreviewEmailTemplate,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupOrderRoutes(mux *http.ServeMux) {
+    // Customer order history; handlers only ever return the caller's orders
+    mux.HandleFunc("/me/orders", methodGuard("GET",
+        applyMiddleware(handlers.GetMyOrders,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/me/orders/{id}", methodGuard("GET",
+        applyMiddleware(handlers.GetMyOrder,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/me/orders/{id}/reorder", methodGuard("POST",
+        applyMiddleware(handlers.Reorder,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
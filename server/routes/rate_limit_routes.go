@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupRateLimitRoutes(mux *http.ServeMux) {
+    // CIDR allow and deny lists, admin only
+    mux.HandleFunc("/admin/rate-limits/access", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.GetRateLimitAccessLists,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "PUT": applyMiddleware(handlers.SetRateLimitAccessLists,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    }))
+}
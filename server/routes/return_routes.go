@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupReturnRoutes(mux *http.ServeMux) {
+    // Customer payments and return requests
+    mux.HandleFunc("/me/orders/{id}/payments", methodGuard("POST",
+        applyMiddleware(handlers.PayOrder,
+            middleware.AuthMiddleware,
+            middleware.AuthRateLimitMiddleware(),
+            middleware.IdempotencyMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/me/orders/{id}/returns", methodGuard("POST",
+        applyMiddleware(handlers.CreateReturn,
+            middleware.AuthMiddleware,
+            middleware.AuthRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/me/returns", methodGuard("GET",
+        applyMiddleware(handlers.GetMyReturns,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    // Staff RMA workflow
+    mux.HandleFunc("/admin/returns", methodGuard("GET",
+        applyMiddleware(handlers.GetReturnQueue,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/returns/{id}", methodGuard("GET",
+        applyMiddleware(handlers.GetReturn,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/returns/{id}/approve", methodGuard("POST",
+        applyMiddleware(handlers.ApproveReturn,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/returns/{id}/reject", methodGuard("POST",
+        applyMiddleware(handlers.RejectReturn,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/returns/{id}/receive", methodGuard("POST",
+        applyMiddleware(handlers.ReceiveReturn,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/returns/{id}/refund", methodGuard("POST",
+        applyMiddleware(handlers.RefundReturn,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+            middleware.IdempotencyMiddleware(),
+        ),
+    ))
+}
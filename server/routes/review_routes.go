@@ -0,0 +1,46 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupReviewRoutes(mux *http.ServeMux) {
+    // Public listing, authenticated submission
+    mux.HandleFunc("/products/{id}/reviews", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.GetProductReviews,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "POST": applyMiddleware(handlers.CreateReview,
+            middleware.AuthMiddleware,
+            middleware.AuthRateLimitMiddleware(),
+        ),
+    }))
+
+    // Staff moderation queue
+    mux.HandleFunc("/admin/reviews", methodGuard("GET",
+        applyMiddleware(handlers.GetReviewQueue,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/reviews/{id}/approve", methodGuard("POST",
+        applyMiddleware(handlers.ApproveReview,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/reviews/{id}/reject", methodGuard("POST",
+        applyMiddleware(handlers.RejectReview,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
@@ -0,0 +1,48 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupShipmentRoutes(mux *http.ServeMux) {
+    // Staff fulfillment
+    mux.HandleFunc("/admin/orders/{id}/shipments", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.GetOrderShipments,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "POST": applyMiddleware(handlers.CreateShipment,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    }))
+
+    mux.HandleFunc("/admin/shipments/{id}", methodGuard("PUT",
+        applyMiddleware(handlers.UpdateShipment,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/shipments/{id}/events", methodGuard("POST",
+        applyMiddleware(handlers.AddShipmentEvent,
+            middleware.AuthMiddleware,
+            middleware.StaffMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    // Customer tracking history
+    mux.HandleFunc("/me/orders/{id}/shipments", methodGuard("GET",
+        applyMiddleware(handlers.GetMyOrderShipments,
+            middleware.AuthMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
@@ -15,6 +15,7 @@ func SetupRoutes() http.Handler {
     mux.HandleFunc("/register", methodGuard("POST", 
         applyMiddleware(handlers.RegisterUser, 
             middleware.AuthRateLimitMiddleware(),
+            middleware.IdempotencyMiddleware(),
         ),
     ))
     
@@ -47,6 +48,18 @@ func SetupRoutes() http.Handler {
         ),
     ))
 
+    setupReviewRoutes(mux)
+    setupCheckoutRoutes(mux)
+    setupOrderRoutes(mux)
+    setupShipmentRoutes(mux)
+    setupReturnRoutes(mux)
+    setupWebhookRoutes(mux)
+    setupJobRoutes(mux)
+    setupNotificationRoutes(mux)
+    setupCartRoutes(mux)
+    setupCacheRoutes(mux)
+    setupRateLimitRoutes(mux)
+
     // Apply CORS middleware and return the handler
     return middleware.EnableCORS(mux);
 }
@@ -62,6 +75,18 @@ func methodGuard(method string, handler http.HandlerFunc) http.HandlerFunc {
     }
 }
 
+// Helper function to serve several HTTP methods on the same path
+func methodRouter(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        handler, ok := handlers[r.Method]
+        if !ok {
+            http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+            return
+        }
+        handler.ServeHTTP(w, r)
+    }
+}
+
 // Apply middleware in reverse order so the first one wraps the innermost
 func applyMiddleware(handler http.HandlerFunc, middlewares ...func(http.HandlerFunc) http.HandlerFunc) http.HandlerFunc {
     for i := len(middlewares) - 1; i >= 0; i-- {
@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"net/http"
+
+	"server/handlers"
+	"server/middleware"
+)
+
+func setupWebhookRoutes(mux *http.ServeMux) {
+    // Merchant webhook endpoints, admin only
+    mux.HandleFunc("/admin/webhooks", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.GetWebhookEndpoints,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "POST": applyMiddleware(handlers.CreateWebhookEndpoint,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    }))
+
+    mux.HandleFunc("/admin/webhooks/{id}", methodRouter(map[string]http.HandlerFunc{
+        "GET": applyMiddleware(handlers.GetWebhookEndpoint,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "PUT": applyMiddleware(handlers.UpdateWebhookEndpoint,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+        "DELETE": applyMiddleware(handlers.DeleteWebhookEndpoint,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    }))
+
+    mux.HandleFunc("/admin/webhooks/{id}/rotate-secret", methodGuard("POST",
+        applyMiddleware(handlers.RotateWebhookSecret,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    // Delivery log and manual redelivery
+    mux.HandleFunc("/admin/webhooks/{id}/deliveries", methodGuard("GET",
+        applyMiddleware(handlers.GetWebhookDeliveries,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+
+    mux.HandleFunc("/admin/webhook-deliveries/{id}/redeliver", methodGuard("POST",
+        applyMiddleware(handlers.RedeliverWebhook,
+            middleware.AuthMiddleware,
+            middleware.AdminMiddleware,
+            middleware.APIRateLimitMiddleware(),
+        ),
+    ))
+}
@@ -0,0 +1,100 @@
+// Package shipping matches destinations to zones and prices the shipping
+// methods available there.
+package shipping
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"server/money"
+)
+
+const (
+    TypeFlat              = "flat"
+    TypeWeightBased       = "weight_based"
+    TypeFreeOverThreshold = "free_over_threshold"
+)
+
+var ErrMethodUnavailable = errors.New("shipping method is not available for this address")
+
+type Destination struct {
+    Country    string
+    Region     string
+    PostalCode string
+}
+
+func (d Destination) normalize() Destination {
+    return Destination{
+        Country:    strings.ToUpper(strings.TrimSpace(d.Country)),
+        Region:     strings.ToUpper(strings.TrimSpace(d.Region)),
+        PostalCode: strings.ToUpper(strings.ReplaceAll(d.PostalCode, " ", "")),
+    }
+}
+
+// Item is one cart line as far as shipping is concerned. Dimensions are in
+// millimetres and feed the volumetric weight.
+type Item struct {
+    WeightGrams int
+    LengthMM    int
+    WidthMM     int
+    HeightMM    int
+    Quantity    int
+}
+
+type Parcel struct {
+    Items []Item
+
+    // Merchandise value after discounts, used by free-over-threshold methods
+    // and to pick the quote currency
+    Subtotal money.Money
+}
+
+type Rate struct {
+    Method      string      `json:"method"`
+    Name        string      `json:"name"`
+    Amount      money.Money `json:"amount"`
+    MinDays     int         `json:"min_days,omitempty"`
+    MaxDays     int         `json:"max_days,omitempty"`
+    WeightGrams int         `json:"weight_grams"` // Chargeable weight the rate was based on
+}
+
+type Calculator interface {
+    // Rates returns every method available for the destination, cheapest first.
+    Rates(dest Destination, parcel Parcel) ([]Rate, error)
+}
+
+// Select returns the rate for the given method code, or the cheapest one
+// when code is empty.
+func Select(rates []Rate, code string) (*Rate, error) {
+    if len(rates) == 0 {
+        return nil, ErrMethodUnavailable
+    }
+    if code == "" {
+        return &rates[0], nil
+    }
+    for i := range rates {
+        if rates[i].Method == code {
+            return &rates[i], nil
+        }
+    }
+    return nil, ErrMethodUnavailable
+}
+
+var (
+    mu         sync.RWMutex
+    calculator Calculator = DefaultTable("USD")
+)
+
+func SetCalculator(c Calculator) {
+    mu.Lock()
+    defer mu.Unlock()
+    calculator = c
+}
+
+// Default returns the calculator configured at startup.
+func Default() Calculator {
+    mu.RLock()
+    defer mu.RUnlock()
+    return calculator
+}
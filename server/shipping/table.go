@@ -0,0 +1,263 @@
+package shipping
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"server/money"
+)
+
+// Zone groups destinations. A zone with no countries matches everywhere;
+// regions are written as "US-CA". A destination belongs to the first zone
+// that matches it.
+type Zone struct {
+    Code           string   `json:"code"`
+    Name           string   `json:"name"`
+    Countries      []string `json:"countries,omitempty"`
+    Regions        []string `json:"regions,omitempty"`
+    PostalPrefixes []string `json:"postal_prefixes,omitempty"`
+}
+
+func (z Zone) matches(dest Destination) bool {
+    if len(z.Countries) > 0 && !contains(z.Countries, dest.Country) {
+        return false
+    }
+    if len(z.Regions) > 0 && !contains(z.Regions, dest.Country+"-"+dest.Region) {
+        return false
+    }
+    if len(z.PostalPrefixes) > 0 {
+        for _, prefix := range z.PostalPrefixes {
+            if strings.HasPrefix(dest.PostalCode, prefix) {
+                return true
+            }
+        }
+        return false
+    }
+    return true
+}
+
+type WeightTier struct {
+    UpToGrams int   `json:"up_to_grams"`
+    Rate      int64 `json:"rate"`
+}
+
+// Method amounts are in the table currency's minor units.
+type Method struct {
+    Code    string   `json:"code"`
+    Name    string   `json:"name"`
+    Type    string   `json:"type"`
+    Zones   []string `json:"zones"`
+    MinDays int      `json:"min_days,omitempty"`
+    MaxDays int      `json:"max_days,omitempty"`
+
+    // Flat and free_over_threshold (below the threshold)
+    Rate int64 `json:"rate,omitempty"`
+
+    // weight_based, ordered by UpToGrams
+    WeightTiers []WeightTier `json:"weight_tiers,omitempty"`
+
+    // free_over_threshold
+    FreeOver int64 `json:"free_over,omitempty"`
+
+    // 0 means no limit
+    MaxWeightGrams int `json:"max_weight_grams,omitempty"`
+}
+
+// Table is a Calculator driven by a JSON file of zones and methods.
+type Table struct {
+    Currency string   `json:"currency"`
+    Zones    []Zone   `json:"zones"`
+    Methods  []Method `json:"methods"`
+
+    // Volumetric weight in grams is L*W*H in mm divided by this; 5000 is
+    // the common courier divisor
+    VolumetricDivisor int `json:"volumetric_divisor"`
+}
+
+// DefaultTable charges the storefront's historical flat fee of 10 units of
+// the given currency everywhere.
+func DefaultTable(currency string) *Table {
+    return &Table{
+        Currency:          currency,
+        VolumetricDivisor: 5000,
+        Zones:             []Zone{{Code: "world", Name: "Worldwide"}},
+        Methods: []Method{{
+            Code:    "standard",
+            Name:    "Standard shipping",
+            Type:    TypeFlat,
+            Zones:   []string{"world"},
+            Rate:    money.FromMajor(10, currency).Amount,
+            MinDays: 3,
+            MaxDays: 7,
+        }},
+    }
+}
+
+func LoadTable(path string) (*Table, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var table Table
+    if err := json.Unmarshal(data, &table); err != nil {
+        return nil, fmt.Errorf("failed to parse shipping table: %w", err)
+    }
+
+    currency, ok := money.NormalizeCurrency(table.Currency)
+    if !ok {
+        return nil, fmt.Errorf("invalid shipping table currency %q", table.Currency)
+    }
+    table.Currency = currency
+    if table.VolumetricDivisor <= 0 {
+        table.VolumetricDivisor = 5000
+    }
+
+    zones := make(map[string]bool)
+    for i := range table.Zones {
+        zone := &table.Zones[i]
+        zones[zone.Code] = true
+        upper(zone.Countries)
+        upper(zone.Regions)
+        for j, prefix := range zone.PostalPrefixes {
+            zone.PostalPrefixes[j] = strings.ToUpper(strings.ReplaceAll(prefix, " ", ""))
+        }
+    }
+
+    for _, method := range table.Methods {
+        for _, code := range method.Zones {
+            if !zones[code] {
+                return nil, fmt.Errorf("shipping method %s references unknown zone %s", method.Code, code)
+            }
+        }
+        switch method.Type {
+        case TypeFlat, TypeFreeOverThreshold:
+        case TypeWeightBased:
+            if len(method.WeightTiers) == 0 {
+                return nil, fmt.Errorf("weight-based method %s needs weight_tiers", method.Code)
+            }
+            sort.Slice(method.WeightTiers, func(a, b int) bool {
+                return method.WeightTiers[a].UpToGrams < method.WeightTiers[b].UpToGrams
+            })
+        default:
+            return nil, fmt.Errorf("shipping method %s has unknown type %q", method.Code, method.Type)
+        }
+    }
+
+    return &table, nil
+}
+
+// chargeableWeight sums max(actual, volumetric) weight over all units.
+func (t *Table) chargeableWeight(items []Item) int {
+    total := 0
+    for _, item := range items {
+        weight := item.WeightGrams
+        volumetric := item.LengthMM * item.WidthMM * item.HeightMM / t.VolumetricDivisor
+        if volumetric > weight {
+            weight = volumetric
+        }
+        total += weight * item.Quantity
+    }
+    return total
+}
+
+// zoneFor returns the first zone matching the destination. Zones are
+// checked in file order, so list specific zones before catch-alls.
+func (t *Table) zoneFor(dest Destination) (string, bool) {
+    for _, zone := range t.Zones {
+        if zone.matches(dest) {
+            return zone.Code, true
+        }
+    }
+    return "", false
+}
+
+// price returns the method's charge in table currency, or false when the
+// parcel cannot be shipped with it.
+func (t *Table) price(method Method, weight int, subtotal int64) (int64, bool) {
+    if method.MaxWeightGrams > 0 && weight > method.MaxWeightGrams {
+        return 0, false
+    }
+
+    switch method.Type {
+    case TypeFlat:
+        return method.Rate, true
+    case TypeFreeOverThreshold:
+        if subtotal >= method.FreeOver {
+            return 0, true
+        }
+        return method.Rate, true
+    case TypeWeightBased:
+        for _, tier := range method.WeightTiers {
+            if weight <= tier.UpToGrams {
+                return tier.Rate, true
+            }
+        }
+    }
+    return 0, false
+}
+
+func (t *Table) Rates(dest Destination, parcel Parcel) ([]Rate, error) {
+    dest = dest.normalize()
+    weight := t.chargeableWeight(parcel.Items)
+
+    // Thresholds are defined in the table currency
+    subtotal, err := money.Convert(parcel.Subtotal, t.Currency)
+    if err != nil {
+        return nil, err
+    }
+
+    rates := []Rate{}
+    zone, ok := t.zoneFor(dest)
+    if !ok {
+        return rates, nil
+    }
+
+    for _, method := range t.Methods {
+        if !contains(method.Zones, zone) {
+            continue
+        }
+
+        amount, ok := t.price(method, weight, subtotal.Amount)
+        if !ok {
+            continue
+        }
+
+        converted, err := money.Convert(money.New(amount, t.Currency), parcel.Subtotal.Currency)
+        if err != nil {
+            return nil, err
+        }
+
+        rates = append(rates, Rate{
+            Method:      method.Code,
+            Name:        method.Name,
+            Amount:      converted,
+            MinDays:     method.MinDays,
+            MaxDays:     method.MaxDays,
+            WeightGrams: weight,
+        })
+    }
+
+    sort.SliceStable(rates, func(a, b int) bool {
+        return rates[a].Amount.Amount < rates[b].Amount.Amount
+    })
+    return rates, nil
+}
+
+func contains(values []string, target string) bool {
+    for _, v := range values {
+        if v == target {
+            return true
+        }
+    }
+    return false
+}
+
+func upper(values []string) {
+    for i, v := range values {
+        values[i] = strings.ToUpper(strings.TrimSpace(v))
+    }
+}
@@ -0,0 +1,161 @@
+package tax
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"server/money"
+)
+
+// Rule is one row of the rate table. Region and PostalPrefix are optional;
+// when several rules match, the most specific one wins.
+type Rule struct {
+    Name         string  `json:"name"`
+    Country      string  `json:"country"`
+    Region       string  `json:"region,omitempty"`
+    PostalPrefix string  `json:"postal_prefix,omitempty"`
+    Class        string  `json:"class"`
+    Rate         float64 `json:"rate"` // Percent
+    Inclusive    *bool   `json:"inclusive,omitempty"`
+}
+
+// TableCalculator is a Calculator driven by a JSON rate table.
+type TableCalculator struct {
+    // PricesIncludeTax is the default for rules that do not set Inclusive
+    PricesIncludeTax bool              `json:"prices_include_tax"`
+    DefaultClass     string            `json:"default_class"`
+    ShippingClass    string            `json:"shipping_class"`
+    CategoryClasses  map[string]string `json:"category_classes"`
+    Rules            []Rule            `json:"rates"`
+}
+
+// LoadTable reads and validates a rate table file.
+func LoadTable(path string) (*TableCalculator, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+
+    var table TableCalculator
+    if err := json.Unmarshal(data, &table); err != nil {
+        return nil, fmt.Errorf("failed to parse tax table: %w", err)
+    }
+
+    if table.DefaultClass == "" {
+        table.DefaultClass = "standard"
+    }
+    if table.ShippingClass == "" {
+        table.ShippingClass = table.DefaultClass
+    }
+
+    classes := make(map[string]string, len(table.CategoryClasses))
+    for category, class := range table.CategoryClasses {
+        classes[strings.ToLower(category)] = class
+    }
+    table.CategoryClasses = classes
+
+    for i := range table.Rules {
+        rule := &table.Rules[i]
+        if rule.Country == "" || rule.Rate < 0 || rule.Rate > 100 {
+            return nil, fmt.Errorf("invalid tax rule %d: country is required and rate must be between 0 and 100", i)
+        }
+        rule.Country = strings.ToUpper(rule.Country)
+        rule.Region = strings.ToUpper(rule.Region)
+        rule.PostalPrefix = strings.ToUpper(strings.ReplaceAll(rule.PostalPrefix, " ", ""))
+        if rule.Class == "" {
+            rule.Class = table.DefaultClass
+        }
+    }
+
+    return &table, nil
+}
+
+func (t *TableCalculator) classFor(category string) string {
+    if class, ok := t.CategoryClasses[strings.ToLower(category)]; ok {
+        return class
+    }
+    return t.DefaultClass
+}
+
+// match returns the most specific rule for the location and class, or nil
+// when the location is not taxed for that class.
+func (t *TableCalculator) match(loc Location, class string) *Rule {
+    var best *Rule
+    bestScore := -1
+    for i := range t.Rules {
+        rule := &t.Rules[i]
+        if rule.Country != loc.Country || rule.Class != class {
+            continue
+        }
+        if rule.Region != "" && rule.Region != loc.Region {
+            continue
+        }
+        if rule.PostalPrefix != "" && !strings.HasPrefix(loc.PostalCode, rule.PostalPrefix) {
+            continue
+        }
+
+        // A region beats a country-wide rule; a longer postal prefix beats both
+        score := 0
+        if rule.Region != "" {
+            score = 1
+        }
+        score += len(rule.PostalPrefix) * 2
+        if score > bestScore {
+            best, bestScore = rule, score
+        }
+    }
+    return best
+}
+
+func (t *TableCalculator) lineTax(loc Location, class string, amount money.Money) LineTax {
+    rule := t.match(loc, class)
+    if rule == nil {
+        return LineTax{Amount: money.Zero(amount.Currency), Inclusive: t.PricesIncludeTax}
+    }
+
+    inclusive := t.PricesIncludeTax
+    if rule.Inclusive != nil {
+        inclusive = *rule.Inclusive
+    }
+
+    var taxAmount int64
+    if inclusive {
+        // Extract the tax already contained in the gross amount
+        taxAmount = amount.Amount - int64(math.Round(float64(amount.Amount)/(1+rule.Rate/100)))
+    } else {
+        taxAmount = int64(math.Round(float64(amount.Amount) * rule.Rate / 100))
+    }
+
+    return LineTax{
+        Name:      rule.Name,
+        Rate:      rule.Rate,
+        Amount:    money.New(taxAmount, amount.Currency),
+        Inclusive: inclusive,
+    }
+}
+
+func (t *TableCalculator) Calculate(loc Location, lines []Line, shipping money.Money) (*Result, error) {
+    loc = loc.normalize()
+    result := &Result{
+        Lines: make([]LineTax, len(lines)),
+        Total: money.Zero(shipping.Currency),
+        Added: money.Zero(shipping.Currency),
+    }
+
+    for i, line := range lines {
+        result.Lines[i] = t.lineTax(loc, t.classFor(line.Category), line.Amount)
+    }
+    result.Shipping = t.lineTax(loc, t.ShippingClass, shipping)
+
+    for _, line := range append(result.Lines, result.Shipping) {
+        result.Total = result.Total.Add(line.Amount)
+        if !line.Inclusive {
+            result.Added = result.Added.Add(line.Amount)
+        }
+    }
+
+    return result, nil
+}
@@ -0,0 +1,85 @@
+// Package tax computes sales tax and VAT for cart and order lines.
+package tax
+
+import (
+	"strings"
+	"sync"
+
+	"server/money"
+)
+
+// Location is the part of a shipping address that tax rules match on.
+type Location struct {
+    Country    string
+    Region     string
+    PostalCode string
+}
+
+func (l Location) normalize() Location {
+    return Location{
+        Country:    strings.ToUpper(strings.TrimSpace(l.Country)),
+        Region:     strings.ToUpper(strings.TrimSpace(l.Region)),
+        PostalCode: strings.ToUpper(strings.ReplaceAll(l.PostalCode, " ", "")),
+    }
+}
+
+// Line is a taxable amount, already net of discounts.
+type Line struct {
+    Category string
+    Amount   money.Money
+}
+
+type LineTax struct {
+    Name      string      `json:"name,omitempty"`
+    Rate      float64     `json:"rate"` // Percent
+    Amount    money.Money `json:"amount"`
+    Inclusive bool        `json:"inclusive"`
+}
+
+type Result struct {
+    Lines    []LineTax   `json:"lines"` // Aligned with the input lines
+    Shipping LineTax     `json:"shipping"`
+    Total    money.Money `json:"total"`
+
+    // Added is the exclusive part of Total, i.e. the tax that goes on top
+    // of the prices. Inclusive tax is already contained in them.
+    Added money.Money `json:"added"`
+}
+
+type Calculator interface {
+    Calculate(loc Location, lines []Line, shipping money.Money) (*Result, error)
+}
+
+// NoTax is used when no rate table is configured.
+type NoTax struct{}
+
+func (NoTax) Calculate(loc Location, lines []Line, shipping money.Money) (*Result, error) {
+    result := &Result{
+        Lines:    make([]LineTax, len(lines)),
+        Shipping: LineTax{Amount: money.Zero(shipping.Currency)},
+        Total:    money.Zero(shipping.Currency),
+        Added:    money.Zero(shipping.Currency),
+    }
+    for i, line := range lines {
+        result.Lines[i] = LineTax{Amount: money.Zero(line.Amount.Currency)}
+    }
+    return result, nil
+}
+
+var (
+    mu         sync.RWMutex
+    calculator Calculator = NoTax{}
+)
+
+func SetCalculator(c Calculator) {
+    mu.Lock()
+    defer mu.Unlock()
+    calculator = c
+}
+
+// Default returns the calculator configured at startup.
+func Default() Calculator {
+    mu.RLock()
+    defer mu.RUnlock()
+    return calculator
+}
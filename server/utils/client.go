@@ -4,33 +4,44 @@ import (
 	"net"
 	"net/http"
 	"strings"
+
+	"server/config"
 )
 
+// GetClientIP returns the address of the client. Forwarding headers can
+// be set by anyone, so they are only read when the connection comes from
+// a trusted proxy; X-Forwarded-For is then walked from the right, past
+// the trusted proxies, to the first hop that no proxy of ours added.
 func GetClientIP(r *http.Request) string {
-    // Check X-Forwarded-For header
-    xff := r.Header.Get("X-Forwarded-For")
-    if xff != "" {
-        // X-Forwarded-For can contain multiple IPs, take the first one
-        ips := strings.Split(xff, ",")
-        if len(ips) > 0 {
-            ip := strings.TrimSpace(ips[0])
-            if net.ParseIP(ip) != nil {
-                return ip
-            }
-        }
+    remote, _, err := net.SplitHostPort(r.RemoteAddr)
+    if err != nil {
+        remote = r.RemoteAddr
+    }
+    remoteIP := net.ParseIP(remote)
+    if remoteIP == nil || !config.IsTrustedProxy(remoteIP) {
+        return remote
     }
 
-    // Check X-Real-IP header
-    xri := r.Header.Get("X-Real-IP")
-    if xri != "" && net.ParseIP(xri) != nil {
-        return xri
+    // Check X-Forwarded-For header; several headers count as one list
+    var hops []string
+    for _, value := range r.Header.Values("X-Forwarded-For") {
+        hops = append(hops, strings.Split(value, ",")...)
+    }
+    for i := len(hops) - 1; i >= 0; i-- {
+        ip := net.ParseIP(strings.TrimSpace(hops[i]))
+        if ip == nil {
+            // Whatever is further left cannot be trusted either
+            break
+        }
+        if !config.IsTrustedProxy(ip) || i == 0 {
+            return ip.String()
+        }
     }
 
-    // Fall back to RemoteAddr
-    ip, _, err := net.SplitHostPort(r.RemoteAddr)
-    if err != nil {
-        return r.RemoteAddr
+    // Check X-Real-IP header, set by the trusted proxy
+    if xri := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); xri != nil && len(hops) == 0 {
+        return xri.String()
     }
-    
-    return ip
+
+    return remote
 }
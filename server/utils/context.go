@@ -0,0 +1,12 @@
+package utils
+
+import (
+	"context"
+)
+
+// UserIDFromContext returns the authenticated user ID that AuthMiddleware
+// stored on the request context.
+func UserIDFromContext(ctx context.Context) (int, bool) {
+    userID, ok := ctx.Value("user_id").(int)
+    return userID, ok
+}
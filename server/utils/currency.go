@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"server/money"
+)
+
+// RequestCurrency resolves the currency a client wants prices in. The
+// ?currency= query parameter wins over the Accept-Currency header, and
+// the base currency is used when neither is set.
+func RequestCurrency(r *http.Request) (string, error) {
+    raw := r.URL.Query().Get("currency")
+    if raw == "" {
+        // Accept-Currency may list several values; only the first is honored
+        raw = strings.SplitN(r.Header.Get("Accept-Currency"), ",", 2)[0]
+        raw = strings.SplitN(raw, ";", 2)[0]
+    }
+    if strings.TrimSpace(raw) == "" {
+        return money.BaseCurrency(), nil
+    }
+
+    currency, ok := money.NormalizeCurrency(raw)
+    if !ok || !money.IsSupported(currency) {
+        return "", fmt.Errorf("unsupported currency %q", strings.TrimSpace(raw))
+    }
+    return currency, nil
+}
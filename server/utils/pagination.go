@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+)
+
+const (
+    DefaultPageSize = 20
+    MaxPageSize     = 100
+)
+
+type Pagination struct {
+    Page     int
+    PageSize int
+}
+
+type PaginatedResponse struct {
+    Items      interface{} `json:"items"`
+    Page       int         `json:"page"`
+    PageSize   int         `json:"page_size"`
+    Total      int         `json:"total"`
+    TotalPages int         `json:"total_pages"`
+}
+
+// ParsePagination reads ?page= and ?page_size= from the query string,
+// falling back to defaults for missing or invalid values.
+func ParsePagination(r *http.Request) Pagination {
+    p := Pagination{Page: 1, PageSize: DefaultPageSize}
+
+    if page, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && page > 0 {
+        p.Page = page
+    }
+
+    if size, err := strconv.Atoi(r.URL.Query().Get("page_size")); err == nil && size > 0 {
+        p.PageSize = size
+    }
+    if p.PageSize > MaxPageSize {
+        p.PageSize = MaxPageSize
+    }
+
+    return p
+}
+
+func (p Pagination) Offset() int {
+    return (p.Page - 1) * p.PageSize
+}
+
+func (p Pagination) Response(items interface{}, total int) PaginatedResponse {
+    return PaginatedResponse{
+        Items:      items,
+        Page:       p.Page,
+        PageSize:   p.PageSize,
+        Total:      total,
+        TotalPages: (total + p.PageSize - 1) / p.PageSize,
+    }
+}
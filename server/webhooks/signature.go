@@ -0,0 +1,66 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const SignatureHeader = "X-Webhook-Signature"
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Sign returns the signature header value for a body sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Including the
+// timestamp lets receivers reject replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+    t := strconv.FormatInt(timestamp.Unix(), 10)
+    return fmt.Sprintf("t=%s,v1=%s", t, computeSignature(secret, t, body))
+}
+
+// Verify checks a signature header against the body, rejecting
+// signatures older than tolerance. Receivers written in Go can use it as
+// is; it documents the scheme for everyone else.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+    var t, v1 string
+    for _, part := range strings.Split(header, ",") {
+        key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+        if !ok {
+            continue
+        }
+        switch key {
+        case "t":
+            t = value
+        case "v1":
+            v1 = value
+        }
+    }
+    if t == "" || v1 == "" {
+        return ErrInvalidSignature
+    }
+
+    unix, err := strconv.ParseInt(t, 10, 64)
+    if err != nil {
+        return ErrInvalidSignature
+    }
+    if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+        return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+    }
+
+    if !hmac.Equal([]byte(v1), []byte(computeSignature(secret, t, body))) {
+        return ErrInvalidSignature
+    }
+    return nil
+}
+
+func computeSignature(secret, timestamp string, body []byte) string {
+    mac := hmac.New(sha256.New, []byte(secret))
+    mac.Write([]byte(timestamp + "."))
+    mac.Write(body)
+    return hex.EncodeToString(mac.Sum(nil))
+}
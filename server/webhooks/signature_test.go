@@ -0,0 +1,69 @@
+package webhooks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignVerifyRoundTrip(t *testing.T) {
+    body := []byte(`{"id":1,"type":"order.paid"}`)
+    header := Sign("secret", time.Now(), body)
+
+    if err := Verify("secret", header, body, 5*time.Minute); err != nil {
+        t.Fatalf("Verify: %v", err)
+    }
+}
+
+func TestVerifyTimestampTolerance(t *testing.T) {
+    body := []byte(`{}`)
+    tests := []struct {
+        name    string
+        age     time.Duration
+        wantErr bool
+    }{
+        {"fresh", 0, false},
+        {"within tolerance", 4 * time.Minute, false},
+        {"too old", 6 * time.Minute, true},
+        {"too far ahead", -6 * time.Minute, true},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            header := Sign("secret", time.Now().Add(-tt.age), body)
+            err := Verify("secret", header, body, 5*time.Minute)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("Verify error = %v, wantErr %v", err, tt.wantErr)
+            }
+            if err != nil && !errors.Is(err, ErrInvalidSignature) {
+                t.Errorf("Verify error = %v, want ErrInvalidSignature", err)
+            }
+        })
+    }
+}
+
+func TestVerifyRejects(t *testing.T) {
+    body := []byte(`{"amount":100}`)
+    header := Sign("secret", time.Now(), body)
+
+    tests := []struct {
+        name   string
+        secret string
+        header string
+        body   []byte
+    }{
+        {"tampered body", "secret", header, []byte(`{"amount":999}`)},
+        {"wrong secret", "other", header, body},
+        {"missing signature", "secret", "t=123", body},
+        {"bad timestamp", "secret", "t=abc,v1=00", body},
+        {"empty header", "secret", "", body},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute); !errors.Is(err, ErrInvalidSignature) {
+                t.Errorf("Verify error = %v, want ErrInvalidSignature", err)
+            }
+        })
+    }
+}
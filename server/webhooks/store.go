@@ -0,0 +1,290 @@
+// Package webhooks delivers domain events to merchant-registered HTTP
+// endpoints, signed with a per-endpoint secret.
+package webhooks
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"server/config"
+	"server/events"
+
+	"github.com/lib/pq"
+)
+
+const (
+    DeliveryPending   = "pending"
+    DeliverySucceeded = "succeeded"
+    DeliveryFailed    = "failed"
+)
+
+var (
+    ErrEndpointNotFound = errors.New("webhook endpoint not found")
+    ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+type Endpoint struct {
+    ID             int        `json:"id"`
+    URL            string     `json:"url"`
+    Description    string     `json:"description"`
+    Secret         string     `json:"secret,omitempty"` // Only returned when created or rotated
+    EventTypes     []string   `json:"event_types"`      // Empty means every event
+    IsActive       bool       `json:"is_active"`
+    FailureCount   int        `json:"failure_count"` // Consecutive failed attempts
+    DisabledAt     *time.Time `json:"disabled_at,omitempty"`
+    DisabledReason string     `json:"disabled_reason,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type Delivery struct {
+    ID             int             `json:"id"`
+    EndpointID     int             `json:"endpoint_id"`
+    EventID        int64           `json:"event_id"`
+    EventType      string          `json:"event_type"`
+    Payload        json.RawMessage `json:"payload"`
+    Status         string          `json:"status"`
+    Attempts       int             `json:"attempts"`
+    NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+    LastStatusCode int             `json:"last_status_code,omitempty"`
+    LastError      string          `json:"last_error,omitempty"`
+    LastResponse   string          `json:"last_response,omitempty"`
+    DurationMS     int             `json:"duration_ms"`
+    RedeliveryOf   *int            `json:"redelivery_of,omitempty"`
+    DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+    CreatedAt      time.Time       `json:"created_at"`
+}
+
+const endpointColumns = `id, url, description, event_types, is_active, failure_count,
+    disabled_at, disabled_reason, created_at, updated_at`
+
+func scanEndpoint(row interface{ Scan(...interface{}) error }) (*Endpoint, error) {
+    var e Endpoint
+    var disabledAt sql.NullTime
+    err := row.Scan(&e.ID, &e.URL, &e.Description, pq.Array(&e.EventTypes), &e.IsActive, &e.FailureCount,
+        &disabledAt, &e.DisabledReason, &e.CreatedAt, &e.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+    if disabledAt.Valid {
+        e.DisabledAt = &disabledAt.Time
+    }
+    if e.EventTypes == nil {
+        e.EventTypes = []string{}
+    }
+    return &e, nil
+}
+
+// NewSecret generates a signing secret for an endpoint.
+func NewSecret() (string, error) {
+    buf := make([]byte, 24)
+    if _, err := rand.Read(buf); err != nil {
+        return "", err
+    }
+    return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// CreateEndpoint registers an endpoint. The returned value carries the
+// secret, which is not shown again.
+func CreateEndpoint(url, description, secret string, eventTypes []string) (*Endpoint, error) {
+    endpoint, err := scanEndpoint(config.DB.QueryRow(`
+        INSERT INTO webhook_endpoints (url, description, secret, event_types)
+        VALUES ($1, $2, $3, $4)
+        RETURNING `+endpointColumns,
+        url, description, secret, pq.Array(eventTypes),
+    ))
+    if err != nil {
+        return nil, err
+    }
+
+    endpoint.Secret = secret
+    return endpoint, nil
+}
+
+// UpdateEndpoint replaces an endpoint's settings. Re-activating a disabled
+// endpoint clears its failure count.
+func UpdateEndpoint(id int, url, description string, eventTypes []string, isActive bool) (*Endpoint, error) {
+    endpoint, err := scanEndpoint(config.DB.QueryRow(`
+        UPDATE webhook_endpoints
+        SET url = $1, description = $2, event_types = $3, is_active = $4,
+            failure_count = CASE WHEN $4 AND NOT is_active THEN 0 ELSE failure_count END,
+            disabled_at = CASE WHEN $4 THEN NULL ELSE disabled_at END,
+            disabled_reason = CASE WHEN $4 THEN '' ELSE disabled_reason END,
+            updated_at = NOW()
+        WHERE id = $5
+        RETURNING `+endpointColumns,
+        url, description, pq.Array(eventTypes), isActive, id,
+    ))
+    if err == sql.ErrNoRows {
+        return nil, ErrEndpointNotFound
+    }
+    return endpoint, err
+}
+
+// RotateSecret replaces the signing secret and returns the endpoint with
+// the new one.
+func RotateSecret(id int) (*Endpoint, error) {
+    secret, err := NewSecret()
+    if err != nil {
+        return nil, err
+    }
+
+    endpoint, err := scanEndpoint(config.DB.QueryRow(`
+        UPDATE webhook_endpoints SET secret = $1, updated_at = NOW()
+        WHERE id = $2
+        RETURNING `+endpointColumns,
+        secret, id,
+    ))
+    if err == sql.ErrNoRows {
+        return nil, ErrEndpointNotFound
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    endpoint.Secret = secret
+    return endpoint, nil
+}
+
+func DeleteEndpoint(id int) error {
+    result, err := config.DB.Exec("DELETE FROM webhook_endpoints WHERE id = $1", id)
+    if err != nil {
+        return err
+    }
+    if n, _ := result.RowsAffected(); n == 0 {
+        return ErrEndpointNotFound
+    }
+    return nil
+}
+
+func GetEndpoint(id int) (*Endpoint, error) {
+    endpoint, err := scanEndpoint(config.DB.QueryRow("SELECT "+endpointColumns+" FROM webhook_endpoints WHERE id = $1", id))
+    if err == sql.ErrNoRows {
+        return nil, ErrEndpointNotFound
+    }
+    return endpoint, err
+}
+
+func ListEndpoints() ([]Endpoint, error) {
+    rows, err := config.DB.Query("SELECT " + endpointColumns + " FROM webhook_endpoints ORDER BY id")
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    endpoints := []Endpoint{}
+    for rows.Next() {
+        endpoint, err := scanEndpoint(rows)
+        if err != nil {
+            return nil, err
+        }
+        endpoints = append(endpoints, *endpoint)
+    }
+
+    return endpoints, rows.Err()
+}
+
+// OnEvent is the outbox subscriber that queues one delivery per active
+// endpoint listening to the event. Redelivered events are not queued twice.
+func OnEvent(ctx context.Context, event events.Event) error {
+    _, err := config.DB.ExecContext(ctx, `
+        INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, occurred_at)
+        SELECT id, $1, $2, $3, $4
+        FROM webhook_endpoints
+        WHERE is_active AND (cardinality(event_types) = 0 OR $2 = ANY(event_types))
+        ON CONFLICT (endpoint_id, event_id) WHERE redelivery_of IS NULL DO NOTHING`,
+        event.ID, event.Type, []byte(event.Payload), event.OccurredAt,
+    )
+    return err
+}
+
+const deliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+    last_status_code, last_error, last_response, duration_ms, redelivery_of, delivered_at, created_at`
+
+// ListDeliveries returns an endpoint's delivery log, newest first.
+func ListDeliveries(endpointID int, status string, limit, offset int) ([]Delivery, int, error) {
+    where := "WHERE endpoint_id = $1"
+    args := []interface{}{endpointID}
+    if status != "" {
+        where += " AND status = $2"
+        args = append(args, status)
+    }
+
+    var total int
+    if err := config.DB.QueryRow("SELECT COUNT(*) FROM webhook_deliveries "+where, args...).Scan(&total); err != nil {
+        return nil, 0, err
+    }
+
+    args = append(args, limit, offset)
+    query := "SELECT " + deliveryColumns + " FROM webhook_deliveries " + where + " ORDER BY id DESC"
+    if status != "" {
+        query += " LIMIT $3 OFFSET $4"
+    } else {
+        query += " LIMIT $2 OFFSET $3"
+    }
+
+    rows, err := config.DB.Query(query, args...)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer rows.Close()
+
+    deliveries := []Delivery{}
+    for rows.Next() {
+        delivery, err := scanDelivery(rows)
+        if err != nil {
+            return nil, 0, err
+        }
+        deliveries = append(deliveries, *delivery)
+    }
+
+    return deliveries, total, rows.Err()
+}
+
+// Redeliver queues a fresh copy of a past delivery, keeping the original
+// in the log.
+func Redeliver(deliveryID int) (*Delivery, error) {
+    delivery, err := scanDelivery(config.DB.QueryRow(`
+        INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload, occurred_at, redelivery_of)
+        SELECT endpoint_id, event_id, event_type, payload, occurred_at, id
+        FROM webhook_deliveries
+        WHERE id = $1
+        RETURNING `+deliveryColumns,
+        deliveryID,
+    ))
+    if err == sql.ErrNoRows {
+        return nil, ErrDeliveryNotFound
+    }
+    return delivery, err
+}
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (*Delivery, error) {
+    var d Delivery
+    var payload []byte
+    var nextAttemptAt, deliveredAt sql.NullTime
+    var redeliveryOf sql.NullInt64
+    err := row.Scan(&d.ID, &d.EndpointID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+        &nextAttemptAt, &d.LastStatusCode, &d.LastError, &d.LastResponse, &d.DurationMS,
+        &redeliveryOf, &deliveredAt, &d.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    d.Payload = payload
+    if nextAttemptAt.Valid && d.Status == DeliveryPending {
+        d.NextAttemptAt = &nextAttemptAt.Time
+    }
+    if deliveredAt.Valid {
+        d.DeliveredAt = &deliveredAt.Time
+    }
+    if redeliveryOf.Valid {
+        id := int(redeliveryOf.Int64)
+        d.RedeliveryOf = &id
+    }
+    return &d, nil
+}
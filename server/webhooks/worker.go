@@ -0,0 +1,301 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"server/config"
+)
+
+type WorkerConfig struct {
+    PollInterval time.Duration
+    BatchSize    int
+    Concurrency  int           // Deliveries sent in parallel
+    Timeout      time.Duration // Per request
+    MaxAttempts  int           // After this many failures a delivery is marked failed
+    BaseBackoff  time.Duration // Doubled on every failed attempt
+    MaxBackoff   time.Duration
+    DisableAfter int // Consecutive failures before an endpoint is disabled
+}
+
+var DefaultWorkerConfig = WorkerConfig{
+    PollInterval: 2 * time.Second,
+    BatchSize:    50,
+    Concurrency:  8,
+    Timeout:      10 * time.Second,
+    MaxAttempts:  8,
+    BaseBackoff:  30 * time.Second,
+    MaxBackoff:   6 * time.Hour,
+    DisableAfter: 20,
+}
+
+// Bytes of the endpoint's response kept in the delivery log
+const maxResponseLog = 4096
+
+// Worker sends pending deliveries. Several server instances can run one
+// each: deliveries are leased with SKIP LOCKED before being sent.
+type Worker struct {
+    config WorkerConfig
+    client *http.Client
+}
+
+func NewWorker(config WorkerConfig) *Worker {
+    return &Worker{
+        config: config,
+        client: &http.Client{
+            Timeout: config.Timeout,
+            // Receivers must answer at the registered URL
+            CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+        },
+    }
+}
+
+// Start runs the delivery loop in a goroutine until ctx is cancelled.
+func (w *Worker) Start(ctx context.Context) {
+    go func() {
+        ticker := time.NewTicker(w.config.PollInterval)
+        defer ticker.Stop()
+
+        for {
+            for {
+                n, err := w.sendBatch(ctx)
+                if err != nil {
+                    log.Printf("Webhook delivery error: %v", err)
+                    break
+                }
+                if n < w.config.BatchSize {
+                    break
+                }
+            }
+
+            select {
+            case <-ctx.Done():
+                return
+            case <-ticker.C:
+            }
+        }
+    }()
+}
+
+type leasedDelivery struct {
+    id         int
+    eventID    int64
+    eventType  string
+    payload    json.RawMessage
+    occurredAt time.Time
+    attempts   int
+    endpointID int
+    url        string
+    secret     string
+
+    // next_attempt_at as leased; records only apply while it is unchanged
+    leasedUntil time.Time
+}
+
+// sendBatch leases due deliveries by pushing their next attempt past the
+// time the whole batch can take, so the rows need not stay locked while
+// requests are in flight. A crashed worker's lease simply expires.
+func (w *Worker) sendBatch(ctx context.Context) (int, error) {
+    rounds := (w.config.BatchSize + w.config.Concurrency - 1) / w.config.Concurrency
+    lease := 2 * w.config.Timeout * time.Duration(rounds)
+    rows, err := config.DB.QueryContext(ctx, `
+        UPDATE webhook_deliveries d
+        SET next_attempt_at = NOW() + $2 * INTERVAL '1 millisecond'
+        FROM webhook_endpoints e
+        WHERE e.id = d.endpoint_id AND d.id IN (
+            SELECT wd.id
+            FROM webhook_deliveries wd
+            JOIN webhook_endpoints we ON we.id = wd.endpoint_id
+            WHERE wd.status = $3 AND wd.next_attempt_at <= NOW() AND we.is_active
+            ORDER BY wd.id
+            LIMIT $1
+            FOR UPDATE OF wd SKIP LOCKED
+        )
+        RETURNING d.id, d.event_id, d.event_type, d.payload, d.occurred_at, d.attempts, e.id, e.url, e.secret,
+            d.next_attempt_at`,
+        w.config.BatchSize, lease.Milliseconds(), DeliveryPending,
+    )
+    if err != nil {
+        return 0, err
+    }
+
+    var batch []leasedDelivery
+    for rows.Next() {
+        var d leasedDelivery
+        var payload []byte
+        if err := rows.Scan(&d.id, &d.eventID, &d.eventType, &payload, &d.occurredAt, &d.attempts,
+            &d.endpointID, &d.url, &d.secret, &d.leasedUntil); err != nil {
+            rows.Close()
+            return 0, err
+        }
+        d.payload = payload
+        batch = append(batch, d)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, err
+    }
+
+    var wg sync.WaitGroup
+    slots := make(chan struct{}, w.config.Concurrency)
+    for _, d := range batch {
+        wg.Add(1)
+        slots <- struct{}{}
+        go func(d leasedDelivery) {
+            defer wg.Done()
+            defer func() { <-slots }()
+
+            if err := w.attempt(ctx, d); err != nil {
+                log.Printf("Webhook delivery %d: failed to record attempt: %v", d.id, err)
+            }
+        }(d)
+    }
+    wg.Wait()
+
+    return len(batch), nil
+}
+
+// Body is the JSON document POSTed to endpoints.
+type Body struct {
+    ID         int64           `json:"id"` // Event ID; the same across retries and redeliveries
+    Type       string          `json:"type"`
+    OccurredAt time.Time       `json:"occurred_at"`
+    Data       json.RawMessage `json:"data"`
+}
+
+type attemptResult struct {
+    statusCode int
+    response   string
+    err        error
+    duration   time.Duration
+}
+
+func (w *Worker) attempt(ctx context.Context, d leasedDelivery) error {
+    result := w.send(ctx, d)
+    if result.err == nil && result.statusCode >= 200 && result.statusCode < 300 {
+        return recordSuccess(ctx, d, result)
+    }
+    if result.err == nil {
+        result.err = fmt.Errorf("endpoint responded with status %d", result.statusCode)
+    }
+    return w.recordFailure(ctx, d, result)
+}
+
+func (w *Worker) send(ctx context.Context, d leasedDelivery) attemptResult {
+    body, err := json.Marshal(Body{ID: d.eventID, Type: d.eventType, OccurredAt: d.occurredAt, Data: d.payload})
+    if err != nil {
+        return attemptResult{err: err}
+    }
+
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.url, bytes.NewReader(body))
+    if err != nil {
+        return attemptResult{err: err}
+    }
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("User-Agent", "server-webhooks/1.0")
+    req.Header.Set("X-Webhook-Event", d.eventType)
+    req.Header.Set("X-Webhook-Delivery", strconv.Itoa(d.id))
+    req.Header.Set(SignatureHeader, Sign(d.secret, time.Now(), body))
+
+    start := time.Now()
+    resp, err := w.client.Do(req)
+    if err != nil {
+        return attemptResult{err: err, duration: time.Since(start)}
+    }
+    defer resp.Body.Close()
+
+    // Stored as text, so drop anything Postgres would reject
+    response, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseLog))
+    logged := strings.ReplaceAll(strings.ToValidUTF8(string(response), ""), "\x00", "")
+    return attemptResult{statusCode: resp.StatusCode, response: logged, duration: time.Since(start)}
+}
+
+// recordSuccess marks a delivery succeeded and resets the endpoint's
+// failure count. A delivery whose lease was lost is left alone.
+func recordSuccess(ctx context.Context, d leasedDelivery, result attemptResult) error {
+    res, err := config.DB.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = $1, attempts = attempts + 1, last_status_code = $2, last_error = '',
+            last_response = $3, duration_ms = $4, delivered_at = NOW()
+        WHERE id = $5 AND status = $6 AND next_attempt_at = $7`,
+        DeliverySucceeded, result.statusCode, result.response, result.duration.Milliseconds(), d.id,
+        DeliveryPending, d.leasedUntil,
+    )
+    if err != nil {
+        return err
+    }
+    if n, err := res.RowsAffected(); err != nil || n == 0 {
+        return err
+    }
+
+    _, err = config.DB.ExecContext(ctx, "UPDATE webhook_endpoints SET failure_count = 0 WHERE id = $1 AND failure_count > 0", d.endpointID)
+    return err
+}
+
+// recordFailure schedules the next attempt, or gives up after MaxAttempts,
+// and counts the failure against the endpoint, disabling it once it has
+// failed DisableAfter times in a row. A delivery whose lease was lost is
+// left alone.
+func (w *Worker) recordFailure(ctx context.Context, d leasedDelivery, result attemptResult) error {
+    attempts := d.attempts + 1
+    status := DeliveryPending
+    if attempts >= w.config.MaxAttempts {
+        status = DeliveryFailed
+    }
+
+    res, err := config.DB.ExecContext(ctx, `
+        UPDATE webhook_deliveries
+        SET status = $1, attempts = $2, last_status_code = $3, last_error = $4, last_response = $5,
+            duration_ms = $6, next_attempt_at = NOW() + $7 * INTERVAL '1 millisecond'
+        WHERE id = $8 AND status = $9 AND next_attempt_at = $10`,
+        status, attempts, result.statusCode, result.err.Error(), result.response,
+        result.duration.Milliseconds(), w.backoff(attempts).Milliseconds(), d.id,
+        DeliveryPending, d.leasedUntil,
+    )
+    if err != nil {
+        return err
+    }
+    if n, err := res.RowsAffected(); err != nil || n == 0 {
+        return err
+    }
+
+    reason := fmt.Sprintf("disabled after %d consecutive failed deliveries", w.config.DisableAfter)
+    var disabled bool
+    err = config.DB.QueryRowContext(ctx, `
+        UPDATE webhook_endpoints
+        SET failure_count = failure_count + 1,
+            is_active = is_active AND failure_count + 1 < $1,
+            disabled_at = CASE WHEN is_active AND failure_count + 1 >= $1 THEN NOW() ELSE disabled_at END,
+            disabled_reason = CASE WHEN is_active AND failure_count + 1 >= $1 THEN $2 ELSE disabled_reason END
+        WHERE id = $3
+        RETURNING COALESCE(disabled_at = NOW(), FALSE)`,
+        w.config.DisableAfter, reason, d.endpointID,
+    ).Scan(&disabled)
+    if err != nil {
+        return err
+    }
+    if disabled {
+        log.Printf("Webhook endpoint %d %s", d.endpointID, reason)
+    }
+    return nil
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+    delay := w.config.BaseBackoff
+    for i := 1; i < attempts && delay < w.config.MaxBackoff; i++ {
+        delay *= 2
+    }
+    if delay > w.config.MaxBackoff {
+        delay = w.config.MaxBackoff
+    }
+    return delay
+}
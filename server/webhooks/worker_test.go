@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"server/config"
+)
+
+func TestWorkerBackoff(t *testing.T) {
+    w := NewWorker(WorkerConfig{BaseBackoff: 30 * time.Second, MaxBackoff: 6 * time.Hour})
+
+    tests := []struct {
+        attempts int
+        want     time.Duration
+    }{
+        {1, 30 * time.Second},
+        {2, time.Minute},
+        {5, 8 * time.Minute},
+        {10, 256 * time.Minute},
+        {11, 6 * time.Hour},
+        {100, 6 * time.Hour},
+    }
+
+    for _, tt := range tests {
+        if got := w.backoff(tt.attempts); got != tt.want {
+            t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+        }
+    }
+}
+
+func TestWorkerDeliverySignsRequest(t *testing.T) {
+    db := useFakeDB(t)
+
+    var header string
+    var body []byte
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        header = r.Header.Get(SignatureHeader)
+        body, _ = io.ReadAll(r.Body)
+        w.WriteHeader(http.StatusNoContent)
+    }))
+    defer srv.Close()
+
+    w := NewWorker(DefaultWorkerConfig)
+    if err := w.attempt(context.Background(), testDelivery(srv.URL)); err != nil {
+        t.Fatalf("attempt: %v", err)
+    }
+
+    if header == "" {
+        t.Fatalf("request had no %s header", SignatureHeader)
+    }
+    if err := Verify("whsec", header, body, time.Minute); err != nil {
+        t.Errorf("Verify: %v", err)
+    }
+
+    update := db.find(t, "UPDATE webhook_deliveries")
+    if update.args[0] != DeliverySucceeded || update.args[1] != int64(http.StatusNoContent) {
+        t.Errorf("delivery recorded with status %v, code %v", update.args[0], update.args[1])
+    }
+}
+
+func TestWorkerDeliveryFailureCountsTowardDisable(t *testing.T) {
+    db := useFakeDB(t)
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "boom", http.StatusInternalServerError)
+    }))
+    defer srv.Close()
+
+    cfg := DefaultWorkerConfig
+    cfg.DisableAfter = 3
+    w := NewWorker(cfg)
+
+    for i := 0; i < cfg.DisableAfter; i++ {
+        if err := w.attempt(context.Background(), testDelivery(srv.URL)); err != nil {
+            t.Fatalf("attempt: %v", err)
+        }
+    }
+
+    update := db.find(t, "UPDATE webhook_deliveries")
+    if update.args[0] != DeliveryPending || update.args[1] != int64(1) || update.args[2] != int64(http.StatusInternalServerError) {
+        t.Errorf("delivery recorded with status %v, attempts %v, code %v", update.args[0], update.args[1], update.args[2])
+    }
+    if msg, _ := update.args[3].(string); !strings.Contains(msg, "500") {
+        t.Errorf("last_error = %q, want the status code", msg)
+    }
+
+    endpoint := db.find(t, "UPDATE webhook_endpoints")
+    if endpoint.args[0] != int64(cfg.DisableAfter) {
+        t.Errorf("endpoint disabled after %v failures, want %d", endpoint.args[0], cfg.DisableAfter)
+    }
+    if db.failures != cfg.DisableAfter || !db.disabled {
+        t.Errorf("endpoint failures = %d, disabled = %v; want %d, true", db.failures, db.disabled, cfg.DisableAfter)
+    }
+}
+
+func TestWorkerLostLeaseIsNotRecorded(t *testing.T) {
+    db := useFakeDB(t)
+    db.leaseLost = true
+
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.Error(w, "boom", http.StatusInternalServerError)
+    }))
+    defer srv.Close()
+
+    d := testDelivery(srv.URL)
+    if err := NewWorker(DefaultWorkerConfig).attempt(context.Background(), d); err != nil {
+        t.Fatalf("attempt: %v", err)
+    }
+
+    update := db.find(t, "UPDATE webhook_deliveries")
+    if update.args[8] != DeliveryPending || update.args[9] != d.leasedUntil {
+        t.Errorf("update not guarded by the lease: status %v, next_attempt_at %v", update.args[8], update.args[9])
+    }
+    if db.failures != 0 {
+        t.Errorf("endpoint failures = %d, want 0 for a lost lease", db.failures)
+    }
+}
+
+func testDelivery(url string) leasedDelivery {
+    return leasedDelivery{
+        id:          7,
+        eventID:     42,
+        eventType:   "order.paid",
+        payload:     []byte(`{"order_id":1}`),
+        occurredAt:  time.Now(),
+        endpointID:  3,
+        url:         url,
+        secret:      "whsec",
+        leasedUntil: time.Date(2024, 1, 1, 0, 0, 20, 0, time.UTC),
+    }
+}
+
+// fakeDB records the statements the worker runs and keeps an endpoint's
+// failure count, so delivery can be tested without Postgres.
+type fakeDB struct {
+    mu        sync.Mutex
+    calls     []fakeCall
+    failures  int
+    disabled  bool
+    leaseLost bool // Delivery updates match no row
+}
+
+type fakeCall struct {
+    query string
+    args  []driver.Value
+}
+
+func (db *fakeDB) find(t *testing.T, prefix string) fakeCall {
+    t.Helper()
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    for _, c := range db.calls {
+        if strings.HasPrefix(strings.TrimSpace(c.query), prefix) {
+            return c
+        }
+    }
+    t.Fatalf("no statement starting with %q", prefix)
+    return fakeCall{}
+}
+
+func (db *fakeDB) record(query string, args []driver.NamedValue) []driver.Value {
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    values := make([]driver.Value, len(args))
+    for i, a := range args {
+        values[i] = a.Value
+    }
+    db.calls = append(db.calls, fakeCall{query: query, args: values})
+    return values
+}
+
+var (
+    registerFake sync.Once
+    currentFake  *fakeDB
+)
+
+func useFakeDB(t *testing.T) *fakeDB {
+    registerFake.Do(func() { sql.Register("webhooks-fake", fakeDriver{}) })
+
+    currentFake = &fakeDB{}
+    db, err := sql.Open("webhooks-fake", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    previous := config.DB
+    config.DB = db
+    t.Cleanup(func() {
+        db.Close()
+        config.DB = previous
+    })
+    return currentFake
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{db: currentFake}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                        { return nil }
+func (fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+    c.db.record(query, args)
+    if c.db.leaseLost && strings.Contains(query, "UPDATE webhook_deliveries") {
+        return driver.RowsAffected(0), nil
+    }
+    return driver.RowsAffected(1), nil
+}
+
+// QueryContext answers the endpoint failure update with whether it just
+// disabled the endpoint.
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+    values := c.db.record(query, args)
+    if !strings.Contains(query, "UPDATE webhook_endpoints") {
+        return nil, errors.New("unexpected query")
+    }
+
+    c.db.mu.Lock()
+    defer c.db.mu.Unlock()
+    c.db.failures++
+    justDisabled := !c.db.disabled && int64(c.db.failures) >= values[0].(int64)
+    if justDisabled {
+        c.db.disabled = true
+    }
+    return &fakeRows{value: justDisabled}, nil
+}
+
+type fakeRows struct {
+    value bool
+    done  bool
+}
+
+func (*fakeRows) Columns() []string { return []string{"disabled"} }
+func (*fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+    if r.done {
+        return io.EOF
+    }
+    r.done = true
+    dest[0] = r.value
+    return nil
+}